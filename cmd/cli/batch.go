@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"memkv/internal/protocol"
+)
+
+// Exit codes of non-interactive runs
+const (
+	exitOK         = 0
+	exitErrorReply = 1
+	exitIOError    = 2
+)
+
+// maxInputLine bounds a single command read from --file or stdin
+const maxInputLine = 16 << 20
+
+var (
+	inputFile  string
+	rawOutput  bool
+	jsonOutput bool
+)
+
+// stdinIsTerminal reports whether stdin is an interactive terminal
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// runBatch runs the command given as arguments, or every line of --file
+// or stdin, and returns the exit code
+func runBatch(args []string) int {
+	if err := connect(); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not connect to %s: %v\n", serverAddr(), err)
+		return exitIOError
+	}
+	defer closeConnection()
+
+	if len(args) > 0 {
+		return runOne(strings.Join(args, " "))
+	}
+
+	var input io.Reader = os.Stdin
+	if inputFile != "" {
+		f, err := os.Open(inputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitIOError
+		}
+		defer f.Close()
+		input = f
+	}
+
+	status := exitOK
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxInputLine)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		code := runOne(line)
+		if code == exitIOError {
+			return code
+		}
+		status = max(status, code)
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading input: %v\n", err)
+		return exitIOError
+	}
+	return status
+}
+
+// runOne sends a single command and prints its reply
+func runOne(cmd string) int {
+	if isSubscribeCommand(cmd) {
+		err := streamMessages(cmd, printReply)
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitIOError
+	}
+
+	reply, err := sendCommand(cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitIOError
+	}
+
+	printReply(reply)
+	if reply.IsError() {
+		return exitErrorReply
+	}
+	return exitOK
+}
+
+// printReply writes a reply in the selected output mode. Outside JSON
+// mode error replies go to stderr so they never pass for values.
+func printReply(reply protocol.Reply) {
+	switch {
+	case jsonOutput:
+		data, err := json.Marshal(jsonValue(reply))
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return
+		}
+		fmt.Println(string(data))
+	case rawOutput && reply.IsError():
+		fmt.Fprintln(os.Stderr, reply.Str)
+	case rawOutput:
+		fmt.Println(formatRaw(reply))
+	case reply.IsError():
+		fmt.Fprintln(os.Stderr, formatReply(reply))
+	default:
+		fmt.Println(formatReply(reply))
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"memkv/internal/protocol"
+
+	"github.com/spf13/cobra"
+)
+
+// benchOptions are the settings of a benchmark run
+type benchOptions struct {
+	clients   int
+	requests  int64
+	duration  time.Duration
+	workloads []string
+	setRatio  float64 // share of SETs in the mixed workload
+	keyspace  int
+	valueSize int
+	pipeline  int
+	csv       bool
+	json      bool
+}
+
+// benchResult summarizes one workload
+type benchResult struct {
+	Workload   string  `json:"workload"`
+	Requests   int64   `json:"requests"`
+	Errors     int64   `json:"errors"`
+	Seconds    float64 `json:"seconds"`
+	Throughput float64 `json:"requests_per_second"`
+	P50        float64 `json:"p50_ms"`
+	P95        float64 `json:"p95_ms"`
+	P99        float64 `json:"p99_ms"`
+	Max        float64 `json:"max_ms"`
+}
+
+// benchWorkloads are the workloads bench can run
+var benchWorkloads = []string{"set", "get", "incr", "mixed"}
+
+var bench benchOptions
+
+var benchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Measure server throughput and latency",
+	Long: `Run workloads against the server from concurrent connections and report
+throughput and latency percentiles. Each workload runs for --requests
+requests, or for --duration if it is set.
+
+Workloads: set, get, incr and mixed (SET and GET in the --ratio given as
+sets:gets). Error replies are counted. With a pipeline depth above 1,
+every request in a batch is reported with the latency of the whole batch.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		workloads, _ := cmd.Flags().GetString("workloads")
+		ratio, _ := cmd.Flags().GetString("ratio")
+		if err := bench.parse(workloads, ratio); err != nil {
+			return err
+		}
+
+		var results []benchResult
+		for _, workload := range bench.workloads {
+			result, err := runBenchmark(workload, bench)
+			if err != nil {
+				return err
+			}
+			if !bench.csv && !bench.json {
+				printBenchResult(os.Stdout, result)
+			}
+			results = append(results, result)
+		}
+
+		switch {
+		case bench.csv:
+			return writeBenchCSV(os.Stdout, results)
+		case bench.json:
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(results)
+		}
+		return nil
+	},
+}
+
+func init() {
+	flags := benchCmd.Flags()
+	flags.IntVarP(&bench.clients, "clients", "c", 50, "Number of concurrent connections")
+	flags.Int64VarP(&bench.requests, "requests", "n", 100000, "Requests per workload")
+	flags.DurationVar(&bench.duration, "duration", 0, "Run each workload for this long instead of a request count")
+	flags.StringP("workloads", "t", "set,get", "Comma-separated workloads: "+strings.Join(benchWorkloads, ", "))
+	flags.String("ratio", "1:1", "SET:GET ratio of the mixed workload")
+	flags.IntVarP(&bench.keyspace, "keyspace", "r", 100000, "Number of distinct keys used")
+	flags.IntVarP(&bench.valueSize, "data-size", "d", 3, "Size of SET values in bytes")
+	flags.IntVarP(&bench.pipeline, "pipeline", "P", 1, "Requests sent per round trip")
+	flags.BoolVar(&bench.csv, "csv", false, "Print the report as CSV")
+	flags.BoolVar(&bench.json, "json", false, "Print the report as JSON")
+	benchCmd.MarkFlagsMutuallyExclusive("csv", "json")
+
+	rootCmd.AddCommand(benchCmd)
+}
+
+// parse validates the options and decodes the workload list and ratio
+func (o *benchOptions) parse(workloads, ratio string) error {
+	if o.clients < 1 || o.pipeline < 1 || o.keyspace < 1 || o.valueSize < 1 {
+		return fmt.Errorf("clients, pipeline, keyspace and data size must be positive")
+	}
+	if o.duration <= 0 && o.requests < 1 {
+		return fmt.Errorf("either --requests or --duration must be positive")
+	}
+
+	o.workloads = nil
+	for _, w := range strings.Split(workloads, ",") {
+		w = strings.ToLower(strings.TrimSpace(w))
+		if !slices.Contains(benchWorkloads, w) {
+			return fmt.Errorf("unknown workload '%s'", w)
+		}
+		o.workloads = append(o.workloads, w)
+	}
+
+	sets, gets, ok := strings.Cut(ratio, ":")
+	s, err1 := strconv.ParseFloat(sets, 64)
+	g, err2 := strconv.ParseFloat(gets, 64)
+	if !ok || err1 != nil || err2 != nil || s < 0 || g < 0 || s+g == 0 {
+		return fmt.Errorf("invalid ratio '%s', expected sets:gets", ratio)
+	}
+	o.setRatio = s / (s + g)
+	return nil
+}
+
+// benchWorker is one connection of a benchmark run
+type benchWorker struct {
+	opts      benchOptions
+	workload  string
+	value     string
+	rng       *rand.Rand
+	latencies []time.Duration
+	errors    int64
+}
+
+// runBenchmark runs a workload from all clients at once
+func runBenchmark(workload string, opts benchOptions) (benchResult, error) {
+	conns := make([]net.Conn, opts.clients)
+	for i := range conns {
+		c, err := dial()
+		if err != nil {
+			for _, c := range conns[:i] {
+				c.Close()
+			}
+			return benchResult{}, fmt.Errorf("failed to connect to %s: %w", serverAddr(), err)
+		}
+		conns[i] = c
+	}
+
+	// Requests are claimed in batches from a shared budget, or until the
+	// deadline in duration mode
+	var remaining atomic.Int64
+	remaining.Store(opts.requests)
+	var deadline time.Time
+	claim := func() int {
+		if opts.duration > 0 {
+			if time.Now().After(deadline) {
+				return 0
+			}
+			return opts.pipeline
+		}
+		n := remaining.Add(-int64(opts.pipeline))
+		return int(max(min(int64(opts.pipeline), n+int64(opts.pipeline)), 0))
+	}
+
+	workers := make([]*benchWorker, opts.clients)
+	errs := make([]error, opts.clients)
+	var wg sync.WaitGroup
+	start := time.Now()
+	deadline = start.Add(opts.duration)
+	for i := range workers {
+		workers[i] = &benchWorker{
+			opts:     opts,
+			workload: workload,
+			value:    strings.Repeat("x", opts.valueSize),
+			rng:      rand.New(rand.NewPCG(uint64(start.UnixNano()), uint64(i))),
+		}
+		wg.Add(1)
+		go func(w *benchWorker, c net.Conn) {
+			defer wg.Done()
+			defer c.Close()
+			errs[i] = w.run(c, claim)
+		}(workers[i], conns[i])
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	for _, err := range errs {
+		if err != nil {
+			return benchResult{}, fmt.Errorf("%s workload failed: %w", workload, err)
+		}
+	}
+
+	var latencies []time.Duration
+	var errors int64
+	for _, w := range workers {
+		latencies = append(latencies, w.latencies...)
+		errors += w.errors
+	}
+	slices.Sort(latencies)
+
+	result := benchResult{
+		Workload: strings.ToUpper(workload),
+		Requests: int64(len(latencies)),
+		Errors:   errors,
+		Seconds:  elapsed.Seconds(),
+		P50:      percentile(latencies, 50),
+		P95:      percentile(latencies, 95),
+		P99:      percentile(latencies, 99),
+		Max:      percentile(latencies, 100),
+	}
+	if elapsed > 0 {
+		result.Throughput = float64(result.Requests) / elapsed.Seconds()
+	}
+	return result, nil
+}
+
+// run sends batches of claimed requests over c until the budget is spent
+func (w *benchWorker) run(c net.Conn, claim func() int) error {
+	reader := bufio.NewReader(c)
+	var batch []byte
+	for {
+		n := claim()
+		if n == 0 {
+			return nil
+		}
+
+		batch = batch[:0]
+		for i := 0; i < n; i++ {
+			batch = append(batch, w.command()...)
+			batch = append(batch, '\n')
+		}
+
+		start := time.Now()
+		if _, err := c.Write(batch); err != nil {
+			return err
+		}
+		for i := 0; i < n; i++ {
+			reply, err := protocol.ReadReply(reader)
+			if err != nil {
+				return err
+			}
+			if reply.IsError() {
+				w.errors++
+			}
+		}
+
+		latency := time.Since(start)
+		for i := 0; i < n; i++ {
+			w.latencies = append(w.latencies, latency)
+		}
+	}
+}
+
+// command returns the next request of the workload
+func (w *benchWorker) command() string {
+	key := "key:" + strconv.Itoa(w.rng.IntN(w.opts.keyspace))
+	switch w.workload {
+	case "get":
+		return "GET " + key
+	case "incr":
+		return "INCR counter:" + strconv.Itoa(w.rng.IntN(w.opts.keyspace))
+	case "mixed":
+		if w.rng.Float64() >= w.opts.setRatio {
+			return "GET " + key
+		}
+	}
+	return "SET " + key + " " + w.value
+}
+
+// percentile returns the p-th percentile of sorted latencies in milliseconds
+func percentile(sorted []time.Duration, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	i = max(min(i, len(sorted)-1), 0)
+	return float64(sorted[i].Microseconds()) / 1000
+}
+
+func printBenchResult(w io.Writer, r benchResult) {
+	fmt.Fprintf(w, "====== %s ======\n", r.Workload)
+	fmt.Fprintf(w, "  %d requests in %.2f seconds, %d errors\n", r.Requests, r.Seconds, r.Errors)
+	fmt.Fprintf(w, "  %.2f requests per second\n", r.Throughput)
+	fmt.Fprintf(w, "  latency (ms): p50=%.3f p95=%.3f p99=%.3f max=%.3f\n\n", r.P50, r.P95, r.P99, r.Max)
+}
+
+func writeBenchCSV(w io.Writer, results []benchResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"workload", "requests", "errors", "seconds", "requests_per_second", "p50_ms", "p95_ms", "p99_ms", "max_ms"})
+	for _, r := range results {
+		cw.Write([]string{
+			r.Workload,
+			strconv.FormatInt(r.Requests, 10),
+			strconv.FormatInt(r.Errors, 10),
+			strconv.FormatFloat(r.Seconds, 'f', 3, 64),
+			strconv.FormatFloat(r.Throughput, 'f', 2, 64),
+			strconv.FormatFloat(r.P50, 'f', 3, 64),
+			strconv.FormatFloat(r.P95, 'f', 3, 64),
+			strconv.FormatFloat(r.P99, 'f', 3, 64),
+			strconv.FormatFloat(r.Max, 'f', 3, 64),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"bufio"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"net"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 
+	"memkv/internal/protocol"
+
 	"github.com/spf13/cobra"
 )
 
@@ -16,9 +22,19 @@ const (
 )
 
 var (
-	host string
-	port int
-	conn net.Conn
+	host   string
+	port   int
+	socket string
+	conn   net.Conn
+
+	// reader buffers replies for the lifetime of conn
+	reader *bufio.Reader
+
+	// TLS options
+	useTLS   bool
+	caCert   string
+	certFile string
+	keyFile  string
 )
 
 func Banner() {
@@ -27,15 +43,6 @@ func Banner() {
 	fmt.Println("=====================================")
 }
 
-func Help() {
-	fmt.Println("Available Commands:")
-	fmt.Println("1. SET <key> <value>  - Insert or update a key-value pair")
-	fmt.Println("2. GET <key>          - Retrieve the value for a given key")
-	fmt.Println("3. DELETE <key>       - Delete a key-value pair")
-	fmt.Println("4. EXIT               - Exit the application")
-	fmt.Println("5. HELP               - Show this help message")
-}
-
 func InvalidCommand(cmd string) {
 	fmt.Printf("Invalid command: %s\n", cmd)
 	fmt.Println("Type 'HELP' to see the list of available commands.")
@@ -45,11 +52,45 @@ func ExitMessage() {
 	fmt.Println("Exiting the application. Goodbye!")
 }
 
+// tlsConfig builds the client TLS configuration from the CLI flags
+func tlsConfig() (*tls.Config, error) {
+	cfg := &tls.Config{ServerName: host}
+
+	if caCert != "" {
+		pem, err := os.ReadFile(caCert)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caCert)
+		}
+		cfg.RootCAs = pool
+	}
+
+	// Client certificate for servers that require mutual TLS
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+// serverAddr returns the address the CLI connects to
+func serverAddr() string {
+	if socket != "" {
+		return socket
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
 func establishConnection() error {
-	var err error
-	fmt.Printf("Connecting to %s:%d... ", host, port)
-	conn, err = net.Dial("tcp", fmt.Sprintf("%s:%d", host, port))
-	if err != nil {
+	fmt.Printf("Connecting to %s... ", serverAddr())
+	if err := connect(); err != nil {
 		fmt.Println("Failed!")
 		return err
 	}
@@ -57,47 +98,124 @@ func establishConnection() error {
 	return nil
 }
 
+// connect dials the server without printing anything
+func connect() error {
+	c, err := dial()
+	if err != nil {
+		return err
+	}
+	conn = c
+	reader = bufio.NewReader(conn)
+	return nil
+}
+
+// dial opens a new connection to the server selected by the flags
+func dial() (net.Conn, error) {
+	if socket != "" {
+		return net.Dial("unix", socket)
+	}
+	if useTLS {
+		cfg, err := tlsConfig()
+		if err != nil {
+			return nil, err
+		}
+		return tls.Dial("tcp", serverAddr(), cfg)
+	}
+	return net.Dial("tcp", serverAddr())
+}
+
 func closeConnection() {
 	if conn != nil {
 		conn.Close()
 	}
 }
 
-func sendCommand(cmd string) (string, error) {
+func sendCommand(cmd string) (protocol.Reply, error) {
 	if conn == nil {
-		return "", fmt.Errorf("not connected")
+		return protocol.Reply{}, fmt.Errorf("not connected")
 	}
 
 	// Send command to the server
 	_, err := fmt.Fprintf(conn, "%s\n", cmd)
 	if err != nil {
-		return "", err
+		return protocol.Reply{}, err
 	}
 
 	// Read the response
-	response, err := bufio.NewReader(conn).ReadString('\n')
-	if err != nil {
-		return "", err
+	return protocol.ReadReply(reader)
+}
+
+func isSubscribeCommand(input string) bool {
+	fields := strings.Fields(input)
+	if len(fields) == 0 {
+		return false
+	}
+	cmd := strings.ToUpper(fields[0])
+	return cmd == "SUBSCRIBE" || cmd == "PSUBSCRIBE" || cmd == "MONITOR"
+}
+
+// streamMessages sends a subscribe command and passes every reply pushed
+// by the server to print until the connection is closed
+func streamMessages(cmd string, print func(protocol.Reply)) error {
+	if conn == nil {
+		return fmt.Errorf("not connected")
+	}
+
+	if _, err := fmt.Fprintf(conn, "%s\n", cmd); err != nil {
+		return err
+	}
+
+	for {
+		reply, err := protocol.ReadReply(reader)
+		if err != nil {
+			return err
+		}
+		print(reply)
 	}
+}
 
-	return strings.TrimSpace(response), nil
+// historyFile is where the shell keeps command history between sessions
+func historyFile() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".kvstore_history")
 }
 
 func startInteractiveShell() {
-	reader := bufio.NewReader(os.Stdin)
+	docs := serverDocs()
+	comp := newCompleter(docs)
+	editor := newLineEditor(historyFile())
+	editor.complete = comp.complete
+	editor.hint = comp.hint
 
+	// db is the database selected on the connection, shown in the prompt
+	db := 0
 	for {
-		fmt.Print("kv> ")
-		input, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Println("Error reading input:", err)
+		prompt := "kv> "
+		if db != 0 {
+			prompt = fmt.Sprintf("kv[%d]> ", db)
+		}
+		input, err := editor.readLine(prompt)
+		if err == errInterrupted {
+			// Ctrl-C only discards the line being typed
 			continue
 		}
+		if err != nil {
+			ExitMessage()
+			break
+		}
 
 		input = strings.TrimSpace(input)
 		if input == "" {
 			continue
 		}
+		fields := strings.Fields(input)
+		// Commands carrying passwords are kept out of the history
+		if !protocol.IsSecret(fields[0]) {
+			editor.addHistory(input)
+		}
 
 		// Handle exit command locally
 		if strings.ToUpper(input) == "EXIT" {
@@ -106,11 +224,27 @@ func startInteractiveShell() {
 		}
 
 		// Handle help command locally
-		if strings.ToUpper(input) == "HELP" {
-			Help()
+		if strings.ToUpper(fields[0]) == "HELP" {
+			if len(fields) > 1 {
+				HelpCommand(docs, strings.Join(fields[1:], " "))
+			} else {
+				Help(docs)
+			}
 			continue
 		}
 
+		// Subscriptions turn the connection into a message stream
+		if isSubscribeCommand(input) {
+			fmt.Println("Reading messages... (press Ctrl-C to quit)")
+			err := streamMessages(input, func(reply protocol.Reply) {
+				fmt.Println(formatReply(reply))
+			})
+			if err != nil {
+				fmt.Printf("Error: %v\n", err)
+			}
+			break
+		}
+
 		// Send all other commands to the server
 		response, err := sendCommand(input)
 		if err != nil {
@@ -119,18 +253,36 @@ func startInteractiveShell() {
 			if err := establishConnection(); err != nil {
 				fmt.Printf("Reconnection failed: %v\n", err)
 			}
+			db = 0
 			continue
 		}
+		if strings.ToUpper(fields[0]) == "SELECT" && !response.IsError() {
+			db, _ = strconv.Atoi(fields[1])
+		}
 
-		fmt.Println(response)
+		fmt.Println(formatReply(response))
 	}
 }
 
 var rootCmd = &cobra.Command{
-	Use:   "kvstore",
+	Use:   "kvstore [command [arg...]]",
 	Short: "In-Memory Key-Value Store CLI",
-	Long:  "In-memory key-value store interactive shell",
+	Long: `In-memory key-value store interactive shell.
+
+Given a command as arguments, kvstore runs it and exits. With --file, or
+when stdin is not a terminal, it runs one command per input line instead.
+With --pipe it streams the commands on stdin without waiting for each
+reply, for bulk loading. The exit code is 1 if any command got an error
+reply and 2 if the server could not be reached.`,
+	Args: cobra.ArbitraryArgs,
 	Run: func(cmd *cobra.Command, args []string) {
+		if pipeMode {
+			os.Exit(runPipe())
+		}
+		if len(args) > 0 || inputFile != "" || !stdinIsTerminal() {
+			os.Exit(runBatch(args))
+		}
+
 		Banner()
 
 		// Establish connection to the server
@@ -140,8 +292,12 @@ var rootCmd = &cobra.Command{
 		}
 		defer closeConnection()
 
-		fmt.Printf("Connected to KV Store server at %s:%d\n", host, port)
-		Help()
+		if socket != "" {
+			fmt.Printf("Connected to KV Store server at %s\n", socket)
+		} else {
+			fmt.Printf("Connected to KV Store server at %s:%d\n", host, port)
+		}
+		fmt.Println("Type HELP for the list of commands, HELP <command> for details.")
 
 		// Start interactive shell
 		startInteractiveShell()
@@ -149,8 +305,23 @@ var rootCmd = &cobra.Command{
 }
 
 func init() {
-	rootCmd.Flags().StringVarP(&host, "host", "H", DEFAULT_HOST, "Server hostname")
-	rootCmd.Flags().IntVarP(&port, "port", "p", DEFAULT_PORT, "Server port")
+	// Connection flags are shared with the subcommands
+	rootCmd.PersistentFlags().StringVarP(&host, "host", "H", DEFAULT_HOST, "Server hostname")
+	rootCmd.PersistentFlags().IntVarP(&port, "port", "p", DEFAULT_PORT, "Server port")
+	rootCmd.PersistentFlags().StringVarP(&socket, "socket", "s", "", "Server Unix socket path (overrides host and port)")
+	rootCmd.PersistentFlags().BoolVar(&useTLS, "tls", false, "Connect using TLS")
+	rootCmd.PersistentFlags().StringVar(&caCert, "cacert", "", "CA certificate to verify the server")
+	rootCmd.PersistentFlags().StringVar(&certFile, "cert", "", "Client certificate for mutual TLS")
+	rootCmd.PersistentFlags().StringVar(&keyFile, "key", "", "Client private key for mutual TLS")
+	rootCmd.Flags().StringVarP(&inputFile, "file", "f", "", "Run the commands in this file, one per line")
+	rootCmd.Flags().BoolVar(&rawOutput, "raw", false, "Print replies without quotes or type annotations")
+	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print each reply as a line of JSON")
+	rootCmd.Flags().BoolVar(&pipeMode, "pipe", false, "Stream commands from stdin without waiting for replies (bulk loading)")
+	rootCmd.MarkFlagsMutuallyExclusive("raw", "json")
+	rootCmd.MarkFlagsMutuallyExclusive("pipe", "file")
+
+	// Everything after the command name belongs to the command
+	rootCmd.Flags().SetInterspersed(false)
 }
 
 func main() {
@@ -0,0 +1,129 @@
+package main
+
+import "strings"
+
+// completer completes command names and subcommands and hints at the
+// arguments still to be typed
+type completer struct {
+	commands    []string            // sorted command names
+	subcommands map[string][]string // sorted subcommands by command
+
+	// syntax gives the arguments shown as hints, keyed by command or by
+	// "COMMAND SUBCOMMAND" for commands with subcommands
+	syntax map[string]string
+}
+
+// newCompleter builds a completer for the commands documented in docs
+func newCompleter(docs []commandDoc) *completer {
+	c := &completer{
+		subcommands: make(map[string][]string),
+		syntax:      make(map[string]string),
+	}
+	for _, doc := range docs {
+		c.commands = append(c.commands, doc.name)
+		c.syntax[doc.name] = doc.syntax
+		for _, sub := range doc.subcommands {
+			c.subcommands[doc.name] = append(c.subcommands[doc.name], strings.TrimPrefix(sub.name, doc.name+" "))
+			c.syntax[sub.name] = sub.syntax
+		}
+	}
+	return c
+}
+
+// complete returns the completions of line: command names for the first
+// word and subcommands for the second. Completions keep the case of what
+// was typed.
+func (c *completer) complete(line string) []string {
+	fields := strings.Fields(line)
+	typing := len(fields) == 0 || !strings.HasSuffix(line, " ")
+
+	var prefix string
+	var options []string
+	switch {
+	case len(fields) <= 1 && typing:
+		if len(fields) == 1 {
+			prefix = fields[0]
+		}
+		options = c.commands
+	case len(fields) == 1 || (len(fields) == 2 && typing):
+		if len(fields) == 2 {
+			prefix = fields[1]
+		}
+		options = c.subcommands[strings.ToUpper(fields[0])]
+	default:
+		return nil
+	}
+
+	lower := prefix != "" && prefix == strings.ToLower(prefix)
+	head := line[:len(line)-len(prefix)]
+
+	var candidates []string
+	for _, opt := range options {
+		if !strings.HasPrefix(opt, strings.ToUpper(prefix)) {
+			continue
+		}
+		if lower {
+			opt = strings.ToLower(opt)
+		}
+		candidates = append(candidates, head+opt)
+	}
+	return candidates
+}
+
+// hint returns the arguments not yet typed once the command name (and
+// subcommand, if it has them) is followed by a space
+func (c *completer) hint(line string) string {
+	if !strings.HasSuffix(line, " ") {
+		return ""
+	}
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	cmd := strings.ToUpper(fields[0])
+	syntax, ok := c.syntax[cmd]
+	typed := len(fields) - 1
+	if _, hasSubs := c.subcommands[cmd]; hasSubs {
+		if len(fields) < 2 {
+			return strings.Join(c.subcommands[cmd], "|")
+		}
+		syntax, ok = c.syntax[cmd+" "+strings.ToUpper(fields[1])]
+		typed--
+	}
+	if !ok {
+		return ""
+	}
+
+	args := syntaxArgs(syntax)
+	if typed >= len(args) {
+		return ""
+	}
+	return strings.Join(args[typed:], " ")
+}
+
+// syntaxArgs splits an argument syntax into arguments, keeping bracketed
+// optional groups together
+func syntaxArgs(syntax string) []string {
+	var args []string
+	depth, start := 0, 0
+	for i, r := range syntax {
+		switch r {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case ' ':
+			if depth == 0 {
+				if i > start {
+					args = append(args, syntax[start:i])
+				}
+				start = i + 1
+			}
+		}
+	}
+	if start < len(syntax) {
+		args = append(args, syntax[start:])
+	}
+	return args
+}
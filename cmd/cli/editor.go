@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Keys handled by the line editor
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyCtrlH     = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyEnter     = 13
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyBackspace = 127
+)
+
+// maxHistory is the number of lines kept in the history file
+const maxHistory = 1000
+
+// errInterrupted is returned by readLine when Ctrl-C cancels the line
+var errInterrupted = errors.New("interrupted")
+
+// lineEditor reads lines from the terminal with cursor movement,
+// persistent history, tab completion and inline hints
+type lineEditor struct {
+	in  *bufio.Reader
+	out io.Writer
+
+	history     []string
+	historyFile string
+
+	// complete returns the lines the line typed so far can be completed to
+	complete func(line string) []string
+
+	// hint returns text shown dimmed after the line, such as the
+	// remaining arguments of the command being typed
+	hint func(line string) string
+}
+
+// editState is the line being edited
+type editState struct {
+	prompt string
+	buf    []rune
+	pos    int
+
+	// histIdx is the history entry shown, len(history) for the new line,
+	// which is kept in saved while browsing
+	histIdx int
+	saved   []rune
+}
+
+// newLineEditor creates an editor reading stdin, with history loaded
+// from and saved to historyFile ("" keeps it in memory only)
+func newLineEditor(historyFile string) *lineEditor {
+	ed := &lineEditor{
+		in:          bufio.NewReader(os.Stdin),
+		out:         os.Stdout,
+		historyFile: historyFile,
+	}
+	ed.loadHistory()
+	return ed
+}
+
+// readLine prompts for a line. It returns errInterrupted on Ctrl-C and
+// io.EOF on Ctrl-D at an empty line. If the terminal can't be put in raw
+// mode it reads a plain line instead.
+func (ed *lineEditor) readLine(prompt string) (string, error) {
+	restore, err := enableRawMode(int(os.Stdin.Fd()))
+	if err != nil {
+		fmt.Fprint(ed.out, prompt)
+		line, err := ed.in.ReadString('\n')
+		if err != nil && line == "" {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	defer restore()
+
+	st := &editState{prompt: prompt, histIdx: len(ed.history)}
+	ed.refresh(st, true)
+	for {
+		r, _, err := ed.in.ReadRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case keyEnter, '\n':
+			st.pos = len(st.buf)
+			ed.refresh(st, false)
+			fmt.Fprint(ed.out, "\r\n")
+			return string(st.buf), nil
+		case keyCtrlC:
+			fmt.Fprint(ed.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(st.buf) == 0 {
+				fmt.Fprint(ed.out, "\r\n")
+				return "", io.EOF
+			}
+			st.delete(st.pos)
+		case keyBackspace, keyCtrlH:
+			if st.pos > 0 {
+				st.pos--
+				st.delete(st.pos)
+			}
+		case keyTab:
+			ed.completeLine(st)
+		case keyCtrlA:
+			st.pos = 0
+		case keyCtrlE:
+			st.pos = len(st.buf)
+		case keyCtrlB:
+			st.pos = max(st.pos-1, 0)
+		case keyCtrlF:
+			st.pos = min(st.pos+1, len(st.buf))
+		case keyCtrlK:
+			st.buf = st.buf[:st.pos]
+		case keyCtrlU:
+			st.buf = append([]rune(nil), st.buf[st.pos:]...)
+			st.pos = 0
+		case keyCtrlW:
+			st.deleteWord()
+		case keyCtrlL:
+			fmt.Fprint(ed.out, "\x1b[H\x1b[2J")
+		case keyCtrlP:
+			ed.browseHistory(st, -1)
+		case keyCtrlN:
+			ed.browseHistory(st, 1)
+		case keyEscape:
+			ed.escapeSequence(st)
+		default:
+			if unicode.IsPrint(r) {
+				st.insert(r)
+			}
+		}
+		ed.refresh(st, true)
+	}
+}
+
+// escapeSequence handles the arrow, home, end and delete keys
+func (ed *lineEditor) escapeSequence(st *editState) {
+	if b, err := ed.in.ReadByte(); err != nil || (b != '[' && b != 'O') {
+		return
+	}
+	b, err := ed.in.ReadByte()
+	if err != nil {
+		return
+	}
+
+	// Sequences such as ESC [ 3 ~ carry a number
+	if b >= '0' && b <= '9' {
+		n := b
+		for b != '~' {
+			if b, err = ed.in.ReadByte(); err != nil {
+				return
+			}
+		}
+		switch n {
+		case '1', '7':
+			st.pos = 0
+		case '4', '8':
+			st.pos = len(st.buf)
+		case '3':
+			st.delete(st.pos)
+		}
+		return
+	}
+
+	switch b {
+	case 'A':
+		ed.browseHistory(st, -1)
+	case 'B':
+		ed.browseHistory(st, 1)
+	case 'C':
+		st.pos = min(st.pos+1, len(st.buf))
+	case 'D':
+		st.pos = max(st.pos-1, 0)
+	case 'H':
+		st.pos = 0
+	case 'F':
+		st.pos = len(st.buf)
+	}
+}
+
+// refresh redraws the prompt and line, with the hint if the cursor is at
+// the end, and puts the cursor back in place
+func (ed *lineEditor) refresh(st *editState, showHint bool) {
+	var b strings.Builder
+	b.WriteString("\r")
+	b.WriteString(st.prompt)
+	b.WriteString(string(st.buf))
+	if showHint && ed.hint != nil && st.pos == len(st.buf) {
+		if hint := ed.hint(string(st.buf)); hint != "" {
+			b.WriteString("\x1b[90m" + hint + "\x1b[0m")
+		}
+	}
+	b.WriteString("\x1b[0K\r")
+	if col := utf8.RuneCountInString(st.prompt) + st.pos; col > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", col)
+	}
+	io.WriteString(ed.out, b.String())
+}
+
+// completeLine completes a single candidate, extends the line to the
+// candidates' common prefix or else lists them
+func (ed *lineEditor) completeLine(st *editState) {
+	if ed.complete == nil {
+		return
+	}
+
+	line := string(st.buf)
+	candidates := ed.complete(line)
+	switch len(candidates) {
+	case 0:
+		fmt.Fprint(ed.out, "\a")
+		return
+	case 1:
+		line = candidates[0] + " "
+	default:
+		prefix := commonPrefix(candidates)
+		if len(prefix) <= len(line) {
+			fmt.Fprintf(ed.out, "\r\n%s\r\n", strings.Join(candidates, "  "))
+			return
+		}
+		line = prefix
+	}
+	st.buf = []rune(line)
+	st.pos = len(st.buf)
+}
+
+// browseHistory moves delta entries through the history
+func (ed *lineEditor) browseHistory(st *editState, delta int) {
+	idx := st.histIdx + delta
+	if idx < 0 || idx > len(ed.history) {
+		return
+	}
+
+	if st.histIdx == len(ed.history) {
+		st.saved = st.buf
+	}
+	st.histIdx = idx
+	if idx == len(ed.history) {
+		st.buf = st.saved
+	} else {
+		st.buf = []rune(ed.history[idx])
+	}
+	st.pos = len(st.buf)
+}
+
+// addHistory records a line and appends it to the history file
+func (ed *lineEditor) addHistory(line string) {
+	if line == "" || (len(ed.history) > 0 && ed.history[len(ed.history)-1] == line) {
+		return
+	}
+	ed.history = append(ed.history, line)
+	if len(ed.history) > maxHistory {
+		ed.history = ed.history[len(ed.history)-maxHistory:]
+	}
+
+	if ed.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(ed.historyFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	fmt.Fprintln(f, line)
+}
+
+// loadHistory reads the history file, trimming it to maxHistory lines
+func (ed *lineEditor) loadHistory() {
+	if ed.historyFile == "" {
+		return
+	}
+	data, err := os.ReadFile(ed.historyFile)
+	if err != nil {
+		return
+	}
+
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+		os.WriteFile(ed.historyFile, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	}
+	for _, line := range lines {
+		if line != "" {
+			ed.history = append(ed.history, line)
+		}
+	}
+}
+
+func (st *editState) insert(r rune) {
+	st.buf = append(st.buf, 0)
+	copy(st.buf[st.pos+1:], st.buf[st.pos:])
+	st.buf[st.pos] = r
+	st.pos++
+}
+
+// delete removes the rune at i, if any
+func (st *editState) delete(i int) {
+	if i < len(st.buf) {
+		st.buf = append(st.buf[:i], st.buf[i+1:]...)
+	}
+}
+
+// deleteWord removes the word before the cursor
+func (st *editState) deleteWord() {
+	start := st.pos
+	for start > 0 && st.buf[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && st.buf[start-1] != ' ' {
+		start--
+	}
+	st.buf = append(st.buf[:start], st.buf[st.pos:]...)
+	st.pos = start
+}
+
+func commonPrefix(strs []string) string {
+	prefix := strs[0]
+	for _, s := range strs[1:] {
+		for !strings.HasPrefix(s, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+	return prefix
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"memkv/internal/protocol"
+)
+
+// formatReply renders a reply for the terminal: strings quoted, integers
+// and errors tagged, and arrays as numbered lists with nested elements
+// indented under their number
+func formatReply(r protocol.Reply) string {
+	switch r.Type {
+	case protocol.StatusType:
+		return r.Str
+	case protocol.ErrorType:
+		return "(error) " + r.Str
+	case protocol.IntegerType:
+		return "(integer) " + strconv.FormatInt(r.Int, 10)
+	case protocol.NilType:
+		return "(nil)"
+	case protocol.BulkType:
+		// Multi-line text such as INFO reads better unquoted
+		if strings.Contains(r.Str, "\n") {
+			return r.Str
+		}
+		return strconv.Quote(r.Str)
+	case protocol.ArrayType:
+		if len(r.Elems) == 0 {
+			return "(empty array)"
+		}
+
+		width := len(strconv.Itoa(len(r.Elems)))
+		var b strings.Builder
+		for i, elem := range r.Elems {
+			prefix := fmt.Sprintf("%*d) ", width, i+1)
+			for j, line := range strings.Split(formatReply(elem), "\n") {
+				if i > 0 || j > 0 {
+					b.WriteByte('\n')
+				}
+				if j == 0 {
+					b.WriteString(prefix)
+				} else {
+					b.WriteString(strings.Repeat(" ", len(prefix)))
+				}
+				b.WriteString(line)
+			}
+		}
+		return b.String()
+	default:
+		return r.String()
+	}
+}
+
+// formatRaw renders a reply the way scripts want it: strings as is,
+// integers in decimal, nil as an empty line and array elements on
+// separate lines
+func formatRaw(r protocol.Reply) string {
+	switch r.Type {
+	case protocol.NilType:
+		return ""
+	case protocol.ArrayType:
+		lines := make([]string, len(r.Elems))
+		for i, elem := range r.Elems {
+			lines[i] = formatRaw(elem)
+		}
+		return strings.Join(lines, "\n")
+	default:
+		return r.String()
+	}
+}
+
+// jsonValue converts a reply to a value encoding/json renders naturally.
+// Errors become {"error": msg} so they can't be mistaken for strings.
+func jsonValue(r protocol.Reply) any {
+	switch r.Type {
+	case protocol.StatusType, protocol.BulkType:
+		return r.Str
+	case protocol.ErrorType:
+		return map[string]string{"error": r.Str}
+	case protocol.IntegerType:
+		return r.Int
+	case protocol.ArrayType:
+		values := make([]any, len(r.Elems))
+		for i, elem := range r.Elems {
+			values[i] = jsonValue(elem)
+		}
+		return values
+	default:
+		return nil
+	}
+}
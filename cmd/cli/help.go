@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"memkv/internal/protocol"
+)
+
+// commandDoc is a command's entry in the server's COMMAND DOCS reply
+type commandDoc struct {
+	name    string // upper case, "CLIENT LIST" for subcommands
+	summary string
+	group   string
+	syntax  string
+
+	subcommands []commandDoc
+}
+
+// serverDocs asks the server to document its commands. It returns nil
+// if the server can't be queried.
+func serverDocs() []commandDoc {
+	reply, err := sendCommand("COMMAND DOCS")
+	if err != nil || reply.Type != protocol.ArrayType {
+		return nil
+	}
+	return parseDocs(reply)
+}
+
+// parseDocs decodes the name/docs pairs of COMMAND DOCS, sorted by name
+func parseDocs(reply protocol.Reply) []commandDoc {
+	var docs []commandDoc
+	for i := 0; i+1 < len(reply.Elems); i += 2 {
+		doc := commandDoc{
+			name: strings.ToUpper(strings.ReplaceAll(reply.Elems[i].Str, "|", " ")),
+		}
+		fields := reply.Elems[i+1].Elems
+		for j := 0; j+1 < len(fields); j += 2 {
+			value := fields[j+1]
+			switch fields[j].Str {
+			case "summary":
+				doc.summary = value.Str
+			case "group":
+				doc.group = value.Str
+			case "syntax":
+				doc.syntax = value.Str
+			case "subcommands":
+				doc.subcommands = parseDocs(value)
+			}
+		}
+		docs = append(docs, doc)
+	}
+	sort.Slice(docs, func(i, j int) bool { return docs[i].name < docs[j].name })
+	return docs
+}
+
+// usage renders the command line a command expects
+func (d commandDoc) usage() string {
+	if d.syntax == "" {
+		return d.name
+	}
+	return d.name + " " + d.syntax
+}
+
+// Help lists the server's commands by group
+func Help(docs []commandDoc) {
+	if len(docs) == 0 {
+		fmt.Println("The server did not describe its commands.")
+		return
+	}
+
+	groups := make(map[string][]commandDoc)
+	var names []string
+	for _, doc := range docs {
+		if _, ok := groups[doc.group]; !ok {
+			names = append(names, doc.group)
+		}
+		groups[doc.group] = append(groups[doc.group], doc)
+	}
+	sort.Strings(names)
+
+	for _, group := range names {
+		fmt.Printf("%s:\n", group)
+		for _, doc := range groups[group] {
+			fmt.Printf("  %-14s %s\n", doc.name, doc.summary)
+		}
+	}
+	fmt.Println("EXIT to quit, HELP <command> for details.")
+}
+
+// HelpCommand describes a command and its subcommands, or a single
+// subcommand given as "CLIENT LIST"
+func HelpCommand(docs []commandDoc, name string) {
+	name = strings.ToUpper(name)
+	for _, doc := range docs {
+		if doc.name == name {
+			fmt.Printf("  %s\n  summary: %s\n  group: %s\n", doc.usage(), doc.summary, doc.group)
+			for _, sub := range doc.subcommands {
+				fmt.Printf("\n  %s\n  summary: %s\n", sub.usage(), sub.summary)
+			}
+			return
+		}
+		for _, sub := range doc.subcommands {
+			if sub.name == name {
+				fmt.Printf("  %s\n  summary: %s\n  group: %s\n", sub.usage(), sub.summary, doc.group)
+				return
+			}
+		}
+	}
+	InvalidCommand(name)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"memkv/internal/protocol"
+)
+
+// pipeWriteBuffer is how much command data is batched per socket write
+const pipeWriteBuffer = 64 * 1024
+
+var pipeMode bool
+
+// pipeStats counts the replies read back in pipe mode
+type pipeStats struct {
+	mu      sync.Mutex
+	sent    int64 // commands written, -1 until stdin is exhausted
+	replies int64
+	errors  int64
+}
+
+// done reports whether every command sent has been answered. The caller
+// must hold s.mu.
+func (s *pipeStats) done() bool {
+	return s.sent >= 0 && s.replies >= s.sent
+}
+
+// runPipe streams commands from stdin to the server without waiting for
+// their replies, which are read concurrently and only counted. It prints
+// a summary and returns the exit code.
+func runPipe() int {
+	if err := connect(); err != nil {
+		fmt.Fprintf(os.Stderr, "Could not connect to %s: %v\n", serverAddr(), err)
+		return exitIOError
+	}
+	defer closeConnection()
+
+	start := time.Now()
+	stats := &pipeStats{sent: -1}
+	readDone := make(chan error, 1)
+	go func() {
+		readDone <- readPipeReplies(stats)
+	}()
+
+	sent, err := writePipeCommands()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		return exitIOError
+	}
+	fmt.Fprintf(os.Stderr, "All data transferred. Waiting for the last reply...\n")
+
+	stats.mu.Lock()
+	stats.sent = sent
+	finished := stats.done()
+	stats.mu.Unlock()
+
+	if !finished {
+		if err := <-readDone; err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			return exitIOError
+		}
+	}
+
+	stats.mu.Lock()
+	defer stats.mu.Unlock()
+	fmt.Fprintf(os.Stderr, "Last reply received from server.\n")
+	fmt.Fprintf(os.Stderr, "commands: %d, replies: %d, errors: %d, elapsed: %v\n",
+		stats.sent, stats.replies, stats.errors, time.Since(start).Round(time.Millisecond))
+	if stats.errors > 0 {
+		return exitErrorReply
+	}
+	return exitOK
+}
+
+// writePipeCommands copies the non-empty lines of stdin to the server and
+// returns how many commands were sent
+func writePipeCommands() (int64, error) {
+	w := bufio.NewWriterSize(conn, pipeWriteBuffer)
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), maxInputLine)
+
+	// Blank lines get no reply from the server, so they are not sent
+	var sent int64
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		w.Write(line)
+		if err := w.WriteByte('\n'); err != nil {
+			return sent, err
+		}
+		sent++
+	}
+	if err := scanner.Err(); err != nil {
+		return sent, fmt.Errorf("reading input: %w", err)
+	}
+	return sent, w.Flush()
+}
+
+// readPipeReplies counts replies until every command sent is answered,
+// printing error replies as they arrive
+func readPipeReplies(stats *pipeStats) error {
+	for {
+		reply, err := protocol.ReadReply(reader)
+		if err != nil {
+			return err
+		}
+		if reply.IsError() {
+			fmt.Fprintln(os.Stderr, reply.Str)
+		}
+
+		stats.mu.Lock()
+		stats.replies++
+		if reply.IsError() {
+			stats.errors++
+		}
+		finished := stats.done()
+		stats.mu.Unlock()
+
+		if finished {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,27 @@
+//go:build darwin || linux
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// enableRawMode switches the terminal on fd to raw mode, so keys arrive
+// one at a time without echo and Ctrl-C is read as a byte instead of
+// raising SIGINT. It returns a function restoring the previous mode.
+func enableRawMode(fd int) (func(), error) {
+	old, err := unix.IoctlGetTermios(fd, ioctlGetTermios)
+	if err != nil {
+		return nil, err
+	}
+
+	raw := *old
+	raw.Iflag &^= unix.BRKINT | unix.ICRNL | unix.INPCK | unix.ISTRIP | unix.IXON
+	raw.Cflag |= unix.CS8
+	raw.Lflag &^= unix.ECHO | unix.ICANON | unix.IEXTEN | unix.ISIG
+	raw.Cc[unix.VMIN] = 1
+	raw.Cc[unix.VTIME] = 0
+	if err := unix.IoctlSetTermios(fd, ioctlSetTermios, &raw); err != nil {
+		return nil, err
+	}
+
+	return func() { unix.IoctlSetTermios(fd, ioctlSetTermios, old) }, nil
+}
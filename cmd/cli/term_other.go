@@ -0,0 +1,11 @@
+//go:build !darwin && !linux
+
+package main
+
+import "errors"
+
+// enableRawMode is not supported here; the shell falls back to reading
+// plain lines
+func enableRawMode(fd int) (func(), error) {
+	return nil, errors.New("raw terminal mode not supported")
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
 
+	"memkv/internal/config"
+	"memkv/internal/executor"
 	"memkv/internal/logger"
+	"memkv/internal/metrics"
 	"memkv/internal/server"
 )
 
@@ -13,23 +22,93 @@ func main() {
 	// Initialize logger
 	logger.SetDefaultLevel(logger.INFO)
 
+	// Create server configuration
+	cfg := server.Config{}
+	var replicaOf, socketPerm, metricsAddr, configFile, logLevel string
+	var timeout int64
+
+	flag.StringVar(&configFile, "config", "", "Config file of \"name value\" lines using the flag names below")
+	flag.StringVar(&logLevel, "loglevel", "info", "Log level: debug, info, warn or error")
+	flag.IntVar(&cfg.Port, "port", 6178, "Port to listen on (0 disables TCP, e.g. to serve only TLS)")
+	flag.StringVar(&cfg.UnixSocket, "unixsocket", "", "Path of a Unix domain socket to listen on")
+	flag.StringVar(&socketPerm, "unixsocketperm", "700", "Permissions of the Unix socket (octal)")
+	flag.StringVar(&cfg.WALPath, "wal", "/tmp/wal.log", "Path of the write-ahead log")
+	flag.StringVar(&cfg.NotifyKeyspaceEvents, "notify-keyspace-events", "", "Keyspace notification classes (K, E, g, $, x, e, A)")
+	flag.StringVar(&replicaOf, "replicaof", "", "Replicate from the leader at host:port")
+	flag.StringVar(&cfg.MasterUser, "masteruser", "", "User to authenticate as with the leader (default user if empty)")
+	flag.StringVar(&cfg.MasterAuth, "masterauth", "", "Password to authenticate with the leader")
+	flag.StringVar(&cfg.RaftID, "raft-id", "", "Raft node ID (enables Raft replication)")
+	flag.StringVar(&cfg.RaftAddr, "raft-addr", "127.0.0.1:7178", "Address for Raft RPCs")
+	flag.StringVar(&cfg.RaftPeers, "raft-peers", "", "Initial Raft members as id=host:port,...")
+	flag.BoolVar(&cfg.ClusterEnabled, "cluster", false, "Enable hash-slot cluster mode")
+	flag.StringVar(&cfg.ClusterNodeID, "cluster-id", "", "Cluster node ID (generated if empty)")
+	flag.StringVar(&cfg.ClusterAnnounceAddr, "cluster-announce", "", "Address announced in redirects (default 127.0.0.1:<port>)")
+	flag.StringVar(&cfg.ClusterConfigFile, "cluster-config-file", "nodes.conf", "File the cluster nodes and slots are saved to")
+	flag.Int64Var(&cfg.MaxMemory, "maxmemory", 0, "Memory limit in bytes (0 = unlimited)")
+	flag.StringVar(&cfg.MaxMemoryPolicy, "maxmemory-policy", "noeviction", "Eviction policy: noeviction, allkeys-lru, allkeys-lfu, allkeys-random, volatile-lru, volatile-ttl")
+	flag.StringVar(&cfg.ACLFile, "aclfile", "", "ACL file with users to load at startup")
+	flag.StringVar(&cfg.RequirePass, "requirepass", "", "Password required for the default user")
+	flag.IntVar(&cfg.TLSPort, "tls-port", 0, "Port for TLS connections (0 = disabled)")
+	flag.StringVar(&cfg.TLSCertFile, "tls-cert", "", "TLS certificate file")
+	flag.StringVar(&cfg.TLSKeyFile, "tls-key", "", "TLS private key file")
+	flag.StringVar(&cfg.TLSCACertFile, "tls-ca-cert", "", "CA certificate for verifying clients (enables mTLS)")
+	flag.StringVar(&cfg.TLSMinVersion, "tls-min-version", "1.2", "Minimum TLS version (1.2 or 1.3)")
+	flag.BoolVar(&cfg.TLSInterNode, "tls-internode", false, "Use TLS for replication, Raft RPCs and MIGRATE (peers are dialed on their TLS ports)")
+	flag.Int64Var(&cfg.SlowlogLogSlowerThan, "slowlog-log-slower-than", executor.DefaultSlowlogThreshold, "Log commands slower than this many microseconds (negative disables)")
+	flag.IntVar(&cfg.SlowlogMaxLen, "slowlog-max-len", executor.DefaultSlowlogMaxLen, "Number of slow log entries kept")
+	flag.StringVar(&cfg.AppendFsync, "appendfsync", "always", "WAL fsync policy: always, everysec or no")
+	flag.IntVar(&cfg.PubSubOutputLimit, "client-output-buffer-limit-pubsub", 0, "Disconnect subscribers and monitors with more unread output than this many bytes (0 = 32MB default, negative = unlimited)")
+	flag.Int64Var(&timeout, "timeout", 0, "Close clients idle for this many seconds (0 disables)")
+	flag.StringVar(&metricsAddr, "metrics-addr", "", "Serve Prometheus metrics at http://<addr>/metrics (disabled if empty)")
+	flag.Parse()
+
+	if configFile != "" {
+		if err := loadConfigFile(configFile); err != nil {
+			logger.Fatal("Failed to load config: %v", err)
+		}
+		cfg.ConfigFile = configFile
+	}
+
+	level, err := logger.ParseLevel(logLevel)
+	if err != nil {
+		logger.Fatal("Invalid -loglevel: %v", err)
+	}
+	logger.SetDefaultLevel(level)
+	cfg.Timeout = time.Duration(timeout) * time.Second
+
+	perm, err := strconv.ParseUint(socketPerm, 8, 32)
+	if err != nil {
+		logger.Fatal("Invalid -unixsocketperm: %v", err)
+	}
+	cfg.UnixSocketPerm = os.FileMode(perm)
+
+	if replicaOf != "" {
+		host, port, err := net.SplitHostPort(replicaOf)
+		if err != nil {
+			logger.Fatal("Invalid -replicaof address: %v", err)
+		}
+		cfg.ReplicaOfHost = host
+		if cfg.ReplicaOfPort, err = strconv.Atoi(port); err != nil {
+			logger.Fatal("Invalid -replicaof port: %v", err)
+		}
+	}
+
 	// Print startup message
 	logger.Info("========================================")
 	logger.Info("  KV-Store Server v1.0")
 	logger.Info("========================================")
 
-	// Create server configuration
-	cfg := server.Config{
-		Port:    6178,
-		WALPath: "/tmp/wal.log",
-	}
-
 	// Create server
 	srv, err := server.New(cfg)
 	if err != nil {
 		logger.Fatal("Failed to create server: %v", err)
 	}
 
+	// Serve metrics on their own goroutine, away from the event loop
+	if metricsAddr != "" {
+		go serveMetrics(metricsAddr)
+	}
+
 	// Setup graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
@@ -43,10 +122,48 @@ func main() {
 	}()
 
 	// Start server
-	logger.Info("Server ready on port %d", cfg.Port)
+	if cfg.Port > 0 {
+		logger.Info("Server ready on port %d", cfg.Port)
+	}
 	logger.Info("Press Ctrl+C to stop")
 
 	if err := srv.Start(); err != nil {
 		logger.Fatal("Server error: %v", err)
 	}
 }
+
+// loadConfigFile applies the directives of a config file as flag values.
+// Flags given on the command line take precedence over the file.
+func loadConfigFile(path string) error {
+	directives, err := config.Parse(path)
+	if err != nil {
+		return err
+	}
+
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	for _, d := range directives {
+		if d.Name == "config" {
+			return fmt.Errorf("%s:%d: config can't be nested", path, d.Line)
+		}
+		if explicit[d.Name] {
+			continue
+		}
+		if err := flag.Set(d.Name, d.Value); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, d.Line, err)
+		}
+	}
+	return nil
+}
+
+// serveMetrics exposes the Prometheus metrics endpoint
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+
+	logger.Info("Metrics available at http://%s/metrics", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		logger.Error("Metrics server error: %v", err)
+	}
+}
@@ -0,0 +1,251 @@
+package acl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// DefaultUser is the user new connections are authenticated as when it
+// is enabled and has no password
+const DefaultUser = "default"
+
+var (
+	ErrUnknownUser       = errors.New("no such user")
+	ErrCantDeleteDefault = errors.New("the 'default' user cannot be removed")
+)
+
+// commandTable maps command names to their ACL categories
+type commandTable struct {
+	commands map[string][]string
+}
+
+func (t *commandTable) has(cmd string) bool {
+	_, ok := t.commands[cmd]
+	return ok
+}
+
+func (t *commandTable) names() []string {
+	names := make([]string, 0, len(t.commands))
+	for name := range t.commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (t *commandTable) category(cat string) ([]string, bool) {
+	if cat == "all" {
+		return t.names(), true
+	}
+
+	var cmds []string
+	known := false
+	for name, cats := range t.commands {
+		for _, c := range cats {
+			if c == cat {
+				cmds = append(cmds, name)
+				known = true
+			}
+		}
+	}
+	sort.Strings(cmds)
+	return cmds, known
+}
+
+// Store holds the ACL users
+type Store struct {
+	table *commandTable
+	users map[string]*User
+	path  string
+}
+
+// New creates a store whose rules refer to commands, a map from command
+// name to its categories. It starts with an unrestricted default user.
+func New(commands map[string][]string) *Store {
+	s := &Store{
+		table: &commandTable{commands: commands},
+		users: make(map[string]*User),
+	}
+	s.users[DefaultUser] = s.defaultUser()
+	return s
+}
+
+func (s *Store) defaultUser() *User {
+	u := newUser(DefaultUser)
+	for _, rule := range []string{"on", "nopass", "~*", "+@all"} {
+		u.apply(rule, s.table)
+	}
+	return u
+}
+
+// User returns the named user
+func (s *Store) User(name string) (*User, bool) {
+	u, ok := s.users[name]
+	return u, ok
+}
+
+// Users returns all user names, sorted
+func (s *Store) Users() []string {
+	names := make([]string, 0, len(s.users))
+	for name := range s.users {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetUser creates or modifies a user. Rules are validated on a copy so a
+// bad rule leaves the user unchanged.
+func (s *Store) SetUser(name string, rules []string) error {
+	u := newUser(name)
+	if existing, ok := s.users[name]; ok {
+		u = existing.clone()
+	}
+
+	for _, rule := range rules {
+		if err := u.apply(rule, s.table); err != nil {
+			return err
+		}
+	}
+	s.users[name] = u
+	return nil
+}
+
+// DelUser removes a user
+func (s *Store) DelUser(name string) error {
+	if name == DefaultUser {
+		return ErrCantDeleteDefault
+	}
+	if _, ok := s.users[name]; !ok {
+		return ErrUnknownUser
+	}
+	delete(s.users, name)
+	return nil
+}
+
+// Authenticate returns the user if password is valid for it
+func (s *Store) Authenticate(name, password string) (*User, bool) {
+	u, ok := s.users[name]
+	if !ok || !u.CheckPassword(password) {
+		return nil, false
+	}
+	return u, true
+}
+
+// Categories returns all known command categories
+func (s *Store) Categories() []string {
+	seen := make(map[string]bool)
+	for _, cats := range s.table.commands {
+		for _, c := range cats {
+			seen[c] = true
+		}
+	}
+	cats := make([]string, 0, len(seen))
+	for c := range seen {
+		cats = append(cats, c)
+	}
+	sort.Strings(cats)
+	return cats
+}
+
+// CategoryCommands returns the commands in a category
+func (s *Store) CategoryCommands(cat string) ([]string, bool) {
+	return s.table.category(strings.ToLower(cat))
+}
+
+// Rules returns the rules that recreate the named user
+func (s *Store) Rules(name string) []string {
+	u, ok := s.users[name]
+	if !ok {
+		return nil
+	}
+	return u.rules(s.table)
+}
+
+// Describe returns a user in ACL file format
+func (s *Store) Describe(name string) string {
+	return "user " + name + " " + strings.Join(s.Rules(name), " ")
+}
+
+// LoadFile replaces all users with those defined in an ACL file. Each
+// non-empty line has the form "user <name> <rule> ...".
+func (s *Store) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open ACL file: %w", err)
+	}
+	defer file.Close()
+
+	loaded := New(s.table.commands)
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			return fmt.Errorf("%s:%d: expected 'user <name> <rules...>'", path, lineNum)
+		}
+
+		// Users in the file are defined from scratch
+		rules := append([]string{"reset"}, fields[2:]...)
+		if err := loaded.SetUser(fields[1], rules); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read ACL file: %w", err)
+	}
+
+	s.users = loaded.users
+	s.path = path
+	return nil
+}
+
+// Save writes all users to the ACL file the store was loaded from
+func (s *Store) Save() error {
+	if s.path == "" {
+		return errors.New("no ACL file configured")
+	}
+
+	var b strings.Builder
+	for _, name := range s.Users() {
+		b.WriteString(s.Describe(name) + "\n")
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(b.String()), 0600); err != nil {
+		return fmt.Errorf("failed to write ACL file: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// SetPath sets the ACL file used by Save
+func (s *Store) SetPath(path string) {
+	s.path = path
+}
+
+// Path returns the ACL file path, if any
+func (s *Store) Path() string {
+	return s.path
+}
+
+func (u *User) clone() *User {
+	c := *u
+	c.Keys = append([]string(nil), u.Keys...)
+	c.password = make(map[string]struct{}, len(u.password))
+	for h := range u.password {
+		c.password[h] = struct{}{}
+	}
+	c.commands = make(map[string]bool, len(u.commands))
+	for cmd, ok := range u.commands {
+		c.commands[cmd] = ok
+	}
+	return &c
+}
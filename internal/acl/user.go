@@ -0,0 +1,188 @@
+package acl
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"memkv/internal/glob"
+)
+
+// User is an ACL user with its credentials and permissions
+type User struct {
+	Name     string
+	Enabled  bool
+	NoPass   bool
+	AllKeys  bool
+	Keys     []string            // key glob patterns
+	password map[string]struct{} // sha256 hex digests
+	commands map[string]bool     // allowed commands (upper case)
+}
+
+func newUser(name string) *User {
+	return &User{
+		Name:     name,
+		password: make(map[string]struct{}),
+		commands: make(map[string]bool),
+	}
+}
+
+// HashPassword returns the digest stored for a password
+func HashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+// CheckPassword reports whether password authenticates the user
+func (u *User) CheckPassword(password string) bool {
+	if !u.Enabled {
+		return false
+	}
+	if u.NoPass {
+		return true
+	}
+
+	digest := HashPassword(password)
+	ok := false
+	for h := range u.password {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(digest)) == 1 {
+			ok = true
+		}
+	}
+	return ok
+}
+
+// CanRun reports whether the user may execute cmd
+func (u *User) CanRun(cmd string) bool {
+	return u.commands[strings.ToUpper(cmd)]
+}
+
+// CanAccessKey reports whether key matches one of the user's patterns
+func (u *User) CanAccessKey(key string) bool {
+	if u.AllKeys {
+		return true
+	}
+	for _, pattern := range u.Keys {
+		if glob.Match(pattern, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply applies a single ACL rule to the user
+func (u *User) apply(rule string, table *commandTable) error {
+	switch lower := strings.ToLower(rule); {
+	case lower == "on":
+		u.Enabled = true
+	case lower == "off":
+		u.Enabled = false
+	case lower == "nopass":
+		u.NoPass = true
+		u.password = make(map[string]struct{})
+	case lower == "resetpass":
+		u.NoPass = false
+		u.password = make(map[string]struct{})
+	case lower == "allkeys" || rule == "~*":
+		u.AllKeys = true
+		u.Keys = nil
+	case lower == "resetkeys":
+		u.AllKeys = false
+		u.Keys = nil
+	case lower == "allcommands" || lower == "+@all":
+		for _, cmd := range table.names() {
+			u.commands[cmd] = true
+		}
+	case lower == "nocommands" || lower == "-@all":
+		u.commands = make(map[string]bool)
+	case lower == "reset":
+		*u = *newUser(u.Name)
+	case strings.HasPrefix(rule, ">"):
+		u.password[HashPassword(rule[1:])] = struct{}{}
+		u.NoPass = false
+	case strings.HasPrefix(rule, "<"):
+		delete(u.password, HashPassword(rule[1:]))
+	case strings.HasPrefix(rule, "#"):
+		digest := strings.ToLower(rule[1:])
+		if _, err := hex.DecodeString(digest); err != nil || len(digest) != 64 {
+			return fmt.Errorf("invalid password hash '%s'", rule[1:])
+		}
+		u.password[digest] = struct{}{}
+		u.NoPass = false
+	case strings.HasPrefix(rule, "~"):
+		if !u.AllKeys {
+			u.Keys = append(u.Keys, rule[1:])
+		}
+	case strings.HasPrefix(rule, "+@"), strings.HasPrefix(rule, "-@"):
+		cmds, ok := table.category(strings.ToLower(rule[2:]))
+		if !ok {
+			return fmt.Errorf("unknown command category '%s'", rule[2:])
+		}
+		for _, cmd := range cmds {
+			u.commands[cmd] = rule[0] == '+'
+		}
+	case strings.HasPrefix(rule, "+"), strings.HasPrefix(rule, "-"):
+		cmd := strings.ToUpper(rule[1:])
+		if !table.has(cmd) {
+			return fmt.Errorf("unknown command '%s'", rule[1:])
+		}
+		u.commands[cmd] = rule[0] == '+'
+	default:
+		return fmt.Errorf("syntax error in ACL rule '%s'", rule)
+	}
+	return nil
+}
+
+// rules describes the user as a list of rules that recreate it
+func (u *User) rules(table *commandTable) []string {
+	rules := []string{"off"}
+	if u.Enabled {
+		rules[0] = "on"
+	}
+
+	if u.NoPass {
+		rules = append(rules, "nopass")
+	}
+	hashes := make([]string, 0, len(u.password))
+	for h := range u.password {
+		hashes = append(hashes, "#"+h)
+	}
+	sort.Strings(hashes)
+	rules = append(rules, hashes...)
+
+	if u.AllKeys {
+		rules = append(rules, "~*")
+	} else {
+		for _, pattern := range u.Keys {
+			rules = append(rules, "~"+pattern)
+		}
+	}
+
+	return append(rules, u.commandRules(table)...)
+}
+
+// commandRules lists allowed commands, or +@all when nothing is denied
+func (u *User) commandRules(table *commandTable) []string {
+	var allowed []string
+	for cmd, ok := range u.commands {
+		if ok {
+			allowed = append(allowed, cmd)
+		}
+	}
+	if len(allowed) == 0 {
+		return []string{"-@all"}
+	}
+	if len(allowed) == len(table.commands) {
+		return []string{"+@all"}
+	}
+	sort.Strings(allowed)
+
+	rules := make([]string, 0, len(allowed))
+	for _, cmd := range allowed {
+		rules = append(rules, "+"+strings.ToLower(cmd))
+	}
+	return rules
+}
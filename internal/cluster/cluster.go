@@ -0,0 +1,256 @@
+package cluster
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var (
+	ErrUnknownNode = errors.New("unknown node")
+	ErrInvalidSlot = errors.New("invalid slot")
+)
+
+// Node is a member of the cluster
+type Node struct {
+	ID   string
+	Addr string
+}
+
+// SlotRange is a contiguous range of slots owned by one node
+type SlotRange struct {
+	Start int
+	End   int
+	Node  *Node
+}
+
+// State is this node's view of slot ownership. Slot assignments are not
+// gossiped; operators apply the same CLUSTER SETSLOT/SETSLOTRANGE
+// commands on every node, which keeps them across restarts with Save.
+type State struct {
+	myself    *Node
+	nodes     map[string]*Node
+	slots     [NumSlots]*Node
+	migrating map[int]*Node // slots we own that are moving to another node
+	importing map[int]*Node // slots another node owns that are moving to us
+}
+
+// New creates cluster state for the local node. An empty id generates one.
+func New(id, addr string) *State {
+	if id == "" {
+		b := make([]byte, 20)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+
+	me := &Node{ID: id, Addr: addr}
+	return &State{
+		myself:    me,
+		nodes:     map[string]*Node{id: me},
+		migrating: make(map[int]*Node),
+		importing: make(map[int]*Node),
+	}
+}
+
+// Myself returns the local node
+func (s *State) Myself() *Node {
+	return s.myself
+}
+
+// Meet registers another node so slots can be assigned to it
+func (s *State) Meet(id, addr string) {
+	if n, ok := s.nodes[id]; ok {
+		n.Addr = addr
+		return
+	}
+	s.nodes[id] = &Node{ID: id, Addr: addr}
+}
+
+// Forget removes a node that owns no slots
+func (s *State) Forget(id string) error {
+	n, ok := s.nodes[id]
+	if !ok {
+		return ErrUnknownNode
+	}
+	if n == s.myself {
+		return errors.New("can't forget myself")
+	}
+	for _, owner := range s.slots {
+		if owner == n {
+			return errors.New("node still owns slots")
+		}
+	}
+	delete(s.nodes, id)
+	return nil
+}
+
+// Owner returns the node serving slot, or nil if unassigned
+func (s *State) Owner(slot int) *Node {
+	return s.slots[slot]
+}
+
+// SetOwner assigns slot to node id and ends any migration of that slot
+func (s *State) SetOwner(slot int, id string) error {
+	if slot < 0 || slot >= NumSlots {
+		return ErrInvalidSlot
+	}
+	n, ok := s.nodes[id]
+	if !ok {
+		return ErrUnknownNode
+	}
+	s.slots[slot] = n
+	delete(s.migrating, slot)
+	delete(s.importing, slot)
+	return nil
+}
+
+// SetOwnerRange assigns the slots from start to end to node id, ending
+// any migration of them
+func (s *State) SetOwnerRange(start, end int, id string) error {
+	if start < 0 || end < start || end >= NumSlots {
+		return ErrInvalidSlot
+	}
+	if _, ok := s.nodes[id]; !ok {
+		return ErrUnknownNode
+	}
+	for slot := start; slot <= end; slot++ {
+		s.SetOwner(slot, id)
+	}
+	return nil
+}
+
+// Unassign removes the owner of slot
+func (s *State) Unassign(slot int) error {
+	if slot < 0 || slot >= NumSlots {
+		return ErrInvalidSlot
+	}
+	s.slots[slot] = nil
+	delete(s.migrating, slot)
+	delete(s.importing, slot)
+	return nil
+}
+
+// SetMigrating marks a locally owned slot as moving to node id
+func (s *State) SetMigrating(slot int, id string) error {
+	if slot < 0 || slot >= NumSlots {
+		return ErrInvalidSlot
+	}
+	if s.slots[slot] != s.myself {
+		return fmt.Errorf("slot %d is not served by this node", slot)
+	}
+	n, ok := s.nodes[id]
+	if !ok {
+		return ErrUnknownNode
+	}
+	s.migrating[slot] = n
+	return nil
+}
+
+// SetImporting marks slot as moving from node id to this node
+func (s *State) SetImporting(slot int, id string) error {
+	if slot < 0 || slot >= NumSlots {
+		return ErrInvalidSlot
+	}
+	if s.slots[slot] == s.myself {
+		return fmt.Errorf("slot %d is already served by this node", slot)
+	}
+	n, ok := s.nodes[id]
+	if !ok {
+		return ErrUnknownNode
+	}
+	s.importing[slot] = n
+	return nil
+}
+
+// SetStable cancels any migration of slot
+func (s *State) SetStable(slot int) error {
+	if slot < 0 || slot >= NumSlots {
+		return ErrInvalidSlot
+	}
+	delete(s.migrating, slot)
+	delete(s.importing, slot)
+	return nil
+}
+
+// Migrating returns the target node if slot is being migrated away
+func (s *State) Migrating(slot int) *Node {
+	return s.migrating[slot]
+}
+
+// Importing returns the source node if slot is being imported
+func (s *State) Importing(slot int) *Node {
+	return s.importing[slot]
+}
+
+// Ranges returns the assigned slots grouped into contiguous ranges
+func (s *State) Ranges() []SlotRange {
+	var ranges []SlotRange
+	for slot := 0; slot < NumSlots; slot++ {
+		owner := s.slots[slot]
+		if owner == nil {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].Node == owner && ranges[n-1].End == slot-1 {
+			ranges[n-1].End = slot
+			continue
+		}
+		ranges = append(ranges, SlotRange{Start: slot, End: slot, Node: owner})
+	}
+	return ranges
+}
+
+// Nodes returns the known nodes in a CLUSTER NODES style listing:
+// <id> <addr> <flags> <slot ranges and migrations...>
+func (s *State) Nodes() []string {
+	ids := make([]string, 0, len(s.nodes))
+	for id := range s.nodes {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	ranges := s.Ranges()
+	lines := make([]string, 0, len(ids))
+	for _, id := range ids {
+		n := s.nodes[id]
+		fields := []string{n.ID, n.Addr}
+		if n == s.myself {
+			fields = append(fields, "myself,master")
+		} else {
+			fields = append(fields, "master")
+		}
+
+		for _, r := range ranges {
+			if r.Node != n {
+				continue
+			}
+			if r.Start == r.End {
+				fields = append(fields, fmt.Sprintf("%d", r.Start))
+			} else {
+				fields = append(fields, fmt.Sprintf("%d-%d", r.Start, r.End))
+			}
+		}
+
+		if n == s.myself {
+			fields = append(fields, s.migrations()...)
+		}
+		lines = append(lines, strings.Join(fields, " "))
+	}
+	return lines
+}
+
+// migrations lists in-progress slot moves as [slot->-id] / [slot-<-id]
+func (s *State) migrations() []string {
+	var out []string
+	for slot := 0; slot < NumSlots; slot++ {
+		if n, ok := s.migrating[slot]; ok {
+			out = append(out, fmt.Sprintf("[%d->-%s]", slot, n.ID))
+		}
+		if n, ok := s.importing[slot]; ok {
+			out = append(out, fmt.Sprintf("[%d-<-%s]", slot, n.ID))
+		}
+	}
+	return out
+}
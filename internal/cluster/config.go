@@ -0,0 +1,128 @@
+package cluster
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Save writes the state to path in the CLUSTER NODES format, one node
+// per line. The file is written aside and renamed over path, so a crash
+// leaves either the previous or the new state.
+func (s *State) Save(path string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create cluster config: %w", err)
+	}
+
+	for _, line := range s.Nodes() {
+		fmt.Fprintln(file, line)
+	}
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync cluster config: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close cluster config: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// Load reads state saved by Save. The local node keeps its saved id,
+// which id must match unless empty, and is now reachable at addr.
+func Load(path, id, addr string) (*State, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Nodes are registered first, slots and migrations may refer to any
+	var lines [][]string
+	s := &State{
+		nodes:     make(map[string]*Node),
+		migrating: make(map[int]*Node),
+		importing: make(map[int]*Node),
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("invalid cluster config line %q", scanner.Text())
+		}
+		n := &Node{ID: fields[0], Addr: fields[1]}
+		if strings.Contains(fields[2], "myself") {
+			if s.myself != nil {
+				return nil, fmt.Errorf("cluster config lists two local nodes")
+			}
+			if id != "" && id != n.ID {
+				return nil, fmt.Errorf("cluster config belongs to node %s, not %s", n.ID, id)
+			}
+			n.Addr = addr
+			s.myself = n
+		}
+		s.nodes[n.ID] = n
+		lines = append(lines, fields)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cluster config: %w", err)
+	}
+	if s.myself == nil {
+		return nil, fmt.Errorf("cluster config has no local node")
+	}
+
+	for _, fields := range lines {
+		n := s.nodes[fields[0]]
+		for _, field := range fields[3:] {
+			if err := s.loadField(n, field); err != nil {
+				return nil, fmt.Errorf("node %s: %w", n.ID, err)
+			}
+		}
+	}
+	return s, nil
+}
+
+// loadField applies a slot range ("start-end" or "slot") or a migration
+// ("[slot->-id]" or "[slot-<-id]") listed for node n
+func (s *State) loadField(n *Node, field string) error {
+	if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+		field = field[1 : len(field)-1]
+		migrations := s.migrating
+		slotStr, id, ok := strings.Cut(field, "->-")
+		if !ok {
+			migrations = s.importing
+			slotStr, id, ok = strings.Cut(field, "-<-")
+		}
+		slot, err := strconv.Atoi(slotStr)
+		if !ok || err != nil || slot < 0 || slot >= NumSlots {
+			return fmt.Errorf("invalid migration %q", field)
+		}
+		other, known := s.nodes[id]
+		if !known {
+			return fmt.Errorf("migration of slot %d with %w %s", slot, ErrUnknownNode, id)
+		}
+		migrations[slot] = other
+		return nil
+	}
+
+	startStr, endStr, isRange := strings.Cut(field, "-")
+	if !isRange {
+		endStr = startStr
+	}
+	start, err1 := strconv.Atoi(startStr)
+	end, err2 := strconv.Atoi(endStr)
+	if err1 != nil || err2 != nil || start < 0 || end < start || end >= NumSlots {
+		return fmt.Errorf("invalid slots %q", field)
+	}
+	for slot := start; slot <= end; slot++ {
+		s.slots[slot] = n
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package cluster
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	s := New("a", "127.0.0.1:7001")
+	s.Meet("b", "127.0.0.1:7002")
+	s.Meet("c", "127.0.0.1:7003")
+	if err := s.SetOwnerRange(0, 5460, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetOwnerRange(5461, 10922, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetOwnerRange(10923, NumSlots-1, "c"); err != nil {
+		t.Fatal(err)
+	}
+	s.SetMigrating(100, "b")
+	s.SetImporting(6000, "b")
+
+	path := filepath.Join(t.TempDir(), "nodes.conf")
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// The local node keeps its id and takes the address it now has
+	loaded, err := Load(path, "", "127.0.0.1:8001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if me := loaded.Myself(); me.ID != "a" || me.Addr != "127.0.0.1:8001" {
+		t.Fatalf("myself is %+v after loading", me)
+	}
+	s.Myself().Addr = "127.0.0.1:8001"
+	if got, want := loaded.Nodes(), s.Nodes(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("loaded nodes\n%q\nwant\n%q", got, want)
+	}
+	if loaded.Owner(12000).ID != "c" || loaded.Migrating(100).ID != "b" || loaded.Importing(6000).ID != "b" {
+		t.Fatal("slots or migrations were not restored")
+	}
+
+	if _, err := Load(path, "other", "127.0.0.1:8001"); err == nil {
+		t.Fatal("loaded the config of another node")
+	}
+}
@@ -0,0 +1,33 @@
+package cluster
+
+import "strings"
+
+// NumSlots is the number of hash slots the keyspace is divided into
+const NumSlots = 16384
+
+// KeySlot returns the hash slot of key. If the key contains a non-empty
+// {hashtag}, only the tag is hashed so related keys share a slot.
+func KeySlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key)) % NumSlots
+}
+
+// crc16 implements CRC-16/XMODEM (polynomial 0x1021, initial value 0)
+func crc16(s string) uint16 {
+	var crc uint16
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Directive is one "name value" line of a config file
+type Directive struct {
+	Name  string
+	Value string
+	Line  int
+}
+
+// Parse reads the directives of the config file at path. Blank lines and
+// lines starting with '#' are ignored. Values containing spaces, or
+// empty values, are written in double quotes.
+func Parse(path string) ([]Directive, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	var directives []Directive
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		d, ok, err := parseLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, lineNum, err)
+		}
+		if ok {
+			d.Line = lineNum
+			directives = append(directives, d)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return directives, nil
+}
+
+func parseLine(line string) (Directive, bool, error) {
+	line = strings.TrimSpace(line)
+	if line == "" || strings.HasPrefix(line, "#") {
+		return Directive{}, false, nil
+	}
+
+	name, value, _ := strings.Cut(line, " ")
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, `"`) {
+		unquoted, err := strconv.Unquote(value)
+		if err != nil {
+			return Directive{}, false, fmt.Errorf("invalid quoted value for '%s'", name)
+		}
+		value = unquoted
+	}
+	return Directive{Name: strings.ToLower(name), Value: value}, true, nil
+}
+
+// FormatLine renders a directive, quoting the value when needed
+func FormatLine(name, value string) string {
+	if value == "" || strings.ContainsAny(value, " \t\"#") {
+		value = strconv.Quote(value)
+	}
+	return name + " " + value
+}
+
+// Rewrite updates the config file at path with values. Directives already
+// in the file are replaced in place, keeping comments and unknown lines;
+// names in order that the file lacks are appended. The file is replaced
+// atomically.
+func Rewrite(path string, values map[string]string, order []string) error {
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var lines []string
+	if len(data) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	}
+
+	written := make(map[string]bool)
+	for i, line := range lines {
+		d, ok, err := parseLine(line)
+		if err != nil || !ok {
+			continue
+		}
+		value, known := values[d.Name]
+		if !known {
+			continue
+		}
+		if written[d.Name] {
+			// Later duplicates would override the rewritten value
+			lines[i] = "# " + line
+			continue
+		}
+		if value != d.Value {
+			lines[i] = FormatLine(d.Name, value)
+		}
+		written[d.Name] = true
+	}
+
+	for _, name := range order {
+		if value, known := values[name]; known && !written[name] {
+			lines = append(lines, FormatLine(name, value))
+		}
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strings.Join(lines, "\n")+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace config file: %w", err)
+	}
+	return nil
+}
@@ -1,33 +1,130 @@
 package eventloop
 
 import (
+	"bytes"
 	"fmt"
+	"io"
 	"net"
+	"os"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"memkv/internal/executor"
 	"memkv/internal/logger"
+	"memkv/internal/protocol"
 
 	"golang.org/x/sys/unix"
 )
 
 // EventLoop handles the kqueue-based event loop
 type EventLoop struct {
-	kq       int
-	lfd      int
-	listener net.Listener
-	executor *executor.Executor
-	events   []unix.Kevent_t
+	kq        int
+	listeners map[int]*os.File // listener fd -> duplicated listener file
+	executor  *executor.Executor
+	events    []unix.Kevent_t
+	conns     map[int]*conn
+
+	// pubsubOutputLimit bounds the output pushed to subscribers and
+	// monitors that they may leave unread (0 means unlimited)
+	pubsubOutputLimit int
+
+	// Client fds handed over by other goroutines (see ServeConn) and
+	// connections whose blocking command has finished, picked up by the
+	// loop when woken through the EVFILT_USER event
+	pendingMu sync.Mutex
+	pending   []pendingConn
+	unblocked []*conn
 }
 
-// New creates a new event loop
-func New(listener net.Listener, exec *executor.Executor) (*EventLoop, error) {
-	// Mark listener as non-blocking
-	lfd, err := markListenerAsNonBlocking(listener)
-	if err != nil {
-		return nil, fmt.Errorf("failed to set non-blocking: %w", err)
+// pendingConn is a bridged connection waiting to be adopted by the loop
+type pendingConn struct {
+	fd   int
+	addr string
+}
+
+// wakeIdent identifies the EVFILT_USER event used to wake the loop
+const wakeIdent = 1
+
+// pauseRecheck bounds how long input held back by CLIENT PAUSE waits
+// before the pause is checked again, so CLIENT UNPAUSE takes effect promptly
+const pauseRecheck = 100 * time.Millisecond
+
+const (
+	// readBufferSize is the most read from a socket at once
+	readBufferSize = 16 * 1024
+
+	// maxQueryLen bounds a single command line. Clients sending longer
+	// lines are disconnected rather than growing the buffer forever.
+	maxQueryLen = 64 << 20
+
+	// DefaultPubSubOutputLimit is the default limit on unread output
+	// pushed to a subscriber or monitor, like Redis' hard
+	// client-output-buffer-limit for pubsub clients
+	DefaultPubSubOutputLimit = 32 << 20
+
+	// replicaOutputLimit is the same limit for replicas, which may fall
+	// further behind while a burst of writes is streamed to them
+	replicaOutputLimit = 256 << 20
+)
+
+// conn is the state kept for each client connection. It implements
+// executor.Conn.
+type conn struct {
+	el      *EventLoop
+	fd      int
+	session *executor.Session
+
+	// query is input not yet executed: a partial command line, or
+	// commands held back while clients are paused. Commands are
+	// separated by newlines, so a single read may carry many of them.
+	query []byte
+
+	// paused is set while reading is disabled, by CLIENT PAUSE until a
+	// timer event lets the loop retry the query buffer, or until a
+	// blocking command finishes
+	paused bool
+
+	// mu guards the output state, which may be written by goroutines
+	// other than the event loop (e.g. replicated writes notifying subscribers)
+	mu       sync.Mutex
+	out      []byte // pending output not yet accepted by the socket
+	writable bool   // EVFILT_WRITE is registered for this fd
+	closed   bool
+	killed   bool
+}
+
+// Push implements executor.Conn
+func (c *conn) Push(reply protocol.Reply) {
+	c.el.write(c, reply)
+}
+
+// Kill implements executor.Conn. Shutting the socket down makes the loop
+// see end-of-file and close the connection on its own goroutine.
+func (c *conn) Kill() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.killLocked()
+}
+
+func (c *conn) killLocked() {
+	if !c.closed && !c.killed {
+		c.killed = true
+		unix.Shutdown(c.fd, unix.SHUT_RDWR)
 	}
+}
+
+// Buffered implements executor.Conn
+func (c *conn) Buffered() (in, out int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.query), len(c.out)
+}
 
+// New creates a new event loop serving clients of all the given
+// listeners (TCP or Unix domain sockets)
+func New(listeners []net.Listener, exec *executor.Executor) (*EventLoop, error) {
 	// Create kqueue
 	kq, err := unix.Kqueue()
 	if err != nil {
@@ -35,44 +132,82 @@ func New(listener net.Listener, exec *executor.Executor) (*EventLoop, error) {
 	}
 
 	el := &EventLoop{
-		kq:       kq,
-		lfd:      lfd,
-		listener: listener,
-		executor: exec,
-		events:   make([]unix.Kevent_t, 16),
+		kq:        kq,
+		listeners: make(map[int]*os.File),
+		executor:  exec,
+		events:    make([]unix.Kevent_t, 16),
+		conns:     make(map[int]*conn),
+
+		pubsubOutputLimit: DefaultPubSubOutputLimit,
+	}
+
+	for _, listener := range listeners {
+		// Mark listener as non-blocking
+		file, err := markListenerAsNonBlocking(listener)
+		if err != nil {
+			el.Close()
+			return nil, fmt.Errorf("failed to set non-blocking: %w", err)
+		}
+
+		// Keep the file referenced so its finalizer doesn't close the fd
+		lfd := int(file.Fd())
+		el.listeners[lfd] = file
+
+		// Add listener to kqueue
+		if err := el.addListenerToKqueue(lfd); err != nil {
+			el.Close()
+			return nil, fmt.Errorf("failed to add listener to kqueue: %w", err)
+		}
 	}
 
-	// Add listener to kqueue
-	if err := el.addListenerToKqueue(); err != nil {
+	// Register the wake-up event used by ServeConn
+	wake := unix.Kevent_t{
+		Ident:  wakeIdent,
+		Filter: unix.EVFILT_USER,
+		Flags:  unix.EV_ADD | unix.EV_CLEAR,
+	}
+	if _, err := unix.Kevent(kq, []unix.Kevent_t{wake}, nil, nil); err != nil {
 		unix.Close(kq)
-		return nil, fmt.Errorf("failed to add listener to kqueue: %w", err)
+		return nil, fmt.Errorf("failed to add wake event to kqueue: %w", err)
 	}
 
 	return el, nil
 }
 
-// markListenerAsNonBlocking marks the listener socket as non-blocking
-func markListenerAsNonBlocking(l net.Listener) (int, error) {
-	tcpListener := l.(*net.TCPListener)
-	file, err := tcpListener.File()
+// SetPubSubOutputLimit sets how much pushed output a subscriber or monitor
+// may leave unread before it is disconnected. 0 removes the limit. It
+// must be called before Run.
+func (el *EventLoop) SetPubSubOutputLimit(n int) {
+	el.pubsubOutputLimit = n
+}
+
+// markListenerAsNonBlocking duplicates the listener socket and marks
+// the duplicate as non-blocking
+func markListenerAsNonBlocking(l net.Listener) (*os.File, error) {
+	fl, ok := l.(interface{ File() (*os.File, error) })
+	if !ok {
+		return nil, fmt.Errorf("unsupported listener type %T", l)
+	}
+	file, err := fl.File()
 	if err != nil {
-		return 0, fmt.Errorf("failed to get listener file: %w", err)
+		return nil, fmt.Errorf("failed to get listener file: %w", err)
 	}
 
 	fd := int(file.Fd())
 	logger.Info("File descriptor for listener is: %d", fd)
 
 	if err := unix.SetNonblock(fd, true); err != nil {
-		return 0, fmt.Errorf("failed to set non-blocking: %w", err)
+		file.Close()
+		return nil, fmt.Errorf("failed to set non-blocking: %w", err)
 	}
 
-	return fd, nil
+	return file, nil
 }
 
 // addListenerToKqueue adds the listener to the kqueue
-func (el *EventLoop) addListenerToKqueue() error {
+func (el *EventLoop) addListenerToKqueue(lfd int) error {
 	listenerEvent := unix.Kevent_t{
-		Ident:  uint64(el.lfd),
+		Ident:  uint64(lfd),
 		Filter: unix.EVFILT_READ,
 		Flags:  unix.EV_ADD,
 	}
@@ -102,15 +237,32 @@ func (el *EventLoop) Run() error {
 			ev := el.events[i]
 			fd := int(ev.Ident)
 
-			if fd == el.lfd {
+			if ev.Filter == unix.EVFILT_USER {
+				// Adopt connections handed over by ServeConn and go on
+				// with those whose blocking command finished
+				el.adoptPending()
+				el.resumeUnblocked()
+			} else if _, ok := el.listeners[fd]; ok {
 				// Handle new connections
-				if err := el.handleNewConnections(); err != nil {
+				if err := el.handleNewConnections(fd); err != nil {
 					logger.Error("Error handling new connections: %v", err)
 				}
 			} else {
-				// Handle client data
-				if ev.Filter == unix.EVFILT_READ {
-					el.handleClientData(fd)
+				c, ok := el.conns[fd]
+				if !ok {
+					continue
+				}
+
+				switch ev.Filter {
+				case unix.EVFILT_READ:
+					// Handle client data
+					el.handleClientData(c)
+				case unix.EVFILT_WRITE:
+					// Socket drained, flush pending output
+					el.flush(c)
+				case unix.EVFILT_TIMER:
+					// Retry input held back by CLIENT PAUSE
+					el.resume(c)
 				}
 			}
 		}
@@ -118,9 +270,9 @@ func (el *EventLoop) Run() error {
 }
 
 // handleNewConnections accepts new client connections
-func (el *EventLoop) handleNewConnections() error {
+func (el *EventLoop) handleNewConnections(lfd int) error {
 	for {
-		nfd, _, err := unix.Accept(el.lfd)
+		nfd, sa, err := unix.Accept(lfd)
 		if err != nil {
 			// No more connections to accept
 			if err == unix.EAGAIN || err == unix.EWOULDBLOCK {
@@ -129,67 +281,455 @@ func (el *EventLoop) handleNewConnections() error {
 			return fmt.Errorf("accept failed: %w", err)
 		}
 
-		// Set new connection as non-blocking
-		if err := unix.SetNonblock(nfd, true); err != nil {
-			unix.Close(nfd)
-			logger.Error("Failed to set client fd as non-blocking: %v", err)
-			continue
-		}
+		el.addClient(nfd, sockaddrString(sa))
+	}
+}
 
-		// Add client to kqueue
-		clientEvent := unix.Kevent_t{
-			Ident:  uint64(nfd),
-			Filter: unix.EVFILT_READ,
-			Flags:  unix.EV_ADD,
+// sockaddrString formats a peer address as host:port, or the socket path
+// for Unix domain sockets
+func sockaddrString(sa unix.Sockaddr) string {
+	switch sa := sa.(type) {
+	case *unix.SockaddrInet4:
+		return net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port))
+	case *unix.SockaddrInet6:
+		return net.JoinHostPort(net.IP(sa.Addr[:]).String(), strconv.Itoa(sa.Port))
+	case *unix.SockaddrUnix:
+		if sa.Name != "" {
+			return sa.Name
 		}
+		return "unix"
+	}
+	return "unknown"
+}
 
-		if _, err := unix.Kevent(el.kq, []unix.Kevent_t{clientEvent}, nil, nil); err != nil {
-			unix.Close(nfd)
-			logger.Error("Failed to add client to kqueue: %v", err)
-			continue
-		}
+// addClient registers a connected socket with the loop. addr is the
+// peer address reported for the connection.
+func (el *EventLoop) addClient(nfd int, addr string) {
+	// Set new connection as non-blocking
+	if err := unix.SetNonblock(nfd, true); err != nil {
+		unix.Close(nfd)
+		logger.Error("Failed to set client fd as non-blocking: %v", err)
+		return
+	}
+
+	// Add client to kqueue
+	clientEvent := unix.Kevent_t{
+		Ident:  uint64(nfd),
+		Filter: unix.EVFILT_READ,
+		Flags:  unix.EV_ADD,
+	}
 
-		logger.Info("New connection established on fd %d", nfd)
+	if _, err := unix.Kevent(el.kq, []unix.Kevent_t{clientEvent}, nil, nil); err != nil {
+		unix.Close(nfd)
+		logger.Error("Failed to add client to kqueue: %v", err)
+		return
 	}
+
+	c := &conn{el: el, fd: nfd}
+	c.session = el.executor.NewSession(addr, c)
+	el.conns[nfd] = c
+
+	logger.Info("New connection established on fd %d from %s (client id %d)", nfd, addr, c.session.ID())
 }
 
-// handleClientData reads and processes data from a client
-func (el *EventLoop) handleClientData(fd int) {
-	buf := make([]byte, 4096)
-	n, err := unix.Read(fd, buf)
+// ServeConn serves a connection the loop can't poll directly, such as a
+// TLS connection. It is bridged through a socket pair: the loop serves
+// one end like any other client while goroutines copy data between the
+// other end and c. Safe to call from any goroutine.
+//
+// TLS is terminated this way rather than in the loop itself because
+// crypto/tls only works on top of a blocking net.Conn. The cost is two
+// goroutines, a socket pair and an extra copy of the traffic per
+// connection; command execution and replies still go through the loop.
+func (el *EventLoop) ServeConn(c net.Conn) error {
+	fds, err := unix.Socketpair(unix.AF_UNIX, unix.SOCK_STREAM, 0)
+	if err != nil {
+		return fmt.Errorf("socketpair failed: %w", err)
+	}
+
+	file := os.NewFile(uintptr(fds[1]), "bridge")
+	bridge, err := net.FileConn(file)
+	file.Close()
+	if err != nil {
+		unix.Close(fds[0])
+		return fmt.Errorf("failed to wrap bridge socket: %w", err)
+	}
+
+	go pump(c, bridge)
+
+	el.pendingMu.Lock()
+	el.pending = append(el.pending, pendingConn{fd: fds[0], addr: c.RemoteAddr().String()})
+	el.pendingMu.Unlock()
+	return el.wake()
+}
+
+// wake makes Run pick up work queued by other goroutines
+func (el *EventLoop) wake() error {
+	wake := unix.Kevent_t{
+		Ident:  wakeIdent,
+		Filter: unix.EVFILT_USER,
+		Fflags: unix.NOTE_TRIGGER,
+	}
+	if _, err := unix.Kevent(el.kq, []unix.Kevent_t{wake}, nil, nil); err != nil {
+		return fmt.Errorf("failed to wake event loop: %w", err)
+	}
+	return nil
+}
+
+// pump copies data both ways until either side closes, then closes both,
+// which also ends the copy in the other direction
+func pump(a, b net.Conn) {
+	go func() {
+		io.Copy(a, b)
+		a.Close()
+		b.Close()
+	}()
+
+	io.Copy(b, a)
+	a.Close()
+	b.Close()
+}
+
+// adoptPending registers the fds queued by ServeConn
+func (el *EventLoop) adoptPending() {
+	el.pendingMu.Lock()
+	pending := el.pending
+	el.pending = nil
+	el.pendingMu.Unlock()
+
+	for _, p := range pending {
+		el.addClient(p.fd, p.addr)
+	}
+}
+
+// resumeUnblocked flushes the replies of finished blocking commands and
+// goes on with the input their connections sent meanwhile
+func (el *EventLoop) resumeUnblocked() {
+	el.pendingMu.Lock()
+	unblocked := el.unblocked
+	el.unblocked = nil
+	el.pendingMu.Unlock()
+
+	for _, c := range unblocked {
+		if el.conns[c.fd] == c {
+			el.flush(c)
+			el.resume(c)
+		}
+	}
+}
+
+// handleClientData reads data from a client and executes every complete
+// command it received
+func (el *EventLoop) handleClientData(c *conn) {
+	buf := make([]byte, readBufferSize)
+	n, err := unix.Read(c.fd, buf)
 
 	if n > 0 {
-		// Process the command
-		input := strings.TrimSpace(string(buf[:n]))
-		output := el.executor.ProcessCommand(input) + "\n"
+		c.mu.Lock()
+		c.query = append(c.query, buf[:n]...)
+		c.mu.Unlock()
 
-		// Write response
-		unix.Write(fd, []byte(output))
+		el.processQuery(c)
+		if c.closed {
+			return
+		}
 	}
 
 	// Handle connection close or error
-	if err != nil || n == 0 {
-		el.closeConnection(fd)
+	if n == 0 || (err != nil && err != unix.EAGAIN) {
+		el.closeConnection(c)
+	}
+}
+
+// processQuery executes the complete commands in the query buffer and
+// sends their replies in one write. While clients are paused the rest
+// of the buffer is held back instead.
+func (el *EventLoop) processQuery(c *conn) {
+	defer el.flush(c)
+
+	for !c.closed {
+		c.mu.Lock()
+		line, rest, found := bytes.Cut(c.query, []byte{'\n'})
+		tooLong := !found && len(c.query) > maxQueryLen
+		c.mu.Unlock()
+
+		if tooLong {
+			logger.Warn("Closing fd %d: command exceeds %d bytes", c.fd, maxQueryLen)
+			el.closeConnection(c)
+			return
+		}
+		if !found {
+			return
+		}
+
+		input := strings.TrimSpace(string(line))
+		if input != "" {
+			if wait := el.executor.PauseRemaining(c.session, input); wait > 0 {
+				el.hold(c, wait)
+				return
+			}
+		}
+
+		c.mu.Lock()
+		c.query = rest
+		c.mu.Unlock()
+
+		if input != "" && el.executor.Blocking(input) {
+			el.executeBlocking(c, input)
+			return
+		}
+		if input != "" {
+			el.execute(c, input)
+		}
+	}
+}
+
+// executeBlocking runs a command that may wait on another server, such
+// as MIGRATE, on its own goroutine so other clients are served meanwhile.
+// Reading from c stops until the reply is queued, which keeps replies in
+// order; the loop then resumes the rest of the query buffer.
+func (el *EventLoop) executeBlocking(c *conn, input string) {
+	c.mu.Lock()
+	c.paused = true
+	c.mu.Unlock()
+
+	disable := unix.Kevent_t{
+		Ident:  uint64(c.fd),
+		Filter: unix.EVFILT_READ,
+		Flags:  unix.EV_DISABLE,
+	}
+	if _, err := unix.Kevent(el.kq, []unix.Kevent_t{disable}, nil, nil); err != nil {
+		logger.Error("Failed to block fd %d: %v", c.fd, err)
+	}
+
+	go func() {
+		reply := el.executor.ProcessCommand(c.session, input)
+
+		c.mu.Lock()
+		if !c.closed {
+			c.out = reply.AppendTo(c.out)
+		}
+		c.mu.Unlock()
+
+		el.pendingMu.Lock()
+		el.unblocked = append(el.unblocked, c)
+		el.pendingMu.Unlock()
+		if err := el.wake(); err != nil {
+			logger.Error("Failed to resume fd %d: %v", c.fd, err)
+		}
+	}()
+}
+
+// execute runs one command and queues its reply
+func (el *EventLoop) execute(c *conn, input string) {
+	wasSubscribed := c.session.Subscribed()
+	reply := el.executor.ProcessCommand(c.session, input)
+
+	if subscribed := c.session.Subscribed(); subscribed != wasSubscribed {
+		if subscribed {
+			logger.Info("Connection on fd %d entered subscriber mode", c.fd)
+		} else {
+			logger.Info("Connection on fd %d left subscriber mode", c.fd)
+		}
+	}
+
+	c.mu.Lock()
+	if !c.closed {
+		c.out = reply.AppendTo(c.out)
+	}
+	c.mu.Unlock()
+
+	if c.session.CloseAfterReply() {
+		el.flush(c)
+		el.closeConnection(c)
+	}
+}
+
+// hold stops reading from c until a timer fires
+func (el *EventLoop) hold(c *conn, wait time.Duration) {
+	if wait > pauseRecheck {
+		wait = pauseRecheck
+	}
+
+	c.mu.Lock()
+	c.paused = true
+	c.mu.Unlock()
+
+	changes := []unix.Kevent_t{{
+		Ident:  uint64(c.fd),
+		Filter: unix.EVFILT_READ,
+		Flags:  unix.EV_DISABLE,
+	}, {
+		Ident:  uint64(c.fd),
+		Filter: unix.EVFILT_TIMER,
+		Flags:  unix.EV_ADD | unix.EV_ONESHOT,
+		Data:   max(wait.Milliseconds(), 1),
+	}}
+	if _, err := unix.Kevent(el.kq, changes, nil, nil); err != nil {
+		logger.Error("Failed to pause fd %d: %v", c.fd, err)
+	}
+}
+
+// resume retries held input and starts reading from c again
+func (el *EventLoop) resume(c *conn) {
+	c.mu.Lock()
+	killed := c.killed
+	c.paused = false
+	c.mu.Unlock()
+
+	// Killed connections never report EOF while reading is disabled
+	if killed {
+		el.closeConnection(c)
+		return
+	}
+
+	el.processQuery(c)
+	if c.closed {
+		return
+	}
+
+	c.mu.Lock()
+	paused := c.paused
+	c.mu.Unlock()
+	if paused {
+		return
+	}
+
+	enable := unix.Kevent_t{
+		Ident:  uint64(c.fd),
+		Filter: unix.EVFILT_READ,
+		Flags:  unix.EV_ENABLE,
+	}
+	if _, err := unix.Kevent(el.kq, []unix.Kevent_t{enable}, nil, nil); err != nil {
+		logger.Error("Failed to resume fd %d: %v", c.fd, err)
+	}
+}
+
+// write queues reply on the connection's output buffer and tries to flush
+// it. Clients that leave more pushed output unread than their limit
+// allows are disconnected rather than buffered without bound.
+func (el *EventLoop) write(c *conn, reply protocol.Reply) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed || c.killed {
+		return
+	}
+	c.out = reply.AppendTo(c.out)
+	el.flushLocked(c)
+
+	if limit := el.outputLimit(c); limit > 0 && len(c.out) > limit {
+		logger.Warn("Closing fd %d: output buffer exceeds %d bytes", c.fd, limit)
+		c.out = nil
+		c.killLocked()
+	}
+}
+
+// outputLimit returns the most pushed output c may leave unread
+func (el *EventLoop) outputLimit(c *conn) int {
+	if c.session.Replica() {
+		return replicaOutputLimit
+	}
+	return el.pubsubOutputLimit
+}
+
+// flush writes as much pending output as the socket accepts. Whatever
+// remains is sent once kqueue reports the socket as writable again.
+func (el *EventLoop) flush(c *conn) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		el.flushLocked(c)
+	}
+}
+
+func (el *EventLoop) flushLocked(c *conn) {
+	for len(c.out) > 0 {
+		n, err := unix.Write(c.fd, c.out)
+		if err != nil {
+			if err == unix.EAGAIN {
+				break
+			}
+			if err == unix.EINTR {
+				continue
+			}
+			logger.Error("Write to fd %d failed: %v", c.fd, err)
+			c.out = nil
+			return
+		}
+		c.out = c.out[n:]
+	}
+
+	// Only watch for writability while output is pending
+	if pending := len(c.out) > 0; pending != c.writable {
+		flags := uint16(unix.EV_ADD)
+		if !pending {
+			flags = unix.EV_DELETE
+			c.out = nil
+		}
+		ev := unix.Kevent_t{
+			Ident:  uint64(c.fd),
+			Filter: unix.EVFILT_WRITE,
+			Flags:  flags,
+		}
+		if _, err := unix.Kevent(el.kq, []unix.Kevent_t{ev}, nil, nil); err != nil {
+			logger.Error("Failed to update write filter for fd %d: %v", c.fd, err)
+			return
+		}
+		c.writable = pending
 	}
 }
 
 // closeConnection closes a client connection
-func (el *EventLoop) closeConnection(fd int) {
+func (el *EventLoop) closeConnection(c *conn) {
+	// Stop concurrent writers before the fd can be reused
+	c.mu.Lock()
+	c.closed = true
+	writable := c.writable
+	paused := c.paused
+	c.mu.Unlock()
+
 	// Remove from kqueue
-	clientEvent := unix.Kevent_t{
-		Ident:  uint64(fd),
+	clientEvents := []unix.Kevent_t{{
+		Ident:  uint64(c.fd),
 		Filter: unix.EVFILT_READ,
 		Flags:  unix.EV_DELETE,
+	}}
+	if writable {
+		clientEvents = append(clientEvents, unix.Kevent_t{
+			Ident:  uint64(c.fd),
+			Filter: unix.EVFILT_WRITE,
+			Flags:  unix.EV_DELETE,
+		})
+	}
+	unix.Kevent(el.kq, clientEvents, nil, nil)
+
+	// A pending pause timer is removed separately since it may have fired
+	if paused {
+		timer := unix.Kevent_t{
+			Ident:  uint64(c.fd),
+			Filter: unix.EVFILT_TIMER,
+			Flags:  unix.EV_DELETE,
+		}
+		unix.Kevent(el.kq, []unix.Kevent_t{timer}, nil, nil)
 	}
-	unix.Kevent(el.kq, []unix.Kevent_t{clientEvent}, nil, nil)
+
+	// Drop subscriptions so publishers stop writing to this connection
+	el.executor.CloseSession(c.session)
+	delete(el.conns, c.fd)
 
 	// Close the file descriptor
-	unix.Close(fd)
-	logger.Info("Closed connection on fd %d", fd)
+	unix.Close(c.fd)
+	logger.Info("Closed connection on fd %d", c.fd)
 }
 
 // Close closes the event loop
 func (el *EventLoop) Close() error {
+	for lfd, file := range el.listeners {
+		file.Close()
+		delete(el.listeners, lfd)
+	}
 	if el.kq > 0 {
 		return unix.Close(el.kq)
 	}
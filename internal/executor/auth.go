@@ -0,0 +1,228 @@
+package executor
+
+import (
+	"strings"
+
+	"memkv/internal/acl"
+	"memkv/internal/protocol"
+)
+
+// LoadACLFile loads users from an ACL file, which ACL SAVE writes back to
+func (e *Executor) LoadACLFile(path string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.acl.LoadFile(path)
+}
+
+// SetACLFile sets the file used by ACL LOAD and ACL SAVE without loading it
+func (e *Executor) SetACLFile(path string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.acl.SetPath(path)
+}
+
+// RequirePass sets a password on the default user
+func (e *Executor) RequirePass(password string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.acl.SetUser(acl.DefaultUser, []string{"resetpass", ">" + password})
+}
+
+// currentUser returns the user sess is authenticated as. Connections that
+// never authenticated act as the default user while it needs no password.
+// The caller must hold e.mu.
+func (e *Executor) currentUser(sess *Session) *acl.User {
+	name := sess.user
+	if name == "" {
+		name = acl.DefaultUser
+	}
+
+	u, ok := e.acl.User(name)
+	if !ok || !u.Enabled {
+		return nil
+	}
+	if sess.user == "" && !u.NoPass {
+		return nil
+	}
+	return u
+}
+
+// checkPermissions enforces authentication and ACLs before dispatch.
+// The caller must hold e.mu.
+func (e *Executor) checkPermissions(sess *Session, c *command, parts []string) protocol.Reply {
+	if c.flags&flagNoAuth != 0 {
+		return protocol.OK
+	}
+	u := e.currentUser(sess)
+	if u == nil {
+		return protocol.Error("NOAUTH Authentication required")
+	}
+
+	// ACL rules name top-level commands, which cover their subcommands
+	name := strings.ToUpper(parts[0])
+	if !u.CanRun(name) {
+		return protocol.Errorf("NOPERM User %s has no permissions to run the '%s' command", u.Name, strings.ToLower(name))
+	}
+
+	for _, key := range c.keys(parts) {
+		if !u.CanAccessKey(key) {
+			return protocol.Errorf("NOPERM User %s has no permissions to access the '%s' key", u.Name, key)
+		}
+	}
+	return protocol.OK
+}
+
+// handleAuth implements AUTH [username] password
+func (e *Executor) handleAuth(sess *Session, parts []string) protocol.Reply {
+	var name, password string
+	switch len(parts) {
+	case 2:
+		name, password = acl.DefaultUser, parts[1]
+	case 3:
+		name, password = parts[1], parts[2]
+	default:
+		return protocol.Error("ERR AUTH requires [username] password")
+	}
+
+	u, ok := e.acl.Authenticate(name, password)
+	if !ok {
+		return protocol.Error("WRONGPASS invalid username-password pair or user is disabled")
+	}
+	sess.user = u.Name
+	return protocol.OK
+}
+
+// handleHello implements HELLO [AUTH username password]
+func (e *Executor) handleHello(sess *Session, parts []string) protocol.Reply {
+	if len(parts) == 4 && strings.EqualFold(parts[1], "AUTH") {
+		if reply := e.handleAuth(sess, parts[1:]); reply.IsError() {
+			return reply
+		}
+	} else if len(parts) != 1 {
+		return protocol.Error("ERR HELLO accepts only [AUTH username password]")
+	}
+
+	if e.currentUser(sess) == nil {
+		return protocol.Error("NOAUTH HELLO must be called with AUTH when a password is required")
+	}
+
+	role := "master"
+	if e.follower != nil {
+		role = "replica"
+	}
+	return protocol.BulkArray([]string{
+		"server", "memkv",
+		"version", Version,
+		"role", role,
+	})
+}
+
+func (e *Executor) handleACL(sess *Session, parts []string) protocol.Reply {
+	switch strings.ToUpper(parts[1]) {
+	case "WHOAMI":
+		if u := e.currentUser(sess); u != nil {
+			return protocol.Bulk(u.Name)
+		}
+		return protocol.Nil
+	case "SETUSER":
+		if err := e.acl.SetUser(parts[2], parts[3:]); err != nil {
+			return protocol.Errorf("ERR %v", err)
+		}
+		return protocol.OK
+	case "GETUSER":
+		u, ok := e.acl.User(parts[2])
+		if !ok {
+			return protocol.Nil
+		}
+		return protocol.Bulk(e.describeUser(u))
+	case "DELUSER":
+		deleted := 0
+		for _, name := range parts[2:] {
+			if err := e.acl.DelUser(name); err == acl.ErrCantDeleteDefault {
+				return protocol.Errorf("ERR %v", err)
+			} else if err == nil {
+				deleted++
+			}
+		}
+		return protocol.Integer(int64(deleted))
+	case "LIST":
+		lines := make([]string, 0)
+		for _, name := range e.acl.Users() {
+			lines = append(lines, e.acl.Describe(name))
+		}
+		return protocol.BulkArray(lines)
+	case "USERS":
+		return protocol.BulkArray(e.acl.Users())
+	case "CAT":
+		if len(parts) == 2 {
+			return protocol.BulkArray(e.acl.Categories())
+		}
+		cmds, ok := e.acl.CategoryCommands(parts[2])
+		if !ok {
+			return protocol.Errorf("ERR unknown category '%s'", parts[2])
+		}
+		for i, cmd := range cmds {
+			cmds[i] = strings.ToLower(cmd)
+		}
+		return protocol.BulkArray(cmds)
+	case "LOAD":
+		if e.acl.Path() == "" {
+			return protocol.Error("ERR no ACL file configured")
+		}
+		if err := e.acl.LoadFile(e.acl.Path()); err != nil {
+			return protocol.Errorf("ERR %v", err)
+		}
+		return protocol.OK
+	case "SAVE":
+		if err := e.acl.Save(); err != nil {
+			return protocol.Errorf("ERR %v", err)
+		}
+		return protocol.OK
+	default:
+		return protocol.Errorf("ERR unknown ACL subcommand '%s'", parts[1])
+	}
+}
+
+// describeUser renders ACL GETUSER output as field:value lines
+func (e *Executor) describeUser(u *acl.User) string {
+	var flags []string
+	if u.Enabled {
+		flags = append(flags, "on")
+	} else {
+		flags = append(flags, "off")
+	}
+	if u.NoPass {
+		flags = append(flags, "nopass")
+	}
+	if u.AllKeys {
+		flags = append(flags, "allkeys")
+	}
+
+	var passwords, commands []string
+	for _, rule := range e.acl.Rules(u.Name) {
+		switch {
+		case strings.HasPrefix(rule, "#"):
+			passwords = append(passwords, rule[1:])
+		case strings.HasPrefix(rule, "+"), strings.HasPrefix(rule, "-"):
+			commands = append(commands, rule)
+		}
+	}
+
+	return strings.Join([]string{
+		"flags:" + strings.Join(flags, ","),
+		"passwords:" + strings.Join(passwords, ","),
+		"commands:" + strings.Join(commands, " "),
+		"keys:" + strings.Join(keyPatterns(u), " "),
+	}, "\n")
+}
+
+func keyPatterns(u *acl.User) []string {
+	if u.AllKeys {
+		return []string{"~*"}
+	}
+	patterns := make([]string, 0, len(u.Keys))
+	for _, p := range u.Keys {
+		patterns = append(patterns, "~"+p)
+	}
+	return patterns
+}
@@ -0,0 +1,282 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"memkv/internal/acl"
+	"memkv/internal/logger"
+	"memkv/internal/protocol"
+)
+
+// clientPause is the state set by CLIENT PAUSE
+type clientPause struct {
+	until  time.Time
+	writes bool // only write commands are held back
+}
+
+// PauseRemaining reports how long input from sess must be held back
+// because of CLIENT PAUSE. Zero means the input can be processed now.
+func (e *Executor) PauseRemaining(sess *Session, input string) time.Duration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if sess.master || sess.replica {
+		return 0
+	}
+	remaining := time.Until(e.pause.until)
+	if remaining <= 0 {
+		return 0
+	}
+
+	if e.pause.writes {
+		parts := strings.Fields(input)
+		if len(parts) == 0 {
+			return 0
+		}
+		cmd := strings.ToUpper(parts[0])
+		if !isWrite(cmd) && !(cmd == "EXEC" && sess.tx != nil && sess.tx.hasWrites()) {
+			return 0
+		}
+	}
+	return remaining
+}
+
+// paused reports whether a CLIENT PAUSE is in effect. The caller must hold e.mu.
+func (e *Executor) paused() bool {
+	return time.Now().Before(e.pause.until)
+}
+
+// closeIdleClients kills connections idle for longer than the configured
+// timeout. Replicas, subscribers and monitors are expected to stay quiet.
+// The caller must hold e.mu.
+func (e *Executor) closeIdleClients(now time.Time) {
+	if e.idleTimeout <= 0 {
+		return
+	}
+	for sess := range e.sessions {
+		if sess.replica || sess.Subscribed() || sess.monitor != nil || sess.conn == nil {
+			continue
+		}
+		if now.Sub(sess.lastActive) > e.idleTimeout {
+			logger.Info("Closing client %d (%s): idle timeout", sess.id, sess.addr)
+			sess.conn.Kill()
+		}
+	}
+}
+
+// handleClient implements the CLIENT command family
+func (e *Executor) handleClient(sess *Session, parts []string) protocol.Reply {
+	switch strings.ToUpper(parts[1]) {
+	case "ID":
+		return protocol.Integer(sess.id)
+	case "INFO":
+		return protocol.Bulk(e.clientInfo(sess))
+	case "LIST":
+		return e.handleClientList(parts)
+	case "SETNAME":
+		sess.name = parts[2]
+		return protocol.OK
+	case "GETNAME":
+		if sess.name == "" {
+			return protocol.Nil
+		}
+		return protocol.Bulk(sess.name)
+	case "KILL":
+		return e.handleClientKill(sess, parts)
+	case "PAUSE":
+		return e.handleClientPause(parts)
+	case "UNPAUSE":
+		e.pause = clientPause{}
+		return protocol.OK
+	default:
+		return protocol.Errorf("ERR unknown CLIENT subcommand '%s'", parts[1])
+	}
+}
+
+// handleClientList implements CLIENT LIST [ID id ...]
+func (e *Executor) handleClientList(parts []string) protocol.Reply {
+	var ids map[int64]bool
+	if len(parts) > 2 {
+		if !strings.EqualFold(parts[2], "ID") || len(parts) < 4 {
+			return protocol.Error("ERR CLIENT LIST accepts only [ID id ...]")
+		}
+		ids = make(map[int64]bool)
+		for _, arg := range parts[3:] {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return protocol.Errorf("ERR invalid client id '%s'", arg)
+			}
+			ids[id] = true
+		}
+	}
+
+	var lines []string
+	for _, sess := range e.sortedSessions() {
+		if ids == nil || ids[sess.id] {
+			lines = append(lines, e.clientInfo(sess))
+		}
+	}
+	return protocol.Bulk(strings.Join(lines, "\n"))
+}
+
+// handleClientKill implements CLIENT KILL addr and the filter form
+// CLIENT KILL [ID id] [ADDR addr] [USER name] [SKIPME yes|no]
+func (e *Executor) handleClientKill(sess *Session, parts []string) protocol.Reply {
+	if len(parts) == 3 {
+		for _, target := range e.sortedSessions() {
+			if target.addr == parts[2] {
+				e.killSession(sess, target)
+				return protocol.OK
+			}
+		}
+		return protocol.Error("ERR No such client")
+	}
+
+	if len(parts) < 4 || len(parts)%2 != 0 {
+		return protocol.Error("ERR CLIENT KILL requires addr or filter/value pairs")
+	}
+
+	var (
+		id     int64
+		addr   string
+		user   string
+		skipMe = true
+	)
+	for i := 2; i < len(parts); i += 2 {
+		value := parts[i+1]
+		switch strings.ToUpper(parts[i]) {
+		case "ID":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return protocol.Errorf("ERR invalid client id '%s'", value)
+			}
+			id = n
+		case "ADDR":
+			addr = value
+		case "USER":
+			user = value
+		case "SKIPME":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return protocol.Error("ERR SKIPME must be yes or no")
+			}
+		default:
+			return protocol.Errorf("ERR unknown CLIENT KILL filter '%s'", parts[i])
+		}
+	}
+
+	killed := 0
+	for _, target := range e.sortedSessions() {
+		switch {
+		case skipMe && target == sess,
+			id != 0 && target.id != id,
+			addr != "" && target.addr != addr,
+			user != "" && sessionUser(target) != user:
+			continue
+		}
+		e.killSession(sess, target)
+		killed++
+	}
+	return protocol.Integer(int64(killed))
+}
+
+// killSession closes target's connection. A client killing itself is
+// closed only after it receives the reply.
+func (e *Executor) killSession(sess, target *Session) {
+	if target == sess {
+		target.closeAfterReply = true
+		return
+	}
+	if target.conn != nil {
+		target.conn.Kill()
+	}
+}
+
+// handleClientPause implements CLIENT PAUSE timeout-ms [WRITE|ALL]
+func (e *Executor) handleClientPause(parts []string) protocol.Reply {
+	if len(parts) > 4 {
+		return protocol.Error("ERR CLIENT PAUSE requires timeout and optional WRITE|ALL")
+	}
+
+	ms, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil || ms < 0 {
+		return protocol.Errorf("ERR invalid timeout '%s'", parts[2])
+	}
+
+	writes := false
+	if len(parts) == 4 {
+		switch strings.ToUpper(parts[3]) {
+		case "WRITE":
+			writes = true
+		case "ALL":
+		default:
+			return protocol.Error("ERR CLIENT PAUSE mode must be WRITE or ALL")
+		}
+	}
+
+	e.pause = clientPause{
+		until:  time.Now().Add(time.Duration(ms) * time.Millisecond),
+		writes: writes,
+	}
+	return protocol.OK
+}
+
+// clientInfo renders the CLIENT LIST line describing sess
+func (e *Executor) clientInfo(sess *Session) string {
+	now := time.Now()
+
+	flags := ""
+	if sess.replica {
+		flags += "S"
+	}
+	if sess.Subscribed() {
+		flags += "P"
+	}
+	if sess.monitor != nil {
+		flags += "O"
+	}
+	if sess.closeAfterReply {
+		flags += "c"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+
+	var qbuf, obuf int
+	if sess.conn != nil {
+		qbuf, obuf = sess.conn.Buffered()
+	}
+
+	return fmt.Sprintf("id=%d addr=%s name=%s age=%d idle=%d flags=%s db=%d sub=%d psub=%d qbuf=%d obuf=%d user=%s cmd=%s",
+		sess.id, sess.addr, sess.name,
+		int64(now.Sub(sess.created).Seconds()), int64(now.Sub(sess.lastActive).Seconds()),
+		flags, sess.db, len(sess.channels), len(sess.patterns), qbuf, obuf,
+		sessionUser(sess), orDash(sess.lastCmd))
+}
+
+// sortedSessions returns the connected sessions ordered by id. The
+// caller must hold e.mu.
+func (e *Executor) sortedSessions() []*Session {
+	sessions := make([]*Session, 0, len(e.sessions))
+	for sess := range e.sessions {
+		sessions = append(sessions, sess)
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].id < sessions[j].id })
+	return sessions
+}
+
+// sessionUser is the ACL user sess runs as
+func sessionUser(sess *Session) string {
+	if sess.user == "" {
+		return acl.DefaultUser
+	}
+	return sess.user
+}
@@ -0,0 +1,403 @@
+package executor
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"memkv/internal/cluster"
+	"memkv/internal/logger"
+	"memkv/internal/protocol"
+)
+
+// migrateTimeout bounds the whole exchange with the MIGRATE target
+const migrateTimeout = 2 * time.Second
+
+// EnableCluster turns on cluster mode with this node identified by id
+// and reachable by clients at addr. The state saved in configFile, if
+// any, is loaded, and changes are saved there (unless it is empty).
+func (e *Executor) EnableCluster(id, addr, configFile string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	state := cluster.New(id, addr)
+	if configFile != "" {
+		loaded, err := cluster.Load(configFile, id, addr)
+		switch {
+		case err == nil:
+			state = loaded
+		case !os.IsNotExist(err):
+			return fmt.Errorf("failed to load cluster config: %w", err)
+		}
+	}
+
+	e.cluster = state
+	e.clusterConfigFile = configFile
+	if err := e.saveClusterConfig(); err != nil {
+		return err
+	}
+	logger.Info("Cluster mode enabled, node id %s", e.cluster.Myself().ID)
+	return nil
+}
+
+// saveClusterConfig persists the cluster state. The caller must hold e.mu.
+func (e *Executor) saveClusterConfig() error {
+	if e.clusterConfigFile == "" {
+		return nil
+	}
+	if err := e.cluster.Save(e.clusterConfigFile); err != nil {
+		return fmt.Errorf("failed to save cluster config: %w", err)
+	}
+	return nil
+}
+
+// clusterRedirect returns a MOVED/ASK error if the command's keys are not
+// served by this node, CROSSSLOT if they are in different slots, or OK if
+// the command may run here
+func (e *Executor) clusterRedirect(sess *Session, c *command, parts []string) protocol.Reply {
+	keys := c.keys(parts)
+	if len(keys) == 0 {
+		return protocol.OK
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.selectDB(sess.db)
+
+	key := keys[0]
+	slot := cluster.KeySlot(key)
+	for _, other := range keys[1:] {
+		if cluster.KeySlot(other) != slot {
+			return protocol.Error("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+	owner := e.cluster.Owner(slot)
+	me := e.cluster.Myself()
+
+	if owner == me {
+		// Keys already moved to the target are looked up there
+		if target := e.cluster.Migrating(slot); target != nil && !e.storage.Exists(key) {
+			return protocol.Errorf("ASK %d %s", slot, target.Addr)
+		}
+		return protocol.OK
+	}
+
+	if e.cluster.Importing(slot) != nil && sess.asking {
+		return protocol.OK
+	}
+	if owner == nil {
+		return protocol.Errorf("CLUSTERDOWN Hash slot %d not served", slot)
+	}
+	return protocol.Errorf("MOVED %d %s", slot, owner.Addr)
+}
+
+// handleAsking lets the next command access a slot being imported
+func (e *Executor) handleAsking(sess *Session) protocol.Reply {
+	sess.asking = true
+	return protocol.OK
+}
+
+// clusterChanges are the CLUSTER subcommands after which the state is saved
+var clusterChanges = map[string]bool{
+	"MEET": true, "FORGET": true, "ADDSLOTS": true, "ADDSLOTSRANGE": true,
+	"DELSLOTS": true, "SETSLOT": true, "SETSLOTRANGE": true,
+}
+
+func (e *Executor) handleCluster(parts []string) protocol.Reply {
+	if e.cluster == nil {
+		return protocol.Error("ERR This instance has cluster support disabled")
+	}
+
+	reply := e.clusterCommand(parts)
+	if !reply.IsError() && clusterChanges[strings.ToUpper(parts[1])] {
+		if err := e.saveClusterConfig(); err != nil {
+			logger.Error("%v", err)
+			return protocol.Errorf("ERR %v", err)
+		}
+	}
+	return reply
+}
+
+func (e *Executor) clusterCommand(parts []string) protocol.Reply {
+	switch strings.ToUpper(parts[1]) {
+	case "KEYSLOT":
+		return protocol.Integer(int64(cluster.KeySlot(parts[2])))
+	case "MYID":
+		return protocol.Bulk(e.cluster.Myself().ID)
+	case "MEET":
+		e.cluster.Meet(parts[2], net.JoinHostPort(parts[3], parts[4]))
+		return protocol.OK
+	case "FORGET":
+		if err := e.cluster.Forget(parts[2]); err != nil {
+			return protocol.Errorf("ERR %v", err)
+		}
+		return protocol.OK
+	case "ADDSLOTS":
+		return e.assignSlots(parts[2:], false)
+	case "ADDSLOTSRANGE":
+		if len(parts)%2 != 0 {
+			return protocol.Error("ERR CLUSTER ADDSLOTSRANGE requires start and end slot pairs")
+		}
+		return e.assignSlots(parts[2:], true)
+	case "DELSLOTS":
+		for _, arg := range parts[2:] {
+			slot, err := parseSlot(arg)
+			if err != nil {
+				return protocol.Errorf("ERR %v", err)
+			}
+			e.cluster.Unassign(slot)
+		}
+		return protocol.OK
+	case "SETSLOT":
+		return e.handleSetSlot(parts)
+	case "SETSLOTRANGE":
+		return e.handleSetSlotRange(parts)
+	case "SLOTS":
+		ranges := e.cluster.Ranges()
+		elems := make([]protocol.Reply, 0, len(ranges))
+		for _, r := range ranges {
+			elems = append(elems, protocol.Array(
+				protocol.Integer(int64(r.Start)),
+				protocol.Integer(int64(r.End)),
+				protocol.Bulk(r.Node.Addr),
+				protocol.Bulk(r.Node.ID),
+			))
+		}
+		return protocol.Array(elems...)
+	case "NODES":
+		return protocol.Bulk(strings.Join(e.cluster.Nodes(), "\n"))
+	case "COUNTKEYSINSLOT":
+		slot, err := parseSlot(parts[2])
+		if err != nil {
+			return protocol.Errorf("ERR %v", err)
+		}
+		return protocol.Integer(int64(len(e.keysInSlot(slot, -1))))
+	case "GETKEYSINSLOT":
+		slot, err := parseSlot(parts[2])
+		if err != nil {
+			return protocol.Errorf("ERR %v", err)
+		}
+		count, err := strconv.Atoi(parts[3])
+		if err != nil || count < 0 {
+			return protocol.Error("ERR invalid count")
+		}
+		return protocol.BulkArray(e.keysInSlot(slot, count))
+	default:
+		return protocol.Errorf("ERR unknown CLUSTER subcommand '%s'", parts[1])
+	}
+}
+
+// assignSlots gives slots (or start/end range pairs) to this node
+func (e *Executor) assignSlots(args []string, ranges bool) protocol.Reply {
+	if len(args) == 0 {
+		return protocol.Error("ERR no slots given")
+	}
+
+	var slots []int
+	for i := 0; i < len(args); i++ {
+		start, err := parseSlot(args[i])
+		if err != nil {
+			return protocol.Errorf("ERR %v", err)
+		}
+		end := start
+		if ranges {
+			i++
+			if end, err = parseSlot(args[i]); err != nil {
+				return protocol.Errorf("ERR %v", err)
+			}
+		}
+		for slot := start; slot <= end; slot++ {
+			if owner := e.cluster.Owner(slot); owner != nil {
+				return protocol.Errorf("ERR slot %d is already served by %s", slot, owner.ID)
+			}
+			slots = append(slots, slot)
+		}
+	}
+
+	me := e.cluster.Myself().ID
+	for _, slot := range slots {
+		e.cluster.SetOwner(slot, me)
+	}
+	return protocol.OK
+}
+
+func (e *Executor) handleSetSlot(parts []string) protocol.Reply {
+	slot, err := parseSlot(parts[2])
+	if err != nil {
+		return protocol.Errorf("ERR %v", err)
+	}
+
+	action := strings.ToUpper(parts[3])
+	if action == "STABLE" {
+		err = e.cluster.SetStable(slot)
+	} else if len(parts) != 5 {
+		return protocol.Errorf("ERR CLUSTER SETSLOT %s requires node id", action)
+	} else {
+		switch action {
+		case "NODE":
+			err = e.cluster.SetOwner(slot, parts[4])
+		case "MIGRATING":
+			err = e.cluster.SetMigrating(slot, parts[4])
+		case "IMPORTING":
+			err = e.cluster.SetImporting(slot, parts[4])
+		default:
+			return protocol.Errorf("ERR unknown SETSLOT action '%s'", parts[3])
+		}
+	}
+
+	if err != nil {
+		return protocol.Errorf("ERR %v", err)
+	}
+	return protocol.OK
+}
+
+// handleSetSlotRange implements CLUSTER SETSLOTRANGE start end NODE id,
+// which assigns a range of slots to any known node
+func (e *Executor) handleSetSlotRange(parts []string) protocol.Reply {
+	if strings.ToUpper(parts[4]) != "NODE" {
+		return protocol.Errorf("ERR unknown SETSLOTRANGE action '%s'", parts[4])
+	}
+	start, err := parseSlot(parts[2])
+	if err != nil {
+		return protocol.Errorf("ERR %v", err)
+	}
+	end, err := parseSlot(parts[3])
+	if err != nil {
+		return protocol.Errorf("ERR %v", err)
+	}
+	if end < start {
+		return protocol.Error("ERR end slot is before start slot")
+	}
+	if err := e.cluster.SetOwnerRange(start, end, parts[5]); err != nil {
+		return protocol.Errorf("ERR %v", err)
+	}
+	return protocol.OK
+}
+
+// keysInSlot returns up to max local keys hashing to slot (all if max < 0)
+func (e *Executor) keysInSlot(slot, max int) []string {
+	var keys []string
+	for _, key := range e.storage.Keys() {
+		if max >= 0 && len(keys) >= max {
+			break
+		}
+		if cluster.KeySlot(key) == slot {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// handleMigrate implements MIGRATE host port key [AUTH password |
+// AUTH2 username password]: the key is written on the target, which must
+// be importing the slot, and then deleted locally. It is called without
+// e.mu, which is only taken around storage accesses so that other
+// clients aren't held up while the target replies.
+func (e *Executor) handleMigrate(sess *Session, parts []string) protocol.Reply {
+	key := parts[3]
+	var auth []string
+	for i := 4; i < len(parts); i++ {
+		switch opt := strings.ToUpper(parts[i]); {
+		case opt == "AUTH" && i+1 < len(parts):
+			auth = []string{"AUTH", parts[i+1]}
+			i++
+		case opt == "AUTH2" && i+2 < len(parts):
+			auth = []string{"AUTH", parts[i+1], parts[i+2]}
+			i += 2
+		default:
+			return protocol.Error("ERR syntax error")
+		}
+	}
+
+	e.mu.Lock()
+	if e.raft != nil {
+		e.mu.Unlock()
+		return protocol.Error("ERR MIGRATE is not supported with Raft replication")
+	}
+	if e.follower != nil && !sess.master {
+		e.mu.Unlock()
+		return protocol.Error("READONLY You can't write against a read only replica")
+	}
+	e.selectDB(sess.db)
+	value, err := e.storage.Get(key)
+	ttl, hasTTL, _ := e.storage.TTL(key)
+	e.mu.Unlock()
+	if err != nil {
+		return protocol.Status("NOKEY")
+	}
+
+	// The expiry is sent relative to now so clock differences between
+	// the nodes don't shorten or extend it
+	cmds := [][]string{{"ASKING"}, {"SET", key, value}}
+	if hasTTL {
+		cmds = append(cmds, []string{"ASKING"}, []string{"PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10)})
+	}
+	if auth != nil {
+		cmds = append([][]string{auth}, cmds...)
+	}
+	if reply := e.sendToNode(net.JoinHostPort(parts[1], parts[2]), cmds); reply.IsError() {
+		return reply
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.selectDB(sess.db)
+
+	// A write that raced with the transfer is kept here rather than lost
+	if current, err := e.storage.Get(key); err != nil || current != value {
+		return protocol.Error("ERR key changed during MIGRATE, retry")
+	}
+	if err := e.storage.Delete(key); err != nil {
+		return protocol.Errorf("ERR %v", err)
+	}
+
+	e.notifyKeyspaceEvent(notifyGeneric, "del", key)
+	e.propagate("DEL", key)
+	return protocol.OK
+}
+
+// sendToNode runs cmds on the node at addr, stopping at the first
+// error. The connection uses TLS if inter-node TLS is enabled.
+func (e *Executor) sendToNode(addr string, cmds [][]string) protocol.Reply {
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: migrateTimeout}
+	if e.tlsClient != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, e.tlsClient)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return protocol.Errorf("IOERR %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(migrateTimeout))
+
+	reader := bufio.NewReader(conn)
+	for _, cmd := range cmds {
+		if _, err := fmt.Fprintf(conn, "%s\n", strings.Join(cmd, " ")); err != nil {
+			return protocol.Errorf("IOERR %v", err)
+		}
+		reply, err := protocol.ReadReply(reader)
+		if err != nil {
+			return protocol.Errorf("IOERR %v", err)
+		}
+		if reply.IsError() {
+			return protocol.Errorf("ERR target replied %s", reply)
+		}
+	}
+	return protocol.OK
+}
+
+func parseSlot(s string) (int, error) {
+	slot, err := strconv.Atoi(s)
+	if err != nil || slot < 0 || slot >= cluster.NumSlots {
+		return 0, fmt.Errorf("invalid slot '%s'", s)
+	}
+	return slot, nil
+}
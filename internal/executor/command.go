@@ -1,107 +1,475 @@
 package executor
 
 import (
-	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"memkv/internal/glob"
 	"memkv/internal/logger"
+	"memkv/internal/protocol"
 	"memkv/internal/storage"
 )
 
-// ProcessCommand processes a command and returns the response
-func (e *Executor) ProcessCommand(input string) string {
+// ProcessCommand processes a command on behalf of sess and returns the response
+func (e *Executor) ProcessCommand(sess *Session, input string) protocol.Reply {
 	parts := strings.Fields(input)
 	if len(parts) == 0 {
-		return "ERROR: empty command"
+		return protocol.Error("ERR empty command")
 	}
 
 	cmd := strings.ToUpper(parts[0])
+	e.stats.commands.Add(1)
 
-	switch cmd {
-	case "SET":
-		return e.handleSet(parts)
-	case "GET":
-		return e.handleGet(parts)
-	case "DELETE", "DEL":
-		return e.handleDelete(parts)
-	case "EXISTS":
-		return e.handleExists(parts)
-	case "KEYS":
-		return e.handleKeys()
-	case "PING":
-		return "PONG"
-	default:
-		return fmt.Sprintf("ERROR: unknown command '%s'", cmd)
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start)
+		label := commandLabel(cmd)
+		commandsMetric.With(label).Inc()
+		commandDurationMetric.With(label).ObserveDuration(duration)
+		e.slowlog.record(sess, parts, start, duration)
+	}()
+
+	// Unknown commands and wrong arities never run, and make EXEC
+	// discard a transaction they were sent in
+	c, invalid := lookupCommand(parts)
+	if c == nil {
+		if sess.tx != nil {
+			sess.tx.failed = true
+		}
+		return invalid
+	}
+
+	// Authentication and ACLs are checked before anything else
+	e.mu.Lock()
+	sess.touch(cmd)
+	var denied protocol.Reply
+	if !sess.master {
+		denied = e.checkPermissions(sess, c, parts)
+	}
+	monitoring := sess.monitor != nil
+	if !denied.IsError() && !monitoring && !sess.master {
+		e.feedMonitors(sess, parts)
+	}
+	e.mu.Unlock()
+	if denied.IsError() {
+		return denied
+	}
+
+	// Monitoring connections only receive the command stream
+	if monitoring {
+		return protocol.Error("ERR connection is in MONITOR mode")
+	}
+
+	// Subscribed connections are push-only
+	if sess.Subscribed() && !subscriberCommands[cmd] {
+		return protocol.Errorf("ERR '%s' is not allowed in subscriber mode", cmd)
+	}
+
+	// ASKING only applies to the command that follows it
+	if cmd != "ASKING" {
+		defer func() { sess.asking = false }()
+	}
+
+	// In cluster mode, keys owned elsewhere are redirected
+	if e.cluster != nil && !sess.master {
+		if redirect := e.clusterRedirect(sess, c, parts); redirect.IsError() {
+			return redirect
+		}
+	}
+
+	// Between MULTI and EXEC commands are queued instead of run
+	if sess.tx != nil && !transactionCommands[cmd] {
+		return e.queueCommand(sess, c, parts)
+	}
+
+	// Commands waiting on another server take e.mu themselves, only
+	// around their storage accesses
+	if c.flags&flagBlocking != 0 {
+		return c.handler(e, sess, parts)
 	}
+
+	// Under Raft, writes and membership changes wait for consensus and
+	// must not hold e.mu, which applying committed entries needs
+	if e.raft != nil {
+		if cmd == "RAFT" {
+			return e.handleRaft(parts)
+		}
+		if c.flags&flagWrite != 0 {
+			return e.proposeWrite(sess, parts)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	// Replicas only accept writes from their leader
+	if e.follower != nil && c.flags&flagWrite != 0 && !sess.master {
+		return protocol.Error("READONLY You can't write against a read only replica")
+	}
+
+	e.selectDB(sess.db)
+	return c.handler(e, sess, parts)
 }
 
-func (e *Executor) handleSet(parts []string) string {
-	if len(parts) < 3 {
-		return "ERROR: SET requires key and value"
+// execute looks up and runs a command that bypasses the checks made by
+// ProcessCommand, such as one applied from the replication stream or
+// queued in a transaction. The caller must hold e.mu.
+func (e *Executor) execute(sess *Session, parts []string) protocol.Reply {
+	c, invalid := lookupCommand(parts)
+	if c == nil {
+		return invalid
 	}
+	e.selectDB(sess.db)
+	return c.handler(e, sess, parts)
+}
 
+func (e *Executor) handleSet(parts []string) protocol.Reply {
 	key := parts[1]
 	value := strings.Join(parts[2:], " ")
 
 	if err := e.storage.Set(key, value); err != nil {
+		if err == storage.ErrOOM {
+			return protocol.Error(err.Error())
+		}
 		logger.Error("SET failed: %v", err)
-		return fmt.Sprintf("ERROR: %v", err)
+		return protocol.Errorf("ERR %v", err)
 	}
 
-	return "OK"
+	e.notifyKeyspaceEvent(notifyString, "set", key)
+	e.propagate("SET", key, value)
+	return protocol.OK
 }
 
-func (e *Executor) handleGet(parts []string) string {
-	if len(parts) < 2 {
-		return "ERROR: GET requires key"
-	}
-
+func (e *Executor) handleGet(parts []string) protocol.Reply {
 	key := parts[1]
 	value, err := e.storage.Get(key)
 	if err == storage.ErrKeyNotFound {
-		return "(nil)"
+		e.stats.keyspaceMisses++
+		return protocol.Nil
 	}
 	if err != nil {
 		logger.Error("GET failed: %v", err)
-		return fmt.Sprintf("ERROR: %v", err)
+		return protocol.Errorf("ERR %v", err)
 	}
 
-	return value
+	e.stats.keyspaceHits++
+	return protocol.Bulk(value)
 }
 
-func (e *Executor) handleDelete(parts []string) string {
-	if len(parts) < 2 {
-		return "ERROR: DELETE requires key"
+// handleDelete implements DEL key [key ...] and returns how many of the
+// keys existed
+func (e *Executor) handleDelete(parts []string) protocol.Reply {
+	var deleted int64
+	for _, key := range parts[1:] {
+		if err := e.storage.Delete(key); err != nil {
+			if err == storage.ErrKeyNotFound {
+				continue
+			}
+			logger.Error("DELETE failed: %v", err)
+			return protocol.Errorf("ERR %v", err)
+		}
+
+		e.notifyKeyspaceEvent(notifyGeneric, "del", key)
+		e.propagate("DEL", key)
+		deleted++
 	}
+	return protocol.Integer(deleted)
+}
 
+func (e *Executor) handleExists(parts []string) protocol.Reply {
 	key := parts[1]
-	if err := e.storage.Delete(key); err != nil {
-		if err == storage.ErrKeyNotFound {
-			return "0"
-		}
-		logger.Error("DELETE failed: %v", err)
-		return fmt.Sprintf("ERROR: %v", err)
+	if e.storage.Exists(key) {
+		return protocol.One
 	}
+	return protocol.Zero
+}
 
-	return "1"
+// handlePing implements PING [message]
+func (e *Executor) handlePing(parts []string) protocol.Reply {
+	if len(parts) > 1 {
+		return protocol.Bulk(strings.Join(parts[1:], " "))
+	}
+	return protocol.Status("PONG")
+}
+
+// handleKeys implements KEYS [pattern]
+func (e *Executor) handleKeys(parts []string) protocol.Reply {
+	if len(parts) > 2 {
+		return protocol.Error("ERR syntax error")
+	}
+	keys := e.storage.Keys()
+	if len(parts) == 1 {
+		return protocol.BulkArray(keys)
+	}
+	matched := []string{}
+	for _, key := range keys {
+		if glob.Match(parts[1], key) {
+			matched = append(matched, key)
+		}
+	}
+	return protocol.BulkArray(matched)
 }
 
-func (e *Executor) handleExists(parts []string) string {
-	if len(parts) < 2 {
-		return "ERROR: EXISTS requires key"
+// handleScan implements SCAN cursor [MATCH pattern] [COUNT count]. Keys
+// are visited in the order of their hash and the cursor is the hash to
+// resume from, so a key present for the whole iteration is returned
+// exactly once however the keyspace changes in between.
+func (e *Executor) handleScan(parts []string) protocol.Reply {
+	cursor, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return protocol.Errorf("ERR invalid cursor '%s'", parts[1])
+	}
+
+	pattern, count := "*", 10
+	for i := 2; i < len(parts); i += 2 {
+		if i+1 == len(parts) {
+			return protocol.Error("ERR syntax error")
+		}
+		switch strings.ToUpper(parts[i]) {
+		case "MATCH":
+			pattern = parts[i+1]
+		case "COUNT":
+			n, err := strconv.Atoi(parts[i+1])
+			if err != nil || n < 1 {
+				return protocol.Errorf("ERR invalid count '%s'", parts[i+1])
+			}
+			count = n
+		default:
+			return protocol.Error("ERR syntax error")
+		}
 	}
 
+	type entry struct {
+		hash uint64
+		key  string
+	}
+	var entries []entry
+	for _, key := range e.storage.Keys() {
+		if h := scanHash(key); h >= cursor {
+			entries = append(entries, entry{h, key})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].hash < entries[j].hash })
+
+	// Keys sharing a hash can't be told apart by the cursor, so a batch
+	// never ends between them
+	n := min(count, len(entries))
+	for n > 0 && n < len(entries) && entries[n].hash == entries[n-1].hash {
+		n++
+	}
+	var next uint64
+	if n < len(entries) {
+		next = entries[n].hash
+	}
+
+	keys := []string{}
+	for _, ent := range entries[:n] {
+		if glob.Match(pattern, ent.key) {
+			keys = append(keys, ent.key)
+		}
+	}
+	return protocol.Array(protocol.Bulk(strconv.FormatUint(next, 10)), protocol.BulkArray(keys))
+}
+
+// scanHash orders keys for SCAN. It is never 0, the cursor that starts
+// and ends an iteration.
+func scanHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return h.Sum64() | 1
+}
+
+// handleIncr implements INCR and DECR, and INCRBY and DECRBY if by is set.
+// sign is -1 for the DECR forms. A missing key counts as 0 and the key
+// keeps its TTL.
+func (e *Executor) handleIncr(parts []string, sign int64, by bool) protocol.Reply {
 	key := parts[1]
-	if e.storage.Exists(key) {
-		return "1"
+	delta := int64(1)
+	if by {
+		d, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil || (sign < 0 && d == math.MinInt64) {
+			return protocol.Error("ERR value is not an integer or out of range")
+		}
+		delta = d
+	}
+	delta *= sign
+
+	var n int64
+	value, err := e.storage.Get(key)
+	switch {
+	case err == storage.ErrKeyNotFound:
+	case err != nil:
+		return protocol.Errorf("ERR %v", err)
+	default:
+		if n, err = strconv.ParseInt(value, 10, 64); err != nil {
+			return protocol.Error("ERR value is not an integer or out of range")
+		}
+	}
+	if (delta > 0 && n > math.MaxInt64-delta) || (delta < 0 && n < math.MinInt64-delta) {
+		return protocol.Error("ERR increment or decrement would overflow")
+	}
+	n += delta
+
+	// The key keeps its TTL, which replicas get back after the SET
+	ttl, hasTTL, _ := e.storage.TTL(key)
+	value = strconv.FormatInt(n, 10)
+	if err := e.storage.SetKeepTTL(key, value); err != nil {
+		if err == storage.ErrOOM {
+			return protocol.Error(err.Error())
+		}
+		logger.Error("%s failed: %v", parts[0], err)
+		return protocol.Errorf("ERR %v", err)
 	}
-	return "0"
+	e.propagate("SET", key, value)
+	if hasTTL {
+		at := time.Now().Add(ttl)
+		e.propagate("PEXPIREAT", key, strconv.FormatInt(at.UnixMilli(), 10))
+	}
+
+	e.notifyKeyspaceEvent(notifyString, "incrby", key)
+	return protocol.Integer(n)
 }
 
-func (e *Executor) handleKeys() string {
-	keys := e.storage.Keys()
-	if len(keys) == 0 {
-		return "(empty list)"
+// handleRename implements RENAME key newkey, and RENAMENX key newkey if
+// nx is set, which leaves an existing newkey alone. The key keeps its TTL.
+func (e *Executor) handleRename(parts []string, nx bool) protocol.Reply {
+	key, newkey := parts[1], parts[2]
+	if !e.storage.Exists(key) {
+		return protocol.Error("ERR no such key")
+	}
+	if nx && e.storage.Exists(newkey) {
+		return protocol.Zero
+	}
+
+	if err := e.storage.Rename(key, newkey); err != nil {
+		return protocol.Errorf("ERR %v", err)
+	}
+	if key != newkey {
+		e.notifyKeyspaceEvent(notifyGeneric, "rename_from", key)
+		e.notifyKeyspaceEvent(notifyGeneric, "rename_to", newkey)
+		e.propagate("RENAME", key, newkey)
+	}
+
+	if nx {
+		return protocol.One
+	}
+	return protocol.OK
+}
+
+// handleCopy implements COPY source destination [DB db] [REPLACE]. The
+// copy keeps the source's TTL.
+func (e *Executor) handleCopy(parts []string) protocol.Reply {
+	key, newkey := parts[1], parts[2]
+	db, replace := e.db, false
+	for i := 3; i < len(parts); i++ {
+		switch {
+		case strings.EqualFold(parts[i], "REPLACE"):
+			replace = true
+		case strings.EqualFold(parts[i], "DB") && i+1 < len(parts):
+			i++
+			n, invalid := parseDB(parts[i])
+			if invalid.IsError() {
+				return invalid
+			}
+			db = n
+		default:
+			return protocol.Error("ERR syntax error")
+		}
+	}
+	if db == e.db && key == newkey {
+		return protocol.Error("ERR source and destination objects are the same")
+	}
+	if e.cluster != nil && db != 0 {
+		return protocol.Error("ERR Copying to another database is not allowed in cluster mode")
+	}
+
+	switch err := e.storage.Copy(key, db, newkey, replace); err {
+	case nil:
+	case storage.ErrKeyNotFound, storage.ErrKeyExists:
+		return protocol.Zero
+	case storage.ErrOOM:
+		return protocol.Error(err.Error())
+	default:
+		return protocol.Errorf("ERR %v", err)
+	}
+
+	// Replicas always replace, since the copy already succeeded here
+	e.propagate("COPY", key, newkey, "DB", strconv.Itoa(db), "REPLACE")
+
+	from := e.db
+	e.db = db
+	e.notifyKeyspaceEvent(notifyGeneric, "copy_to", newkey)
+	e.db = from
+	return protocol.One
+}
+
+// handleType implements TYPE key. Every value is a string.
+func (e *Executor) handleType(parts []string) protocol.Reply {
+	if !e.storage.Exists(parts[1]) {
+		return protocol.Status("none")
+	}
+	return protocol.Status("string")
+}
+
+func (e *Executor) handleRandomKey() protocol.Reply {
+	key, err := e.storage.RandomKey()
+	if err != nil {
+		return protocol.Nil
+	}
+	return protocol.Bulk(key)
+}
+
+// handleTouch implements TOUCH key [key ...], which counts as an access
+// for eviction and returns how many of the keys exist
+func (e *Executor) handleTouch(parts []string) protocol.Reply {
+	touched := 0
+	for _, key := range parts[1:] {
+		if e.storage.Touch(key) {
+			touched++
+		}
+	}
+	return protocol.Integer(int64(touched))
+}
+
+// handleObject implements OBJECT ENCODING, IDLETIME and FREQ
+func (e *Executor) handleObject(parts []string) protocol.Reply {
+	info, err := e.storage.Object(parts[2])
+	if err != nil {
+		return protocol.Nil
+	}
+
+	lfu := e.storage.EvictionPolicy() == storage.AllKeysLFU
+	switch strings.ToUpper(parts[1]) {
+	case "ENCODING":
+		return protocol.Bulk(encoding(info.Value))
+	case "IDLETIME":
+		if lfu {
+			return protocol.Error("ERR An LFU maxmemory policy is selected, idle time not tracked")
+		}
+		return protocol.Integer(int64(info.Idle.Seconds()))
+	case "FREQ":
+		if !lfu {
+			return protocol.Error("ERR An LFU maxmemory policy is not selected, access frequency not tracked")
+		}
+		return protocol.Integer(int64(info.Freq))
+	default:
+		return protocol.Errorf("ERR unknown OBJECT subcommand '%s'", parts[1])
+	}
+}
+
+// encoding names the representation OBJECT ENCODING reports for value,
+// following Redis: int for integers, embstr for short strings and raw
+// for the rest
+func encoding(value string) string {
+	if _, err := strconv.ParseInt(value, 10, 64); err == nil && len(value) <= 20 {
+		return "int"
+	}
+	if len(value) <= 44 {
+		return "embstr"
 	}
-	return strings.Join(keys, "\n")
+	return "raw"
 }
@@ -0,0 +1,267 @@
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"memkv/internal/config"
+	"memkv/internal/glob"
+	"memkv/internal/logger"
+	"memkv/internal/protocol"
+	"memkv/internal/storage"
+	"memkv/internal/wal"
+)
+
+// configParam is a parameter exposed through CONFIG GET/SET. set parses
+// and validates the value and returns a function applying it, so that
+// CONFIG SET can check every value before changing anything. All
+// functions run with e.mu held.
+type configParam struct {
+	get func(e *Executor) string
+	set func(e *Executor, value string) (apply func(), err error)
+}
+
+// configParams are the parameters that can be changed at runtime
+var configParams = map[string]configParam{
+	"loglevel": {
+		get: func(e *Executor) string { return logger.DefaultLevel().String() },
+		set: func(e *Executor, value string) (func(), error) {
+			level, err := logger.ParseLevel(value)
+			if err != nil {
+				return nil, err
+			}
+			return func() { logger.SetDefaultLevel(level) }, nil
+		},
+	},
+	"slowlog-log-slower-than": {
+		get: func(e *Executor) string {
+			e.slowlog.mu.Lock()
+			defer e.slowlog.mu.Unlock()
+			return strconv.FormatInt(e.slowlog.threshold, 10)
+		},
+		set: func(e *Executor, value string) (func(), error) {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid threshold '%s'", value)
+			}
+			return func() { e.SetSlowlogThreshold(n) }, nil
+		},
+	},
+	"slowlog-max-len": {
+		get: func(e *Executor) string {
+			e.slowlog.mu.Lock()
+			defer e.slowlog.mu.Unlock()
+			return strconv.Itoa(e.slowlog.maxLen)
+		},
+		set: func(e *Executor, value string) (func(), error) {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid length '%s'", value)
+			}
+			return func() { e.SetSlowlogMaxLen(n) }, nil
+		},
+	},
+	"maxmemory": {
+		get: func(e *Executor) string { return strconv.FormatInt(e.storage.MaxMemory(), 10) },
+		set: func(e *Executor, value string) (func(), error) {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid memory limit '%s'", value)
+			}
+			return func() { e.storage.SetMaxMemory(n) }, nil
+		},
+	},
+	"maxmemory-policy": {
+		get: func(e *Executor) string { return string(e.storage.EvictionPolicy()) },
+		set: func(e *Executor, value string) (func(), error) {
+			policy, err := storage.ParseEvictionPolicy(value)
+			if err != nil {
+				return nil, err
+			}
+			return func() { e.storage.SetEvictionPolicy(policy) }, nil
+		},
+	},
+	"appendfsync": {
+		get: func(e *Executor) string { return string(e.storage.SyncPolicy()) },
+		set: func(e *Executor, value string) (func(), error) {
+			policy, err := wal.ParseSyncPolicy(value)
+			if err != nil {
+				return nil, err
+			}
+			return func() { e.storage.SetSyncPolicy(policy) }, nil
+		},
+	},
+	"timeout": {
+		get: func(e *Executor) string { return strconv.FormatInt(int64(e.idleTimeout/time.Second), 10) },
+		set: func(e *Executor, value string) (func(), error) {
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid timeout '%s'", value)
+			}
+			return func() { e.idleTimeout = time.Duration(n) * time.Second }, nil
+		},
+	},
+	"notify-keyspace-events": {
+		get: func(e *Executor) string { return e.NotifyKeyspaceEvents() },
+		set: func(e *Executor, value string) (func(), error) {
+			classes, err := parseNotifyFlags(value)
+			if err != nil {
+				return nil, err
+			}
+			return func() { e.notifyClasses = classes }, nil
+		},
+	},
+}
+
+// SetConfigFile sets the file CONFIG REWRITE writes to
+func (e *Executor) SetConfigFile(path string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.configFile = path
+}
+
+// SetReadOnlyConfig exposes a startup setting through CONFIG GET
+func (e *Executor) SetReadOnlyConfig(name, value string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.readOnlyConfig[name] = value
+}
+
+// SetFsyncPolicy sets the WAL fsync policy by name
+func (e *Executor) SetFsyncPolicy(name string) error {
+	policy, err := wal.ParseSyncPolicy(name)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.storage.SetSyncPolicy(policy)
+	return nil
+}
+
+// SetIdleTimeout closes clients idle for longer than d (0 disables it)
+func (e *Executor) SetIdleTimeout(d time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.idleTimeout = d
+}
+
+// configValues returns the current value of every parameter. The caller
+// must hold e.mu.
+func (e *Executor) configValues() map[string]string {
+	values := make(map[string]string, len(configParams)+len(e.readOnlyConfig))
+	for name, value := range e.readOnlyConfig {
+		values[name] = value
+	}
+	for name, param := range configParams {
+		values[name] = param.get(e)
+	}
+	return values
+}
+
+// handleConfig implements CONFIG GET/SET/RESETSTAT/REWRITE
+func (e *Executor) handleConfig(parts []string) protocol.Reply {
+	switch strings.ToUpper(parts[1]) {
+	case "GET":
+		return e.handleConfigGet(parts[2:])
+	case "SET":
+		if len(parts) < 4 || len(parts)%2 != 0 {
+			return protocol.Error("ERR CONFIG SET requires parameter and value pairs")
+		}
+		return e.handleConfigSet(parts[2:])
+	case "RESETSTAT":
+		e.resetStats()
+		return protocol.OK
+	case "REWRITE":
+		if e.configFile == "" {
+			return protocol.Error("ERR The server is running without a config file")
+		}
+		if err := e.rewriteConfig(); err != nil {
+			logger.Error("CONFIG REWRITE failed: %v", err)
+			return protocol.Errorf("ERR %v", err)
+		}
+		return protocol.OK
+	default:
+		return protocol.Errorf("ERR unknown CONFIG subcommand '%s'", parts[1])
+	}
+}
+
+// handleConfigGet replies with the name and value of every parameter
+// matching one of the patterns
+func (e *Executor) handleConfigGet(patterns []string) protocol.Reply {
+	values := e.configValues()
+
+	var lines []string
+	for _, name := range sortedKeys(values) {
+		for _, pattern := range patterns {
+			if glob.Match(strings.ToLower(pattern), name) {
+				lines = append(lines, name, values[name])
+				break
+			}
+		}
+	}
+	return protocol.BulkArray(lines)
+}
+
+// handleConfigSet parses and validates every value before changing any
+// parameter, so a bad value leaves the configuration untouched
+func (e *Executor) handleConfigSet(args []string) protocol.Reply {
+	applies := make([]func(), 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		name, value := strings.ToLower(args[i]), args[i+1]
+		param, ok := configParams[name]
+		if !ok {
+			if _, ok := e.readOnlyConfig[name]; ok {
+				return protocol.Errorf("ERR parameter '%s' can't be set at runtime", name)
+			}
+			return protocol.Errorf("ERR unknown parameter '%s'", name)
+		}
+		if value == `""` {
+			value = ""
+		}
+		apply, err := param.set(e, value)
+		if err != nil {
+			return protocol.Errorf("ERR CONFIG SET %s: %v", name, err)
+		}
+		applies = append(applies, apply)
+	}
+
+	for i, apply := range applies {
+		apply()
+		logger.Info("CONFIG SET %s %s", strings.ToLower(args[2*i]), args[2*i+1])
+	}
+	return protocol.OK
+}
+
+// rewriteConfig persists the runtime parameters to the config file. The
+// caller must hold e.mu.
+func (e *Executor) rewriteConfig() error {
+	values := e.configValues()
+	return config.Rewrite(e.configFile, values, sortedKeys(configParams))
+}
+
+// resetStats clears the counters reported by INFO. The caller must hold e.mu.
+func (e *Executor) resetStats() {
+	e.stats.commands.Store(0)
+	e.stats.connections = 0
+	e.stats.expiredKeys = 0
+	e.stats.evictedKeys = 0
+	e.stats.keyspaceHits = 0
+	e.stats.keyspaceMisses = 0
+	e.stats.ops = [opsSamples]int64{}
+	e.stats.lastSample = time.Time{}
+	e.stats.lastCommands = 0
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,176 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"memkv/internal/protocol"
+	"memkv/internal/raft"
+)
+
+// raftTimeout bounds how long a client waits for a write to commit
+const raftTimeout = 5 * time.Second
+
+// EnableRaft routes all writes through a Raft cluster. The local dataset
+// is rebuilt from the Raft snapshot and log kept in cfg.LogPath, so the
+// executor must start empty, from NewWithWAL with a wal.DiscardWAL, and
+// EnableRaft be called before the server accepts connections.
+func (e *Executor) EnableRaft(cfg raft.Config) error {
+	node, err := raft.NewNode(cfg, &raftFSM{e: e})
+	if err != nil {
+		return err
+	}
+	e.raft = node
+	return nil
+}
+
+// proposeWrite replicates a write command and returns its reply once a
+// majority has committed it. Non-leaders redirect the client. Writes to
+// a database other than 0 are preceded by a SELECT in the same entry.
+func (e *Executor) proposeWrite(sess *Session, parts []string) protocol.Reply {
+	entry := strings.Join(absoluteExpiry(parts), " ")
+	if sess.db != 0 {
+		entry = fmt.Sprintf("SELECT %d\n%s", sess.db, entry)
+	}
+	result, err := e.raft.Propose(entry, raftTimeout)
+	if err != nil {
+		return raftError(err)
+	}
+	reply, err := protocol.Parse(result)
+	if err != nil {
+		return protocol.Errorf("ERR %v", err)
+	}
+	return reply
+}
+
+// absoluteExpiry rewrites EXPIRE and PEXPIRE into PEXPIREAT, so that
+// every node, and every replay of the log after a restart, agrees on the
+// deadline. Other commands are returned as they are.
+func absoluteExpiry(parts []string) []string {
+	var unit time.Duration
+	switch strings.ToUpper(parts[0]) {
+	case "EXPIRE":
+		unit = time.Second
+	case "PEXPIRE":
+		unit = time.Millisecond
+	default:
+		return parts
+	}
+
+	// An invalid time is left for handleExpire to reject when applied
+	n, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return parts
+	}
+	at := time.Now().Add(time.Duration(n) * unit).UnixMilli()
+	return []string{"PEXPIREAT", parts[1], strconv.FormatInt(at, 10)}
+}
+
+func raftError(err error) protocol.Reply {
+	var notLeader *raft.NotLeaderError
+	if errors.As(err, &notLeader) {
+		if notLeader.LeaderAddr == "" {
+			return protocol.Error("NOTLEADER leader unknown, retry later")
+		}
+		return protocol.Error("NOTLEADER " + notLeader.LeaderAddr)
+	}
+	return protocol.Errorf("ERR %v", err)
+}
+
+func (e *Executor) handleRaft(parts []string) protocol.Reply {
+	switch strings.ToUpper(parts[1]) {
+	case "STATUS":
+		st := e.raft.Status()
+		ids := make([]string, 0, len(st.Members))
+		for id := range st.Members {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		lines := []string{
+			"id:" + st.ID,
+			"role:" + st.Role,
+			fmt.Sprintf("term:%d", st.Term),
+			"leader:" + st.Leader,
+			"leader_addr:" + st.LeaderAddr,
+			fmt.Sprintf("commit_index:%d", st.CommitIndex),
+			fmt.Sprintf("last_applied:%d", st.LastApplied),
+			fmt.Sprintf("last_index:%d", st.LastIndex),
+		}
+		for _, id := range ids {
+			lines = append(lines, fmt.Sprintf("member:%s=%s", id, st.Members[id]))
+		}
+		return protocol.Bulk(strings.Join(lines, "\n"))
+	case "ADD":
+		if err := e.raft.AddMember(parts[2], parts[3], raftTimeout); err != nil {
+			return raftError(err)
+		}
+		return protocol.OK
+	case "REMOVE":
+		if err := e.raft.RemoveMember(parts[2], raftTimeout); err != nil {
+			return raftError(err)
+		}
+		return protocol.OK
+	default:
+		return protocol.Errorf("ERR unknown RAFT subcommand '%s'", parts[1])
+	}
+}
+
+// raftFSM applies committed Raft entries to the executor's storage
+type raftFSM struct {
+	e *Executor
+}
+
+// Apply returns the wire encoding of the reply, which proposeWrite
+// decodes for the client
+func (f *raftFSM) Apply(cmd string) string {
+	f.e.mu.Lock()
+	defer f.e.mu.Unlock()
+
+	// The reply is the last command's, after any SELECT
+	reply := protocol.Error("ERR empty command")
+	sess := &Session{master: true}
+	for _, line := range strings.Split(cmd, "\n") {
+		if parts := strings.Fields(line); len(parts) > 0 {
+			reply = f.e.execute(sess, parts)
+		}
+	}
+	return string(reply.Bytes())
+}
+
+func (f *raftFSM) Snapshot() (string, error) {
+	f.e.mu.Lock()
+	defer f.e.mu.Unlock()
+
+	var b strings.Builder
+	for _, cmd := range f.e.dumpCommands() {
+		b.WriteString(strings.Join(cmd, " "))
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+func (f *raftFSM) Restore(data string) error {
+	f.e.mu.Lock()
+	defer f.e.mu.Unlock()
+
+	if err := f.e.storage.Clear(); err != nil {
+		return err
+	}
+
+	sess := &Session{master: true}
+	for _, line := range strings.Split(data, "\n") {
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		if reply := f.e.execute(sess, parts); reply.IsError() {
+			return fmt.Errorf("failed to restore %q: %s", line, reply)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package executor
+
+import (
+	"strconv"
+	"time"
+
+	"memkv/internal/protocol"
+	"memkv/internal/storage"
+)
+
+// selectDB makes storage operations and propagated writes apply to
+// database db. The caller must hold e.mu.
+func (e *Executor) selectDB(db int) {
+	e.storage.Select(db)
+	e.db = db
+}
+
+// parseDB parses a database index
+func parseDB(s string) (int, protocol.Reply) {
+	db, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, protocol.Error("ERR value is not an integer or out of range")
+	}
+	if db < 0 || db >= storage.Databases {
+		return 0, protocol.Error("ERR DB index is out of range")
+	}
+	return db, protocol.OK
+}
+
+// handleSelect implements SELECT db, which switches the connection's database
+func (e *Executor) handleSelect(sess *Session, parts []string) protocol.Reply {
+	db, invalid := parseDB(parts[1])
+	if invalid.IsError() {
+		return invalid
+	}
+	if e.cluster != nil && db != 0 {
+		return protocol.Error("ERR SELECT is not allowed in cluster mode")
+	}
+	sess.db = db
+	e.selectDB(db)
+	return protocol.OK
+}
+
+// handleMove implements MOVE key db
+func (e *Executor) handleMove(parts []string) protocol.Reply {
+	key := parts[1]
+	db, invalid := parseDB(parts[2])
+	if invalid.IsError() {
+		return invalid
+	}
+	if db == e.db {
+		return protocol.Error("ERR source and destination objects are the same")
+	}
+
+	switch err := e.storage.Move(key, db); err {
+	case nil:
+	case storage.ErrKeyNotFound, storage.ErrKeyExists:
+		return protocol.Zero
+	default:
+		return protocol.Errorf("ERR %v", err)
+	}
+
+	e.notifyKeyspaceEvent(notifyGeneric, "move_from", key)
+	e.propagate("MOVE", key, parts[2])
+
+	from := e.db
+	e.db = db
+	e.notifyKeyspaceEvent(notifyGeneric, "move_to", key)
+	e.db = from
+	return protocol.One
+}
+
+// handleSwapDB implements SWAPDB a b. Connections using either database
+// see the other's data from then on.
+func (e *Executor) handleSwapDB(parts []string) protocol.Reply {
+	a, invalid := parseDB(parts[1])
+	if invalid.IsError() {
+		return invalid
+	}
+	b, invalid := parseDB(parts[2])
+	if invalid.IsError() {
+		return invalid
+	}
+	if e.cluster != nil {
+		return protocol.Error("ERR SWAPDB is not allowed in cluster mode")
+	}
+
+	if err := e.storage.SwapDB(a, b); err != nil {
+		return protocol.Errorf("ERR %v", err)
+	}
+	e.propagate("SWAPDB", parts[1], parts[2])
+	return protocol.OK
+}
+
+func (e *Executor) handleDBSize() protocol.Reply {
+	return protocol.Integer(int64(e.storage.DBSize(e.db)))
+}
+
+// handleFlushDB implements FLUSHDB, which empties the connection's database
+func (e *Executor) handleFlushDB() protocol.Reply {
+	if err := e.storage.FlushDB(); err != nil {
+		return protocol.Errorf("ERR %v", err)
+	}
+	e.propagate("FLUSHDB")
+	return protocol.OK
+}
+
+// handleFlushAll implements FLUSHALL, which empties every database. The
+// WAL is truncated since nothing before it matters any more.
+func (e *Executor) handleFlushAll() protocol.Reply {
+	if err := e.storage.Clear(); err != nil {
+		return protocol.Errorf("ERR %v", err)
+	}
+	e.propagate("FLUSHALL")
+	return protocol.OK
+}
+
+// dumpCommands returns the commands that rebuild the dataset: a SELECT
+// for every database holding keys, followed by a SET for each key and a
+// PEXPIREAT for those with a TTL. The caller must hold e.mu.
+func (e *Executor) dumpCommands() [][]string {
+	defer e.selectDB(e.db)
+
+	var cmds [][]string
+	for db := 0; db < storage.Databases; db++ {
+		if e.storage.DBSize(db) == 0 {
+			continue
+		}
+		e.storage.Select(db)
+		cmds = append(cmds, []string{"SELECT", strconv.Itoa(db)})
+		for _, key := range e.storage.Keys() {
+			value, err := e.storage.Get(key)
+			if err != nil {
+				continue
+			}
+			cmds = append(cmds, []string{"SET", key, value})
+			if ttl, ok, _ := e.storage.TTL(key); ok {
+				at := time.Now().Add(ttl).UnixMilli()
+				cmds = append(cmds, []string{"PEXPIREAT", key, strconv.FormatInt(at, 10)})
+			}
+		}
+	}
+	return cmds
+}
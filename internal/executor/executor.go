@@ -1,32 +1,178 @@
 package executor
 
 import (
+	"crypto/tls"
 	"fmt"
+	"sync"
+	"time"
 
+	"memkv/internal/acl"
+	"memkv/internal/cluster"
 	"memkv/internal/logger"
+	"memkv/internal/pubsub"
+	"memkv/internal/raft"
+	"memkv/internal/replication"
 	"memkv/internal/storage"
+	"memkv/internal/wal"
 )
 
 // Executor handles command execution
 type Executor struct {
+	// mu serializes command execution between the event loop and
+	// background goroutines such as the replication link
+	mu sync.Mutex
+
 	storage storage.Storage
+	db      int // database of the running command, see selectDB
+	pubsub  *pubsub.Hub
+	acl     *acl.Store
+
+	// sessions are the connected clients
+	sessions     map[*Session]struct{}
+	nextClientID int64
+	pause        clientPause
+	monitors     map[*Session]struct{}
+	stats        stats
+	slowlog      *slowLog
+
+	// Runtime configuration (see config.go)
+	configFile     string
+	readOnlyConfig map[string]string
+	idleTimeout    time.Duration
+
+	// notifyClasses selects the keyspace events published to subscribers
+	notifyClasses int
+
+	// Leader side of replication
+	replID   string
+	backlog  *replication.Backlog
+	replicas map[*Session]struct{}
+	replDB   int // database last selected in the replication stream, -1 if none
+
+	// follower is set while this server replicates from a leader, which
+	// it authenticates with as masterUser with masterAuth if set
+	follower   *replication.Follower
+	masterUser string
+	masterAuth string
+
+	// tlsClient, if set, secures replication and MIGRATE connections
+	tlsClient *tls.Config
+
+	// raft is set when writes go through Raft consensus
+	raft *raft.Node
+
+	// cluster is set in cluster mode and tracks hash slot ownership,
+	// saved to clusterConfigFile after every change
+	cluster           *cluster.State
+	clusterConfigFile string
+
+	done chan struct{}
 }
 
 // New creates a new executor with Persistant In-Memory Storage.
 func New(walPath string) (*Executor, error) {
-	store, err := storage.NewPersistentStorage(walPath)
+	w, err := wal.NewFileWAL(walPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create storage: %w", err)
+	}
+	return NewWithWAL(w)
+}
+
+// NewWithWAL creates an executor whose storage is recovered from and
+// logs writes to w. Under Raft it is a wal.DiscardWAL, since the Raft
+// log in the server's WAL is what makes writes durable.
+func NewWithWAL(w wal.WAL) (*Executor, error) {
+	start := time.Now()
+	store, err := storage.NewPersistentStorageWithWAL(w)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create storage: %w", err)
 	}
+	replayDurationMetric.Set(time.Since(start).Seconds())
+	keysMetric.Set(float64(store.Size()))
 
 	logger.Info("Recovered %d keys from WAL", store.Size())
 
-	return &Executor{
-		storage: store,
-	}, nil
+	e := &Executor{
+		storage:  store,
+		pubsub:   pubsub.NewHub(),
+		acl:      acl.New(commandCategories),
+		replID:   newReplID(),
+		backlog:  replication.NewBacklog(replication.DefaultBacklogSize, 0),
+		sessions: make(map[*Session]struct{}),
+		monitors: make(map[*Session]struct{}),
+		slowlog:  newSlowLog(),
+		replicas: make(map[*Session]struct{}),
+		replDB:   -1,
+		done:     make(chan struct{}),
+
+		readOnlyConfig: make(map[string]string),
+	}
+	store.SetRemoveHook(e.keyRemoved)
+	e.stats.startTime = time.Now()
+
+	go e.cron()
+
+	return e, nil
+}
+
+// cron runs periodic background work: reclaiming expired keys that are
+// never accessed, sampling the command rate, once per second syncing the
+// WAL and closing idle clients, and pinging replicas
+func (e *Executor) cron() {
+	ticker := time.NewTicker(activeExpireInterval)
+	defer ticker.Stop()
+
+	var lastSecond, lastPing time.Time
+	for {
+		var now time.Time
+		select {
+		case <-e.done:
+			return
+		case now = <-ticker.C:
+		}
+
+		// Keep sampling while a large share of the sample was expired.
+		// The dataset is left untouched while clients are paused.
+		e.mu.Lock()
+		for !e.paused() {
+			if e.storage.ExpireCycle(activeExpireSamples) <= activeExpireSamples/4 {
+				break
+			}
+		}
+		e.stats.sampleOps(now)
+		keysMetric.Set(float64(e.storage.Size()))
+
+		if now.Sub(lastSecond) >= time.Second {
+			lastSecond = now
+			if e.storage.SyncPolicy() == wal.SyncEverySec {
+				if err := e.storage.Sync(); err != nil {
+					logger.Error("WAL sync failed: %v", err)
+				}
+			}
+			e.closeIdleClients(now)
+		}
+		if now.Sub(lastPing) >= replication.PingInterval {
+			lastPing = now
+			e.pingReplicas()
+		}
+		e.mu.Unlock()
+	}
 }
 
 // Close closes the executor and its resources
 func (e *Executor) Close() error {
+	// Stopped before taking e.mu so in-flight applies can finish
+	if e.raft != nil {
+		e.raft.Close()
+	}
+	close(e.done)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.follower != nil {
+		e.follower.Close()
+		e.follower = nil
+	}
 	return e.storage.Close()
 }
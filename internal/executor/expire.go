@@ -0,0 +1,114 @@
+package executor
+
+import (
+	"strconv"
+	"time"
+
+	"memkv/internal/protocol"
+	"memkv/internal/storage"
+)
+
+const (
+	activeExpireInterval = 100 * time.Millisecond
+	activeExpireSamples  = 20
+)
+
+// handleExpire implements EXPIRE, PEXPIRE (relative, in unit) and
+// PEXPIREAT (absolute unix milliseconds)
+func (e *Executor) handleExpire(parts []string, unit time.Duration, absolute bool) protocol.Reply {
+	key := parts[1]
+	n, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return protocol.Errorf("ERR invalid time '%s'", parts[2])
+	}
+
+	at := time.UnixMilli(n)
+	if !absolute {
+		at = time.Now().Add(time.Duration(n) * unit)
+	}
+
+	if err := e.storage.Expire(key, at); err != nil {
+		if err == storage.ErrKeyNotFound {
+			return protocol.Zero
+		}
+		return protocol.Errorf("ERR %v", err)
+	}
+
+	// Replicas get the absolute time so they agree on the deadline
+	e.notifyKeyspaceEvent(notifyGeneric, "expire", key)
+	e.propagate("PEXPIREAT", key, strconv.FormatInt(at.UnixMilli(), 10))
+	return protocol.One
+}
+
+// handleTTL implements TTL and PTTL: -2 if the key is missing, -1 if it
+// has no expiry
+func (e *Executor) handleTTL(parts []string, unit time.Duration) protocol.Reply {
+	ttl, ok, err := e.storage.TTL(parts[1])
+	if err == storage.ErrKeyNotFound {
+		return protocol.Integer(-2)
+	}
+	if err != nil {
+		return protocol.Errorf("ERR %v", err)
+	}
+	if !ok {
+		return protocol.Integer(-1)
+	}
+
+	// Round up so a key with time left never reports 0
+	return protocol.Integer(int64((ttl + unit - 1) / unit))
+}
+
+func (e *Executor) handlePersist(parts []string) protocol.Reply {
+	key := parts[1]
+	removed, err := e.storage.Persist(key)
+	if err != nil && err != storage.ErrKeyNotFound {
+		return protocol.Errorf("ERR %v", err)
+	}
+	if !removed {
+		return protocol.Zero
+	}
+
+	e.notifyKeyspaceEvent(notifyGeneric, "persist", key)
+	e.propagate("PERSIST", key)
+	return protocol.One
+}
+
+// keyRemoved is called by storage for keys deleted by expiry or eviction.
+// It runs with e.mu held, inside the command or cycle that caused it.
+func (e *Executor) keyRemoved(db int, key string, cause storage.RemoveCause) {
+	// The key may be in another database than the running command's
+	defer func(running int) { e.db = running }(e.db)
+	e.db = db
+
+	switch cause {
+	case storage.RemoveExpired:
+		e.stats.expiredKeys++
+		expiredKeysMetric.Inc()
+		e.notifyKeyspaceEvent(notifyExpired, "expired", key)
+	case storage.RemoveEvicted:
+		e.stats.evictedKeys++
+		evictedKeysMetric.Inc()
+		e.notifyKeyspaceEvent(notifyEvicted, "evicted", key)
+	}
+	e.propagate("DEL", key)
+}
+
+// SetMaxMemory sets the memory limit in bytes (0 disables it)
+func (e *Executor) SetMaxMemory(bytes int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.storage.SetMaxMemory(bytes)
+}
+
+// SetMaxMemoryPolicy sets the eviction policy by name
+func (e *Executor) SetMaxMemoryPolicy(name string) error {
+	policy, err := storage.ParseEvictionPolicy(name)
+	if err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.storage.SetEvictionPolicy(policy)
+	return nil
+}
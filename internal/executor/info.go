@@ -0,0 +1,192 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"memkv/internal/protocol"
+	"memkv/internal/raft"
+	"memkv/internal/storage"
+)
+
+// Version is the server version reported by HELLO and INFO
+const Version = "1.0"
+
+// opsSamples is the number of command rate samples averaged for
+// instantaneous_ops_per_sec
+const opsSamples = 16
+
+// stats holds the counters reported by INFO. Apart from commands, which
+// is counted before e.mu is taken, fields are guarded by e.mu.
+type stats struct {
+	startTime   time.Time
+	commands    atomic.Int64
+	connections int64 // connections accepted since startup
+
+	expiredKeys    int64
+	evictedKeys    int64
+	keyspaceHits   int64
+	keyspaceMisses int64
+
+	// Ring of recent ops/sec samples taken by the cron
+	ops          [opsSamples]int64
+	opsIdx       int
+	lastSample   time.Time
+	lastCommands int64
+}
+
+// sampleOps records the command rate since the previous sample
+func (s *stats) sampleOps(now time.Time) {
+	commands := s.commands.Load()
+	if !s.lastSample.IsZero() {
+		if elapsed := now.Sub(s.lastSample); elapsed > 0 {
+			s.ops[s.opsIdx] = (commands - s.lastCommands) * int64(time.Second) / int64(elapsed)
+			s.opsIdx = (s.opsIdx + 1) % opsSamples
+		}
+	}
+	s.lastSample = now
+	s.lastCommands = commands
+}
+
+// opsPerSec returns the average of the recent rate samples
+func (s *stats) opsPerSec() int64 {
+	var sum int64
+	for _, n := range s.ops {
+		sum += n
+	}
+	return sum / opsSamples
+}
+
+// infoSections lists the INFO sections in the order they are reported
+var infoSections = []string{"server", "clients", "memory", "persistence", "stats", "replication", "keyspace"}
+
+// handleInfo implements INFO [section ...]
+func (e *Executor) handleInfo(parts []string) protocol.Reply {
+	selected := make(map[string]bool)
+	for _, name := range parts[1:] {
+		name = strings.ToLower(name)
+		switch name {
+		case "all", "default", "everything":
+			for _, s := range infoSections {
+				selected[s] = true
+			}
+		default:
+			selected[name] = true
+		}
+	}
+
+	var sections []string
+	for _, name := range infoSections {
+		if len(selected) > 0 && !selected[name] {
+			continue
+		}
+		sections = append(sections, e.infoSection(name))
+	}
+	return protocol.Bulk(strings.Join(sections, "\n\n"))
+}
+
+// infoSection renders one section as a header followed by field:value lines
+func (e *Executor) infoSection(name string) string {
+	var fields []string
+	add := func(field string, value any) {
+		fields = append(fields, fmt.Sprintf("%s:%v", field, value))
+	}
+
+	switch name {
+	case "server":
+		uptime := time.Since(e.stats.startTime)
+		add("memkv_version", Version)
+		add("go_version", runtime.Version())
+		add("os", runtime.GOOS+" "+runtime.GOARCH)
+		add("process_id", os.Getpid())
+		add("uptime_in_seconds", int64(uptime.Seconds()))
+		add("uptime_in_days", int64(uptime.Hours()/24))
+	case "clients":
+		subscribers := 0
+		for sess := range e.sessions {
+			if sess.Subscribed() {
+				subscribers++
+			}
+		}
+		add("connected_clients", len(e.sessions))
+		add("pubsub_clients", subscribers)
+	case "memory":
+		add("used_memory", e.storage.UsedMemory())
+		add("maxmemory", e.storage.MaxMemory())
+		add("maxmemory_policy", e.storage.EvictionPolicy())
+	case "persistence":
+		p := e.storage.Persistence()
+		var status raft.Status
+		if e.raft != nil {
+			// The WAL holds the Raft log rather than the dataset's writes
+			status = e.raft.Status()
+			p.WALSize, p.WAL = status.LogSize, status.LogStats
+		}
+		var avgSync time.Duration
+		if p.WAL.Syncs > 0 {
+			avgSync = p.WAL.SyncTime / time.Duration(p.WAL.Syncs)
+		}
+		add("wal_size", p.WALSize)
+		add("wal_bytes_written", p.WAL.BytesWritten)
+		// Raft compacts its log into snapshots; without Raft the closest
+		// equivalent is the last time FLUSHALL truncated the WAL
+		lastSnapshot := p.LastCompaction
+		if e.raft != nil {
+			lastSnapshot = status.LastSnapshot
+		}
+		add("last_snapshot_time", unixOrZero(lastSnapshot))
+		add("fsync_policy", e.storage.SyncPolicy())
+		add("fsync_count", p.WAL.Syncs)
+		add("fsync_last_latency_us", p.WAL.LastSync.Microseconds())
+		add("fsync_avg_latency_us", avgSync.Microseconds())
+	case "stats":
+		add("total_connections_received", e.stats.connections)
+		add("total_commands_processed", e.stats.commands.Load())
+		add("instantaneous_ops_per_sec", e.stats.opsPerSec())
+		add("expired_keys", e.stats.expiredKeys)
+		add("evicted_keys", e.stats.evictedKeys)
+		add("keyspace_hits", e.stats.keyspaceHits)
+		add("keyspace_misses", e.stats.keyspaceMisses)
+		add("pubsub_channels", len(e.pubsub.Channels("")))
+		add("pubsub_patterns", e.pubsub.NumPat())
+	case "replication":
+		if e.follower != nil {
+			add("role", "replica")
+			add("master_addr", e.follower.Addr())
+			add("master_link_status", e.follower.State())
+			add("slave_repl_offset", e.follower.Offset())
+		} else {
+			add("role", "master")
+			add("connected_slaves", len(e.replicas))
+			add("master_replid", e.replID)
+			add("master_repl_offset", e.backlog.Offset())
+		}
+		if e.raft != nil {
+			status := e.raft.Status()
+			add("raft_role", status.Role)
+			add("raft_term", status.Term)
+			add("raft_leader", status.Leader)
+			add("raft_commit_index", status.CommitIndex)
+		}
+	case "keyspace":
+		for db := 0; db < storage.Databases; db++ {
+			if size := e.storage.DBSize(db); size > 0 {
+				add(fmt.Sprintf("db%d", db), fmt.Sprintf("keys=%d", size))
+			}
+		}
+	}
+
+	header := "# " + strings.ToUpper(name[:1]) + name[1:]
+	return strings.Join(append([]string{header}, fields...), "\n")
+}
+
+func unixOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,32 @@
+package executor
+
+import "memkv/internal/metrics"
+
+// Prometheus metrics. They are updated with atomics so scraping never
+// contends with command execution.
+var (
+	commandsMetric = metrics.NewCounterVec("memkv_commands_total",
+		"Commands processed, by command", "command")
+	commandDurationMetric = metrics.NewHistogramVec("memkv_command_duration_seconds",
+		"Command latency, by command", "command", metrics.DefBuckets)
+	connectedClientsMetric = metrics.NewGauge("memkv_connected_clients",
+		"Client connections currently open")
+	connectionsMetric = metrics.NewCounter("memkv_connections_received_total",
+		"Client connections accepted since startup")
+	keysMetric = metrics.NewGauge("memkv_keys",
+		"Number of keys in the dataset")
+	expiredKeysMetric = metrics.NewCounter("memkv_expired_keys_total",
+		"Keys removed because their TTL elapsed")
+	evictedKeysMetric = metrics.NewCounter("memkv_evicted_keys_total",
+		"Keys evicted to stay under maxmemory")
+	replayDurationMetric = metrics.NewGauge("memkv_wal_replay_duration_seconds",
+		"Time spent replaying the WAL at startup")
+)
+
+// commandLabel bounds the label values to known command names
+func commandLabel(cmd string) string {
+	if _, ok := commandCategories[cmd]; ok {
+		return cmd
+	}
+	return "unknown"
+}
@@ -0,0 +1,109 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"memkv/internal/logger"
+	"memkv/internal/protocol"
+)
+
+const (
+	// monitorQueueSize is the number of lines buffered per monitor. A
+	// monitor that falls this far behind is disconnected rather than
+	// slowing down the clients it observes.
+	monitorQueueSize = 10000
+
+	// monitorOutputLimit bounds the output a monitor may leave unread.
+	// Lines are moved from the queue to the connection as they arrive,
+	// so a slow reader shows up as a growing output buffer instead.
+	monitorOutputLimit = 32 << 20
+)
+
+// redactArgs returns parts with the arguments of commands carrying
+// secrets hidden, for showing a command to monitors or in the slow log
+func redactArgs(parts []string) []string {
+	if protocol.IsSecret(parts[0]) {
+		return []string{parts[0], "(redacted)"}
+	}
+	return parts
+}
+
+// handleMonitor switches sess into MONITOR mode
+func (e *Executor) handleMonitor(sess *Session) protocol.Reply {
+	if sess.monitor != nil {
+		return protocol.OK
+	}
+
+	// Lines are handed to a goroutine so that delivering them never
+	// blocks the command path
+	feed := make(chan string, monitorQueueSize)
+	sess.monitor = feed
+	e.monitors[sess] = struct{}{}
+	go func() {
+		for line := range feed {
+			if sess.conn == nil {
+				continue
+			}
+			if _, out := sess.conn.Buffered(); out > monitorOutputLimit {
+				e.mu.Lock()
+				e.disconnectMonitor(sess, "output buffer limit exceeded")
+				e.mu.Unlock()
+				return
+			}
+			sess.push(protocol.Status(line))
+		}
+	}()
+	return protocol.OK
+}
+
+// feedMonitors sends a command executed by sess to every monitor. The
+// caller must hold e.mu.
+func (e *Executor) feedMonitors(sess *Session, parts []string) {
+	if len(e.monitors) == 0 {
+		return
+	}
+
+	parts = redactArgs(parts)
+	args := make([]string, len(parts))
+	for i, part := range parts {
+		args[i] = strconv.Quote(part)
+	}
+
+	now := time.Now()
+	line := fmt.Sprintf("%d.%06d [%d %s] %s",
+		now.Unix(), now.Nanosecond()/1000, sess.db, orDash(sess.addr), strings.Join(args, " "))
+
+	for m := range e.monitors {
+		select {
+		case m.monitor <- line:
+		default:
+			e.disconnectMonitor(m, "output queue full")
+		}
+	}
+}
+
+// disconnectMonitor closes a monitor that can't keep up. The caller must
+// hold e.mu.
+func (e *Executor) disconnectMonitor(sess *Session, reason string) {
+	if sess.monitor == nil {
+		return
+	}
+	logger.Warn("Disconnecting monitor %s: %s", sess.addr, reason)
+	e.stopMonitor(sess)
+	if sess.conn != nil {
+		sess.conn.Kill()
+	}
+}
+
+// stopMonitor ends MONITOR mode for sess. The caller must hold e.mu.
+func (e *Executor) stopMonitor(sess *Session) {
+	if sess.monitor == nil {
+		return
+	}
+	delete(e.monitors, sess)
+	close(sess.monitor)
+	sess.monitor = nil
+}
@@ -0,0 +1,109 @@
+package executor
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Keyspace notification classes, selected with the same flag characters
+// as notify-keyspace-events
+const (
+	notifyKeyspace = 1 << iota // K: publish to __keyspace@<db>__:<key>
+	notifyKeyevent             // E: publish to __keyevent@<db>__:<event>
+	notifyGeneric              // g: generic commands such as del
+	notifyString               // $: string commands such as set
+	notifyExpired              // x: keys removed because their TTL elapsed
+	notifyEvicted              // e: keys removed by the maxmemory policy
+
+	notifyAll = notifyGeneric | notifyString | notifyExpired | notifyEvicted
+)
+
+// parseNotifyFlags converts a notify-keyspace-events string into classes
+func parseNotifyFlags(flags string) (int, error) {
+	classes := 0
+	for _, c := range flags {
+		switch c {
+		case 'K':
+			classes |= notifyKeyspace
+		case 'E':
+			classes |= notifyKeyevent
+		case 'g':
+			classes |= notifyGeneric
+		case '$':
+			classes |= notifyString
+		case 'x':
+			classes |= notifyExpired
+		case 'e':
+			classes |= notifyEvicted
+		case 'A':
+			classes |= notifyAll
+		default:
+			return 0, fmt.Errorf("invalid notify-keyspace-events flag '%c'", c)
+		}
+	}
+
+	// Without a target channel type nothing would ever be published
+	if classes&(notifyKeyspace|notifyKeyevent) == 0 {
+		return 0, nil
+	}
+	return classes, nil
+}
+
+// formatNotifyFlags is the inverse of parseNotifyFlags
+func formatNotifyFlags(classes int) string {
+	var b strings.Builder
+	if classes&notifyKeyspace != 0 {
+		b.WriteByte('K')
+	}
+	if classes&notifyKeyevent != 0 {
+		b.WriteByte('E')
+	}
+	if classes&notifyAll == notifyAll {
+		b.WriteByte('A')
+		return b.String()
+	}
+	if classes&notifyGeneric != 0 {
+		b.WriteByte('g')
+	}
+	if classes&notifyString != 0 {
+		b.WriteByte('$')
+	}
+	if classes&notifyExpired != 0 {
+		b.WriteByte('x')
+	}
+	if classes&notifyEvicted != 0 {
+		b.WriteByte('e')
+	}
+	return b.String()
+}
+
+// SetNotifyKeyspaceEvents configures which keyspace events are published.
+// An empty string disables notifications.
+func (e *Executor) SetNotifyKeyspaceEvents(flags string) error {
+	classes, err := parseNotifyFlags(flags)
+	if err != nil {
+		return err
+	}
+	e.notifyClasses = classes
+	return nil
+}
+
+// NotifyKeyspaceEvents returns the current notification flags
+func (e *Executor) NotifyKeyspaceEvents() string {
+	return formatNotifyFlags(e.notifyClasses)
+}
+
+// notifyKeyspaceEvent publishes event for key in the running command's
+// database if its class is enabled
+func (e *Executor) notifyKeyspaceEvent(class int, event, key string) {
+	if e.notifyClasses&class == 0 {
+		return
+	}
+
+	if e.notifyClasses&notifyKeyspace != 0 {
+		e.pubsub.Publish(fmt.Sprintf("__keyspace@%d__:%s", e.db, key), event)
+	}
+	if e.notifyClasses&notifyKeyevent != 0 {
+		e.pubsub.Publish(fmt.Sprintf("__keyevent@%d__:%s", e.db, event), key)
+	}
+}
@@ -0,0 +1,137 @@
+package executor
+
+import (
+	"sort"
+	"strings"
+
+	"memkv/internal/protocol"
+)
+
+// subscriberCommands are the only commands accepted while a session is
+// in subscriber mode
+var subscriberCommands = map[string]bool{
+	"SUBSCRIBE":    true,
+	"UNSUBSCRIBE":  true,
+	"PSUBSCRIBE":   true,
+	"PUNSUBSCRIBE": true,
+	"PING":         true,
+}
+
+func (e *Executor) handleSubscribe(sess *Session, parts []string) protocol.Reply {
+	replies := make([]protocol.Reply, 0, len(parts)-1)
+	for _, ch := range parts[1:] {
+		if e.pubsub.Subscribe(sess, ch) {
+			sess.channels[ch] = struct{}{}
+		}
+		replies = append(replies, subscription("subscribe", ch, sess.subscriptions()))
+	}
+	return sess.confirm(replies)
+}
+
+func (e *Executor) handleUnsubscribe(sess *Session, parts []string) protocol.Reply {
+	channels := parts[1:]
+	if len(channels) == 0 {
+		channels = sortedNames(sess.channels)
+	}
+	if len(channels) == 0 {
+		return protocol.Array(protocol.Bulk("unsubscribe"), protocol.Nil, protocol.Integer(int64(sess.subscriptions())))
+	}
+
+	replies := make([]protocol.Reply, 0, len(channels))
+	for _, ch := range channels {
+		e.pubsub.Unsubscribe(sess, ch)
+		delete(sess.channels, ch)
+		replies = append(replies, subscription("unsubscribe", ch, sess.subscriptions()))
+	}
+	return sess.confirm(replies)
+}
+
+func (e *Executor) handlePSubscribe(sess *Session, parts []string) protocol.Reply {
+	replies := make([]protocol.Reply, 0, len(parts)-1)
+	for _, pattern := range parts[1:] {
+		if e.pubsub.PSubscribe(sess, pattern) {
+			sess.patterns[pattern] = struct{}{}
+		}
+		replies = append(replies, subscription("psubscribe", pattern, sess.subscriptions()))
+	}
+	return sess.confirm(replies)
+}
+
+func (e *Executor) handlePUnsubscribe(sess *Session, parts []string) protocol.Reply {
+	patterns := parts[1:]
+	if len(patterns) == 0 {
+		patterns = sortedNames(sess.patterns)
+	}
+	if len(patterns) == 0 {
+		return protocol.Array(protocol.Bulk("punsubscribe"), protocol.Nil, protocol.Integer(int64(sess.subscriptions())))
+	}
+
+	replies := make([]protocol.Reply, 0, len(patterns))
+	for _, pattern := range patterns {
+		e.pubsub.PUnsubscribe(sess, pattern)
+		delete(sess.patterns, pattern)
+		replies = append(replies, subscription("punsubscribe", pattern, sess.subscriptions()))
+	}
+	return sess.confirm(replies)
+}
+
+func (e *Executor) handlePublish(parts []string) protocol.Reply {
+	channel := parts[1]
+	message := strings.Join(parts[2:], " ")
+	return protocol.Integer(int64(e.pubsub.Publish(channel, message)))
+}
+
+func (e *Executor) handlePubSub(parts []string) protocol.Reply {
+	switch strings.ToUpper(parts[1]) {
+	case "CHANNELS":
+		pattern := ""
+		if len(parts) > 2 {
+			pattern = parts[2]
+		}
+		return protocol.BulkArray(e.pubsub.Channels(pattern))
+	case "NUMSUB":
+		elems := make([]protocol.Reply, 0, 2*(len(parts)-2))
+		for _, ch := range parts[2:] {
+			elems = append(elems, protocol.Bulk(ch), protocol.Integer(int64(e.pubsub.NumSub(ch))))
+		}
+		return protocol.Array(elems...)
+	case "NUMPAT":
+		return protocol.Integer(int64(e.pubsub.NumPat()))
+	default:
+		return protocol.Errorf("ERR unknown PUBSUB subcommand '%s'", parts[1])
+	}
+}
+
+// CloseSession releases all state held by a disconnected session
+func (e *Executor) CloseSession(sess *Session) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	delete(e.sessions, sess)
+	connectedClientsMetric.Set(float64(len(e.sessions)))
+	delete(e.replicas, sess)
+	e.stopMonitor(sess)
+	for ch := range sess.channels {
+		e.pubsub.Unsubscribe(sess, ch)
+	}
+	for pattern := range sess.patterns {
+		e.pubsub.PUnsubscribe(sess, pattern)
+	}
+	sess.channels = make(map[string]struct{})
+	sess.patterns = make(map[string]struct{})
+}
+
+// subscription is the confirmation sent for each (un)subscribed channel
+// or pattern
+func subscription(kind, name string, count int) protocol.Reply {
+	return protocol.Array(protocol.Bulk(kind), protocol.Bulk(name), protocol.Integer(int64(count)))
+}
+
+func sortedNames(set map[string]struct{}) []string {
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,224 @@
+package executor
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"memkv/internal/logger"
+	"memkv/internal/protocol"
+	"memkv/internal/replication"
+)
+
+// newReplID generates a random replication ID identifying a leader's history
+func newReplID() string {
+	b := make([]byte, 20)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// propagate appends a write to the replication backlog and streams it to
+// connected replicas. The caller must hold e.mu.
+func (e *Executor) propagate(args ...string) {
+	// Replicas apply the stream on one connection, so writes to another
+	// database than the previous one are preceded by a SELECT
+	if e.db != e.replDB {
+		e.replDB = e.db
+		e.propagate("SELECT", strconv.Itoa(e.db))
+	}
+
+	data := protocol.BulkArray(args).Bytes()
+	e.backlog.Append(data)
+
+	for r := range e.replicas {
+		r.push(protocol.Encoded(data))
+	}
+}
+
+// pingReplicas sends a PING down the replication stream, which keeps
+// replicas from timing out the link while no writes are made. The caller
+// must hold e.mu.
+func (e *Executor) pingReplicas() {
+	if len(e.replicas) == 0 {
+		return
+	}
+
+	data := protocol.BulkArray([]string{"PING"}).Bytes()
+	e.backlog.Append(data)
+	for r := range e.replicas {
+		r.push(protocol.Encoded(data))
+	}
+}
+
+// SetMasterAuth sets the credentials used to authenticate with the
+// leader, needed when it requires a password or restricts users with
+// ACLs. An empty user means the default user. It applies from the next
+// REPLICAOF on.
+func (e *Executor) SetMasterAuth(user, password string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.masterUser = user
+	e.masterAuth = password
+}
+
+// SetInterNodeTLS makes replication and MIGRATE connect to other nodes
+// over TLS with cfg, so their addresses must be TLS ports. Nil, the
+// default, uses plain TCP. It applies from the next REPLICAOF on.
+func (e *Executor) SetInterNodeTLS(cfg *tls.Config) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.tlsClient = cfg
+}
+
+// ReplicaOf makes the server follow the leader at host:port
+func (e *Executor) ReplicaOf(host string, port int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.replicaOf(host, port)
+}
+
+func (e *Executor) replicaOf(host string, port int) {
+	if e.follower != nil {
+		e.follower.Close()
+	}
+
+	h := &replicaHandler{e: e, sess: &Session{master: true}}
+	e.follower = replication.NewFollower(host, port, h)
+	e.follower.SetAuth(e.masterUser, e.masterAuth)
+	e.follower.SetTLS(e.tlsClient)
+	h.follower = e.follower
+	e.follower.Start()
+	logger.Info("Replicating from %s", e.follower.Addr())
+}
+
+func (e *Executor) handleReplicaOf(parts []string) protocol.Reply {
+	if strings.EqualFold(parts[1], "NO") && strings.EqualFold(parts[2], "ONE") {
+		if e.follower != nil {
+			e.follower.Close()
+			e.follower = nil
+
+			// Start a new history so replicas of the old leader can't
+			// partially resync against our diverging stream
+			e.replID = newReplID()
+			e.backlog = replication.NewBacklog(replication.DefaultBacklogSize, 0)
+			logger.Info("Replication stopped, now acting as leader")
+		}
+		return protocol.OK
+	}
+
+	port, err := strconv.Atoi(parts[2])
+	if err != nil || port <= 0 || port > 65535 {
+		return protocol.Errorf("ERR invalid port '%s'", parts[2])
+	}
+
+	if len(e.replicas) > 0 {
+		return protocol.Error("ERR cannot become a replica while serving replicas")
+	}
+	if e.raft != nil {
+		return protocol.Error("ERR REPLICAOF is not supported in Raft mode")
+	}
+
+	e.replicaOf(parts[1], port)
+	return protocol.OK
+}
+
+// handlePSync serves a replica: it either resumes the stream from the
+// backlog or sends a full snapshot, and registers sess for propagation
+func (e *Executor) handlePSync(sess *Session, parts []string) protocol.Reply {
+	if e.follower != nil {
+		return protocol.Error("ERR chained replication is not supported")
+	}
+
+	offset, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return protocol.Errorf("ERR invalid offset '%s'", parts[2])
+	}
+
+	sess.replica = true
+	e.replicas[sess] = struct{}{}
+
+	// Partial resync when the replica shares our history and the
+	// backlog still covers its offset
+	if parts[1] == e.replID {
+		if data, ok := e.backlog.ReadFrom(offset); ok {
+			logger.Info("Partial resync for replica from offset %d", offset)
+			reply := protocol.Status("CONTINUE " + e.replID).Bytes()
+			return protocol.Encoded(append(reply, data...))
+		}
+	}
+
+	// The snapshot is an array of SELECT and SET commands following the
+	// status. It ends in the database the stream continues in.
+	dump := e.dumpCommands()
+	if e.replDB >= 0 {
+		dump = append(dump, []string{"SELECT", strconv.Itoa(e.replDB)})
+	}
+	cmds := make([]protocol.Reply, 0, len(dump))
+	for _, cmd := range dump {
+		cmds = append(cmds, protocol.BulkArray(cmd))
+	}
+
+	logger.Info("Full resync for replica with %d keys", e.storage.Size())
+	reply := protocol.Status(fmt.Sprintf("FULLRESYNC %s %d", e.replID, e.backlog.Offset())).Bytes()
+	return protocol.Encoded(protocol.Array(cmds...).AppendTo(reply))
+}
+
+func (e *Executor) handleRole() protocol.Reply {
+	if e.follower != nil {
+		return protocol.Array(
+			protocol.Bulk("replica"),
+			protocol.Bulk(e.follower.Addr()),
+			protocol.Bulk(e.follower.State()),
+			protocol.Integer(e.follower.Offset()),
+		)
+	}
+	return protocol.Array(
+		protocol.Bulk("master"),
+		protocol.Integer(e.backlog.Offset()),
+		protocol.Integer(int64(len(e.replicas))),
+	)
+}
+
+// replicaHandler applies the leader's stream to the local dataset
+type replicaHandler struct {
+	e        *Executor
+	follower *replication.Follower
+
+	// sess applies the stream, keeping the database it selects
+	sess *Session
+}
+
+// stale reports whether the link was replaced or stopped. The caller
+// must hold e.mu.
+func (h *replicaHandler) stale() bool {
+	return h.e.follower != h.follower
+}
+
+func (h *replicaHandler) Reset() error {
+	h.e.mu.Lock()
+	defer h.e.mu.Unlock()
+
+	if h.stale() {
+		return nil
+	}
+	h.sess.db = 0
+	return h.e.storage.Clear()
+}
+
+func (h *replicaHandler) Apply(parts []string) error {
+	h.e.mu.Lock()
+	defer h.e.mu.Unlock()
+
+	if h.stale() {
+		return nil
+	}
+
+	reply := h.e.execute(h.sess, parts)
+	if reply.IsError() {
+		return fmt.Errorf("%s", reply.Str)
+	}
+	return nil
+}
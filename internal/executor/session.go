@@ -0,0 +1,129 @@
+package executor
+
+import (
+	"strings"
+	"time"
+
+	"memkv/internal/protocol"
+)
+
+// Conn is the executor's handle on a client connection
+type Conn interface {
+	// Push delivers an out-of-band reply, such as a pub/sub message
+	Push(reply protocol.Reply)
+
+	// Kill closes the connection. It may be called from any goroutine
+	// and must not wait for the connection to be torn down.
+	Kill()
+
+	// Buffered returns the bytes pending in the input and output buffers
+	Buffered() (in, out int)
+}
+
+// Session holds the per-connection state the executor needs between commands
+type Session struct {
+	conn     Conn
+	channels map[string]struct{}
+	patterns map[string]struct{}
+
+	replica bool // connection is a replica receiving the replication stream
+	master  bool // session applies the stream received from our leader
+	asking  bool // next command may access a slot being imported
+
+	user string // authenticated ACL user, "" until AUTH succeeds
+	db   int    // database selected with SELECT
+
+	// tx is set between MULTI and EXEC or DISCARD
+	tx *transaction
+
+	// monitor feeds executed commands to the connection in MONITOR mode
+	monitor chan string
+
+	// Client metadata reported by CLIENT LIST, guarded by e.mu
+	id         int64
+	addr       string // peer address of the client connection
+	name       string // client name set with CLIENT SETNAME
+	created    time.Time
+	lastActive time.Time
+	lastCmd    string
+
+	// closeAfterReply asks the connection to close once the reply to
+	// the current command is written (CLIENT KILL of itself)
+	closeAfterReply bool
+}
+
+// NewSession creates a session for the client connection at addr
+func (e *Executor) NewSession(addr string, conn Conn) *Session {
+	now := time.Now()
+	sess := &Session{
+		conn:       conn,
+		addr:       addr,
+		created:    now,
+		lastActive: now,
+		channels:   make(map[string]struct{}),
+		patterns:   make(map[string]struct{}),
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.nextClientID++
+	sess.id = e.nextClientID
+	e.sessions[sess] = struct{}{}
+	e.stats.connections++
+	connectionsMetric.Inc()
+	connectedClientsMetric.Set(float64(len(e.sessions)))
+	return sess
+}
+
+// ID returns the client id shown by CLIENT LIST
+func (s *Session) ID() int64 {
+	return s.id
+}
+
+// Deliver implements pubsub.Subscriber
+func (s *Session) Deliver(msg []string) {
+	s.push(protocol.BulkArray(msg))
+}
+
+func (s *Session) push(reply protocol.Reply) {
+	if s.conn != nil {
+		s.conn.Push(reply)
+	}
+}
+
+// confirm returns the last of replies and pushes the others ahead of it,
+// since SUBSCRIBE and friends acknowledge every channel separately
+func (s *Session) confirm(replies []protocol.Reply) protocol.Reply {
+	for _, reply := range replies[:len(replies)-1] {
+		s.push(reply)
+	}
+	return replies[len(replies)-1]
+}
+
+// Subscribed reports whether the session is in subscriber (push-only) mode
+func (s *Session) Subscribed() bool {
+	return s.subscriptions() > 0
+}
+
+// Replica reports whether the connection is a replica receiving the
+// replication stream
+func (s *Session) Replica() bool {
+	return s.replica
+}
+
+// CloseAfterReply reports whether the connection should be closed once
+// the reply to the last command has been written
+func (s *Session) CloseAfterReply() bool {
+	return s.closeAfterReply
+}
+
+func (s *Session) subscriptions() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+// touch records command activity. The caller must hold e.mu.
+func (s *Session) touch(cmd string) {
+	s.lastActive = time.Now()
+	s.lastCmd = strings.ToLower(cmd)
+}
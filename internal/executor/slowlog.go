@@ -0,0 +1,170 @@
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"memkv/internal/protocol"
+)
+
+const (
+	// DefaultSlowlogThreshold is the default slow log threshold in microseconds
+	DefaultSlowlogThreshold = 10000
+	// DefaultSlowlogMaxLen is the default number of slow log entries kept
+	DefaultSlowlogMaxLen = 128
+
+	slowlogMaxArgs   = 32  // arguments kept per entry
+	slowlogMaxArgLen = 128 // bytes kept per argument
+)
+
+// slowlogEntry records one command that exceeded the threshold
+type slowlogEntry struct {
+	id       int64
+	time     time.Time
+	duration time.Duration
+	args     []string
+	addr     string
+	name     string
+}
+
+// slowLog is a bounded ring of slow commands. It has its own lock so
+// commands can be recorded after e.mu is released.
+type slowLog struct {
+	mu        sync.Mutex
+	entries   []slowlogEntry // oldest first
+	maxLen    int
+	threshold int64 // microseconds, negative disables the log
+	nextID    int64
+}
+
+func newSlowLog() *slowLog {
+	return &slowLog{
+		maxLen:    DefaultSlowlogMaxLen,
+		threshold: DefaultSlowlogThreshold,
+	}
+}
+
+// record adds the command if it ran longer than the threshold
+func (l *slowLog) record(sess *Session, parts []string, start time.Time, duration time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.threshold < 0 || duration.Microseconds() < l.threshold || l.maxLen == 0 {
+		return
+	}
+
+	l.entries = append(l.entries, slowlogEntry{
+		id:       l.nextID,
+		time:     start,
+		duration: duration,
+		args:     truncateArgs(parts),
+		addr:     sess.addr,
+		name:     sess.name,
+	})
+	l.nextID++
+	l.trim()
+}
+
+// trim drops the oldest entries beyond maxLen. Caller holds l.mu.
+func (l *slowLog) trim() {
+	if excess := len(l.entries) - l.maxLen; excess > 0 {
+		l.entries = append([]slowlogEntry(nil), l.entries[excess:]...)
+	}
+}
+
+// truncateArgs copies argv, hiding secrets and shortening long argument
+// lists and values
+func truncateArgs(parts []string) []string {
+	parts = redactArgs(parts)
+	n := len(parts)
+	if n > slowlogMaxArgs {
+		n = slowlogMaxArgs - 1
+	}
+
+	args := make([]string, 0, n+1)
+	for _, arg := range parts[:n] {
+		if len(arg) > slowlogMaxArgLen {
+			arg = fmt.Sprintf("%s... (%d more bytes)", arg[:slowlogMaxArgLen], len(arg)-slowlogMaxArgLen)
+		}
+		args = append(args, arg)
+	}
+	if n < len(parts) {
+		args = append(args, fmt.Sprintf("... (%d more arguments)", len(parts)-n))
+	}
+	return args
+}
+
+// SetSlowlogThreshold sets the execution time in microseconds above which
+// commands are logged. A negative value disables the slow log.
+func (e *Executor) SetSlowlogThreshold(micros int64) {
+	e.slowlog.mu.Lock()
+	defer e.slowlog.mu.Unlock()
+	e.slowlog.threshold = micros
+}
+
+// SetSlowlogMaxLen sets how many entries the slow log keeps
+func (e *Executor) SetSlowlogMaxLen(n int) {
+	if n < 0 {
+		n = 0
+	}
+
+	e.slowlog.mu.Lock()
+	defer e.slowlog.mu.Unlock()
+	e.slowlog.maxLen = n
+	e.slowlog.trim()
+}
+
+// handleSlowlog implements SLOWLOG GET [n], SLOWLOG LEN and SLOWLOG RESET
+func (e *Executor) handleSlowlog(parts []string) protocol.Reply {
+	l := e.slowlog
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch strings.ToUpper(parts[1]) {
+	case "GET":
+		count := 10
+		if len(parts) > 2 {
+			n, err := strconv.Atoi(parts[2])
+			if err != nil {
+				return protocol.Errorf("ERR invalid count '%s'", parts[2])
+			}
+			count = n
+		}
+		if count < 0 || count > len(l.entries) {
+			count = len(l.entries)
+		}
+
+		// Newest first: id, unix time, duration in us, argv, addr, name
+		elems := make([]protocol.Reply, 0, count)
+		for i := len(l.entries) - 1; i >= len(l.entries)-count; i-- {
+			entry := l.entries[i]
+			elems = append(elems, protocol.Array(
+				protocol.Integer(entry.id),
+				protocol.Integer(entry.time.Unix()),
+				protocol.Integer(entry.duration.Microseconds()),
+				protocol.BulkArray(entry.args),
+				protocol.Bulk(entry.addr),
+				protocol.Bulk(entry.name),
+			))
+		}
+		return protocol.Array(elems...)
+	case "LEN":
+		return protocol.Integer(int64(len(l.entries)))
+	case "RESET":
+		l.entries = nil
+		return protocol.OK
+	default:
+		return protocol.Errorf("ERR unknown SLOWLOG subcommand '%s'", parts[1])
+	}
+}
+
+// orDash keeps empty fields visible in space-separated output
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
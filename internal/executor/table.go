@@ -0,0 +1,740 @@
+package executor
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"memkv/internal/protocol"
+)
+
+// commandHandler runs a command whose arity has been checked
+type commandHandler func(e *Executor, sess *Session, parts []string) protocol.Reply
+
+// commandFlags describe how a command behaves
+type commandFlags int
+
+const (
+	flagWrite    commandFlags = 1 << iota // modifies the dataset
+	flagReadonly                          // reads the dataset without modifying it
+	flagAdmin                             // administers the server
+	flagPubSub                            // publish/subscribe
+	flagNoAuth                            // may run before authenticating
+	flagNoMulti                           // can't be queued in a transaction
+	flagBlocking                          // may wait on another server
+)
+
+// flagNames are the names COMMAND INFO reports flags by
+var flagNames = []struct {
+	flag commandFlags
+	name string
+}{
+	{flagWrite, "write"},
+	{flagReadonly, "readonly"},
+	{flagAdmin, "admin"},
+	{flagPubSub, "pubsub"},
+	{flagNoAuth, "no_auth"},
+	{flagNoMulti, "no_multi"},
+	{flagBlocking, "blocking"},
+}
+
+// command describes a command for dispatch, ACLs and introspection
+type command struct {
+	name string
+
+	// arity counts the arguments including the command name, and the
+	// subcommand for subcommands. Negative means at least -arity.
+	arity int
+	flags commandFlags
+
+	// Positions of the key arguments: the first, the last (negative
+	// counts from the end) and the step between them. 0 if none.
+	firstKey, lastKey, keyStep int
+
+	categories []string // ACL categories
+	group      string   // documentation group
+	summary    string
+	syntax     string // arguments after the name, as shown in help
+
+	// subcommands are looked up by the second argument. Their handler
+	// is the parent's, and flags and categories default to the parent's.
+	subcommands map[string]*command
+	parent      *command
+
+	handler commandHandler
+}
+
+// fullName is the name COMMAND reports: lower case, with the parent's
+// name and a '|' for subcommands
+func (c *command) fullName() string {
+	if c.parent != nil {
+		return c.parent.fullName() + "|" + strings.ToLower(c.name)
+	}
+	return strings.ToLower(c.name)
+}
+
+// keys returns the key arguments in parts
+func (c *command) keys(parts []string) []string {
+	if c.firstKey == 0 || c.firstKey >= len(parts) {
+		return nil
+	}
+	last := c.lastKey
+	if last < 0 {
+		last += len(parts)
+	}
+	var keys []string
+	for i := c.firstKey; i <= last && i < len(parts); i += c.keyStep {
+		keys = append(keys, parts[i])
+	}
+	return keys
+}
+
+// commands is the command table, filled in by init from commandList
+var commands = make(map[string]*command)
+
+// commandCategories maps every command to its ACL categories
+var commandCategories = make(map[string][]string)
+
+func init() {
+	for _, c := range commandList {
+		commands[c.name] = c
+		commandCategories[c.name] = c.categories
+		for name, sub := range c.subcommands {
+			sub.name = name
+			sub.parent = c
+			sub.handler = c.handler
+			if sub.flags == 0 {
+				sub.flags = c.flags
+			}
+			if sub.categories == nil {
+				sub.categories = c.categories
+			}
+		}
+	}
+}
+
+// lookupCommand finds the command, or the subcommand, parts invokes and
+// checks its arity. It returns nil and the error reply if it can't run.
+func lookupCommand(parts []string) (*command, protocol.Reply) {
+	name := strings.ToUpper(parts[0])
+	c, ok := commands[name]
+	if !ok {
+		return nil, protocol.Errorf("ERR unknown command '%s'", name)
+	}
+	if c.subcommands != nil && len(parts) > 1 {
+		sub, ok := c.subcommands[strings.ToUpper(parts[1])]
+		if !ok {
+			return nil, protocol.Errorf("ERR unknown %s subcommand '%s'", name, parts[1])
+		}
+		c = sub
+	}
+
+	if (c.arity > 0 && len(parts) != c.arity) || len(parts) < -c.arity {
+		return nil, protocol.Errorf("ERR wrong number of arguments for '%s' command", c.fullName())
+	}
+	return c, protocol.OK
+}
+
+// isWrite reports whether cmd is a write command
+func isWrite(cmd string) bool {
+	c, ok := commands[cmd]
+	return ok && c.flags&flagWrite != 0
+}
+
+// Blocking reports whether the command in input may wait on another
+// server, so that callers can run it without holding up other clients
+func (e *Executor) Blocking(input string) bool {
+	parts := strings.Fields(input)
+	if len(parts) == 0 {
+		return false
+	}
+	c, ok := commands[strings.ToUpper(parts[0])]
+	return ok && c.flags&flagBlocking != 0
+}
+
+// handleCommand implements COMMAND, COMMAND INFO, COMMAND DOCS and
+// COMMAND COUNT
+func (e *Executor) handleCommand(parts []string) protocol.Reply {
+	if len(parts) == 1 {
+		var elems []protocol.Reply
+		for _, c := range sortedCommands() {
+			elems = append(elems, c.info())
+		}
+		return protocol.Array(elems...)
+	}
+
+	switch strings.ToUpper(parts[1]) {
+	case "COUNT":
+		return protocol.Integer(int64(len(commands)))
+	case "INFO":
+		if len(parts) == 2 {
+			return e.handleCommand(parts[:1])
+		}
+		elems := make([]protocol.Reply, 0, len(parts)-2)
+		for _, name := range parts[2:] {
+			if c := commandByName(name); c != nil {
+				elems = append(elems, c.info())
+			} else {
+				elems = append(elems, protocol.Nil)
+			}
+		}
+		return protocol.Array(elems...)
+	case "DOCS":
+		var found []*command
+		if len(parts) == 2 {
+			found = sortedCommands()
+		}
+		for _, name := range parts[2:] {
+			if c := commandByName(name); c != nil {
+				found = append(found, c)
+			}
+		}
+		elems := make([]protocol.Reply, 0, 2*len(found))
+		for _, c := range found {
+			elems = append(elems, protocol.Bulk(c.fullName()), c.docs())
+		}
+		return protocol.Array(elems...)
+	default:
+		return protocol.Errorf("ERR unknown COMMAND subcommand '%s'", parts[1])
+	}
+}
+
+// commandByName finds a command by name, or a subcommand by a name like
+// "client|list". It returns nil if there is none.
+func commandByName(name string) *command {
+	name, sub, isSub := strings.Cut(strings.ToUpper(name), "|")
+	c := commands[name]
+	if c == nil || !isSub {
+		return c
+	}
+	return c.subcommands[sub]
+}
+
+// sortedCommands returns the commands ordered by name
+func sortedCommands() []*command {
+	sorted := make([]*command, 0, len(commands))
+	for _, c := range commands {
+		sorted = append(sorted, c)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	return sorted
+}
+
+// sortedSubcommands returns c's subcommands ordered by name
+func (c *command) sortedSubcommands() []*command {
+	sorted := make([]*command, 0, len(c.subcommands))
+	for _, sub := range c.subcommands {
+		sorted = append(sorted, sub)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].name < sorted[j].name })
+	return sorted
+}
+
+// info describes c the way COMMAND INFO does: name, arity, flags, key
+// positions, ACL categories, tips, key specs and subcommands
+func (c *command) info() protocol.Reply {
+	var flags []string
+	for _, f := range flagNames {
+		if c.flags&f.flag != 0 {
+			flags = append(flags, f.name)
+		}
+	}
+	categories := make([]string, 0, len(c.categories))
+	for _, cat := range c.categories {
+		categories = append(categories, "@"+cat)
+	}
+	var subcommands []protocol.Reply
+	for _, sub := range c.sortedSubcommands() {
+		subcommands = append(subcommands, sub.info())
+	}
+
+	return protocol.Array(
+		protocol.Bulk(c.fullName()),
+		protocol.Integer(int64(c.arity)),
+		protocol.BulkArray(flags),
+		protocol.Integer(int64(c.firstKey)),
+		protocol.Integer(int64(c.lastKey)),
+		protocol.Integer(int64(c.keyStep)),
+		protocol.BulkArray(categories),
+		protocol.Array(),
+		protocol.Array(),
+		protocol.Array(subcommands...),
+	)
+}
+
+// docs documents c the way COMMAND DOCS does, as field/value pairs
+func (c *command) docs() protocol.Reply {
+	elems := []protocol.Reply{
+		protocol.Bulk("summary"), protocol.Bulk(c.summary),
+		protocol.Bulk("group"), protocol.Bulk(c.docGroup()),
+		protocol.Bulk("syntax"), protocol.Bulk(c.syntax),
+	}
+	if len(c.subcommands) > 0 {
+		var subs []protocol.Reply
+		for _, sub := range c.sortedSubcommands() {
+			subs = append(subs, protocol.Bulk(sub.fullName()), sub.docs())
+		}
+		elems = append(elems, protocol.Bulk("subcommands"), protocol.Array(subs...))
+	}
+	return protocol.Array(elems...)
+}
+
+// docGroup is the documentation group, which subcommands share with
+// their parent
+func (c *command) docGroup() string {
+	if c.parent != nil {
+		return c.parent.group
+	}
+	return c.group
+}
+
+// Adapters for handlers that don't need the session or the arguments
+func withParts(h func(*Executor, []string) protocol.Reply) commandHandler {
+	return func(e *Executor, _ *Session, parts []string) protocol.Reply { return h(e, parts) }
+}
+
+func withSession(h func(*Executor, *Session) protocol.Reply) commandHandler {
+	return func(e *Executor, sess *Session, _ []string) protocol.Reply { return h(e, sess) }
+}
+
+// commandList registers every command. ProcessCommand dispatches on it,
+// ACLs take their categories from it, and COMMAND reports it.
+var commandList = []*command{
+	// Strings
+	{
+		name: "SET", arity: -3, flags: flagWrite, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"write", "string", "fast"}, group: "string",
+		summary: "Set the string value of a key, clearing its TTL", syntax: "key value",
+		handler: withParts((*Executor).handleSet),
+	},
+	{
+		name: "GET", arity: 2, flags: flagReadonly, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"read", "string", "fast"}, group: "string",
+		summary: "Get the value of a key", syntax: "key",
+		handler: withParts((*Executor).handleGet),
+	},
+	{
+		name: "INCR", arity: 2, flags: flagWrite, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"write", "string", "fast"}, group: "string",
+		summary: "Increment the integer value of a key by one", syntax: "key",
+		handler: func(e *Executor, _ *Session, parts []string) protocol.Reply { return e.handleIncr(parts, 1, false) },
+	},
+	{
+		name: "INCRBY", arity: 3, flags: flagWrite, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"write", "string", "fast"}, group: "string",
+		summary: "Increment the integer value of a key by a number", syntax: "key increment",
+		handler: func(e *Executor, _ *Session, parts []string) protocol.Reply { return e.handleIncr(parts, 1, true) },
+	},
+	{
+		name: "DECR", arity: 2, flags: flagWrite, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"write", "string", "fast"}, group: "string",
+		summary: "Decrement the integer value of a key by one", syntax: "key",
+		handler: func(e *Executor, _ *Session, parts []string) protocol.Reply { return e.handleIncr(parts, -1, false) },
+	},
+	{
+		name: "DECRBY", arity: 3, flags: flagWrite, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"write", "string", "fast"}, group: "string",
+		summary: "Decrement the integer value of a key by a number", syntax: "key decrement",
+		handler: func(e *Executor, _ *Session, parts []string) protocol.Reply { return e.handleIncr(parts, -1, true) },
+	},
+
+	// Keyspace
+	{
+		name: "DEL", arity: -2, flags: flagWrite, firstKey: 1, lastKey: -1, keyStep: 1,
+		categories: []string{"write", "keyspace", "fast"}, group: "generic",
+		summary: "Delete keys", syntax: "key [key ...]",
+		handler: withParts((*Executor).handleDelete),
+	},
+	{
+		name: "DELETE", arity: -2, flags: flagWrite, firstKey: 1, lastKey: -1, keyStep: 1,
+		categories: []string{"write", "keyspace", "fast"}, group: "generic",
+		summary: "Delete keys (alias of DEL)", syntax: "key [key ...]",
+		handler: withParts((*Executor).handleDelete),
+	},
+	{
+		name: "EXISTS", arity: 2, flags: flagReadonly, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"read", "keyspace", "fast"}, group: "generic",
+		summary: "Determine whether a key exists", syntax: "key",
+		handler: withParts((*Executor).handleExists),
+	},
+	{
+		name: "KEYS", arity: -1, flags: flagReadonly,
+		categories: []string{"read", "keyspace", "slow", "dangerous"}, group: "generic",
+		summary: "Find all keys matching a pattern", syntax: "[pattern]",
+		handler: withParts((*Executor).handleKeys),
+	},
+	{
+		name: "SCAN", arity: -2, flags: flagReadonly,
+		categories: []string{"read", "keyspace", "slow"}, group: "generic",
+		summary: "Iterate over the keyspace", syntax: "cursor [MATCH pattern] [COUNT count]",
+		handler: withParts((*Executor).handleScan),
+	},
+	{
+		name: "EXPIRE", arity: 3, flags: flagWrite, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"write", "keyspace", "fast"}, group: "generic",
+		summary: "Set a key's time to live in seconds", syntax: "key seconds",
+		handler: func(e *Executor, _ *Session, parts []string) protocol.Reply {
+			return e.handleExpire(parts, time.Second, false)
+		},
+	},
+	{
+		name: "PEXPIRE", arity: 3, flags: flagWrite, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"write", "keyspace", "fast"}, group: "generic",
+		summary: "Set a key's time to live in milliseconds", syntax: "key milliseconds",
+		handler: func(e *Executor, _ *Session, parts []string) protocol.Reply {
+			return e.handleExpire(parts, time.Millisecond, false)
+		},
+	},
+	{
+		name: "PEXPIREAT", arity: 3, flags: flagWrite, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"write", "keyspace", "fast"}, group: "generic",
+		summary: "Set the expiration of a key as a unix timestamp in milliseconds", syntax: "key unix-time-milliseconds",
+		handler: func(e *Executor, _ *Session, parts []string) protocol.Reply {
+			return e.handleExpire(parts, time.Millisecond, true)
+		},
+	},
+	{
+		name: "PERSIST", arity: 2, flags: flagWrite, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"write", "keyspace", "fast"}, group: "generic",
+		summary: "Remove the expiration of a key", syntax: "key",
+		handler: withParts((*Executor).handlePersist),
+	},
+	{
+		name: "TTL", arity: 2, flags: flagReadonly, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"read", "keyspace", "fast"}, group: "generic",
+		summary: "Get the time to live of a key in seconds", syntax: "key",
+		handler: func(e *Executor, _ *Session, parts []string) protocol.Reply {
+			return e.handleTTL(parts, time.Second)
+		},
+	},
+	{
+		name: "PTTL", arity: 2, flags: flagReadonly, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"read", "keyspace", "fast"}, group: "generic",
+		summary: "Get the time to live of a key in milliseconds", syntax: "key",
+		handler: func(e *Executor, _ *Session, parts []string) protocol.Reply {
+			return e.handleTTL(parts, time.Millisecond)
+		},
+	},
+
+	{
+		name: "RENAME", arity: 3, flags: flagWrite, firstKey: 1, lastKey: 2, keyStep: 1,
+		categories: []string{"write", "keyspace", "slow"}, group: "generic",
+		summary: "Rename a key, replacing the new name", syntax: "key newkey",
+		handler: func(e *Executor, _ *Session, parts []string) protocol.Reply { return e.handleRename(parts, false) },
+	},
+	{
+		name: "RENAMENX", arity: 3, flags: flagWrite, firstKey: 1, lastKey: 2, keyStep: 1,
+		categories: []string{"write", "keyspace", "fast"}, group: "generic",
+		summary: "Rename a key unless the new name exists", syntax: "key newkey",
+		handler: func(e *Executor, _ *Session, parts []string) protocol.Reply { return e.handleRename(parts, true) },
+	},
+	{
+		name: "COPY", arity: -3, flags: flagWrite, firstKey: 1, lastKey: 2, keyStep: 1,
+		categories: []string{"write", "keyspace", "slow"}, group: "generic",
+		summary: "Copy a key", syntax: "source destination [DB destination-db] [REPLACE]",
+		handler: withParts((*Executor).handleCopy),
+	},
+	{
+		name: "TYPE", arity: 2, flags: flagReadonly, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"read", "keyspace", "fast"}, group: "generic",
+		summary: "Get the type of a key's value", syntax: "key",
+		handler: withParts((*Executor).handleType),
+	},
+	{
+		name: "RANDOMKEY", arity: 1, flags: flagReadonly,
+		categories: []string{"read", "keyspace", "slow"}, group: "generic",
+		summary: "Get a random key",
+		handler: func(e *Executor, _ *Session, _ []string) protocol.Reply { return e.handleRandomKey() },
+	},
+	{
+		name: "TOUCH", arity: -2, flags: flagReadonly, firstKey: 1, lastKey: -1, keyStep: 1,
+		categories: []string{"read", "keyspace", "fast"}, group: "generic",
+		summary: "Count the existing keys and update their access time", syntax: "key [key ...]",
+		handler: withParts((*Executor).handleTouch),
+	},
+	{
+		name: "OBJECT", arity: -2, flags: flagReadonly,
+		categories: []string{"read", "keyspace", "slow"}, group: "generic",
+		summary: "Inspect the internals of keys",
+		subcommands: map[string]*command{
+			"ENCODING": {arity: 3, firstKey: 2, lastKey: 2, keyStep: 1,
+				summary: "Get the internal encoding of a key's value", syntax: "key"},
+			"IDLETIME": {arity: 3, firstKey: 2, lastKey: 2, keyStep: 1,
+				summary: "Get the seconds since a key was last accessed", syntax: "key"},
+			"FREQ": {arity: 3, firstKey: 2, lastKey: 2, keyStep: 1,
+				summary: "Get a key's logarithmic access frequency", syntax: "key"},
+		},
+		handler: withParts((*Executor).handleObject),
+	},
+	{
+		name: "MOVE", arity: 3, flags: flagWrite, firstKey: 1, lastKey: 1, keyStep: 1,
+		categories: []string{"write", "keyspace", "fast"}, group: "generic",
+		summary: "Move a key to another database", syntax: "key db",
+		handler: withParts((*Executor).handleMove),
+	},
+	{
+		name: "DBSIZE", arity: 1, flags: flagReadonly,
+		categories: []string{"read", "keyspace", "fast"}, group: "server",
+		summary: "Count the keys in the selected database",
+		handler: func(e *Executor, _ *Session, _ []string) protocol.Reply { return e.handleDBSize() },
+	},
+	{
+		name: "SWAPDB", arity: 3, flags: flagWrite,
+		categories: []string{"write", "keyspace", "fast", "dangerous"}, group: "server",
+		summary: "Swap the contents of two databases", syntax: "index1 index2",
+		handler: withParts((*Executor).handleSwapDB),
+	},
+	{
+		name: "FLUSHDB", arity: 1, flags: flagWrite,
+		categories: []string{"write", "keyspace", "slow", "dangerous"}, group: "server",
+		summary: "Remove all keys from the selected database",
+		handler: func(e *Executor, _ *Session, _ []string) protocol.Reply { return e.handleFlushDB() },
+	},
+	{
+		name: "FLUSHALL", arity: 1, flags: flagWrite,
+		categories: []string{"write", "keyspace", "slow", "dangerous"}, group: "server",
+		summary: "Remove all keys from every database",
+		handler: func(e *Executor, _ *Session, _ []string) protocol.Reply { return e.handleFlushAll() },
+	},
+
+	// Transactions
+	{
+		name: "MULTI", arity: 1, flags: flagNoMulti,
+		categories: []string{"transaction", "fast"}, group: "transactions",
+		summary: "Start a transaction",
+		handler: withSession((*Executor).handleMulti),
+	},
+	{
+		name: "EXEC", arity: 1, flags: flagNoMulti,
+		categories: []string{"transaction", "slow"}, group: "transactions",
+		summary: "Run the commands queued since MULTI",
+		handler: withSession((*Executor).handleExec),
+	},
+	{
+		name: "DISCARD", arity: 1, flags: flagNoMulti,
+		categories: []string{"transaction", "fast"}, group: "transactions",
+		summary: "Discard the commands queued since MULTI",
+		handler: withSession((*Executor).handleDiscard),
+	},
+
+	// Connection
+	{
+		name: "PING", arity: -1, flags: flagNoAuth,
+		categories: []string{"connection", "fast"}, group: "connection",
+		summary: "Check the connection, echoing the message if given", syntax: "[message]",
+		handler: withParts((*Executor).handlePing),
+	},
+	{
+		name: "SELECT", arity: 2,
+		categories: []string{"connection", "fast"}, group: "connection",
+		summary: "Change the selected database of the connection", syntax: "index",
+		handler: (*Executor).handleSelect,
+	},
+	{
+		name: "AUTH", arity: -2, flags: flagNoAuth | flagNoMulti,
+		categories: []string{"connection", "fast"}, group: "connection",
+		summary: "Authenticate the connection", syntax: "[username] password",
+		handler: (*Executor).handleAuth,
+	},
+	{
+		name: "HELLO", arity: -1, flags: flagNoAuth | flagNoMulti,
+		categories: []string{"connection", "fast"}, group: "connection",
+		summary: "Handshake, optionally authenticating, and describe the server", syntax: "[AUTH username password]",
+		handler: (*Executor).handleHello,
+	},
+	{
+		name: "CLIENT", arity: -2, flags: flagAdmin,
+		categories: []string{"connection", "slow", "dangerous"}, group: "connection",
+		summary: "Manage client connections",
+		subcommands: map[string]*command{
+			"ID":      {arity: 2, summary: "Get the id of the connection"},
+			"INFO":    {arity: 2, summary: "Describe the connection"},
+			"LIST":    {arity: -2, summary: "List client connections", syntax: "[ID id [id ...]]"},
+			"SETNAME": {arity: 3, summary: "Set the connection name", syntax: "name"},
+			"GETNAME": {arity: 2, summary: "Get the connection name"},
+			"KILL": {arity: -3, summary: "Close client connections",
+				syntax: "addr|[ID id] [ADDR addr] [USER name] [SKIPME yes|no]"},
+			"PAUSE":   {arity: -3, summary: "Hold back client commands for a while", syntax: "timeout [WRITE|ALL]"},
+			"UNPAUSE": {arity: 2, summary: "Resume processing client commands"},
+		},
+		handler: (*Executor).handleClient,
+	},
+	{
+		name: "ASKING", arity: 1,
+		categories: []string{"connection", "fast"}, group: "cluster",
+		summary: "Let the next command access a slot being imported",
+		handler: withSession((*Executor).handleAsking),
+	},
+
+	// Pub/sub
+	{
+		name: "SUBSCRIBE", arity: -2, flags: flagPubSub | flagNoMulti,
+		categories: []string{"pubsub", "slow"}, group: "pubsub",
+		summary: "Listen for messages published to channels", syntax: "channel [channel ...]",
+		handler: (*Executor).handleSubscribe,
+	},
+	{
+		name: "UNSUBSCRIBE", arity: -1, flags: flagPubSub | flagNoMulti,
+		categories: []string{"pubsub", "slow"}, group: "pubsub",
+		summary: "Stop listening to channels, or to all of them", syntax: "[channel ...]",
+		handler: (*Executor).handleUnsubscribe,
+	},
+	{
+		name: "PSUBSCRIBE", arity: -2, flags: flagPubSub | flagNoMulti,
+		categories: []string{"pubsub", "slow"}, group: "pubsub",
+		summary: "Listen for messages published to channels matching patterns", syntax: "pattern [pattern ...]",
+		handler: (*Executor).handlePSubscribe,
+	},
+	{
+		name: "PUNSUBSCRIBE", arity: -1, flags: flagPubSub | flagNoMulti,
+		categories: []string{"pubsub", "slow"}, group: "pubsub",
+		summary: "Stop listening to patterns, or to all of them", syntax: "[pattern ...]",
+		handler: (*Executor).handlePUnsubscribe,
+	},
+	{
+		name: "PUBLISH", arity: -3, flags: flagPubSub,
+		categories: []string{"pubsub", "fast"}, group: "pubsub",
+		summary: "Post a message to a channel", syntax: "channel message",
+		handler: withParts((*Executor).handlePublish),
+	},
+	{
+		name: "PUBSUB", arity: -2, flags: flagPubSub,
+		categories: []string{"pubsub", "slow"}, group: "pubsub",
+		summary: "Inspect the state of pub/sub",
+		subcommands: map[string]*command{
+			"CHANNELS": {arity: -2, summary: "List active channels", syntax: "[pattern]"},
+			"NUMSUB":   {arity: -2, summary: "Count the subscribers of channels", syntax: "[channel ...]"},
+			"NUMPAT":   {arity: 2, summary: "Count the pattern subscriptions"},
+		},
+		handler: withParts((*Executor).handlePubSub),
+	},
+
+	// Server
+	{
+		name: "INFO", arity: -1,
+		categories: []string{"slow", "dangerous"}, group: "server",
+		summary: "Get information and statistics about the server", syntax: "[section ...]",
+		handler: withParts((*Executor).handleInfo),
+	},
+	{
+		name: "COMMAND", arity: -1,
+		categories: []string{"connection", "slow"}, group: "server",
+		summary: "Describe the server's commands",
+		subcommands: map[string]*command{
+			"COUNT": {arity: 2, summary: "Count the commands"},
+			"INFO":  {arity: -2, summary: "Describe commands, or all of them", syntax: "[command ...]"},
+			"DOCS":  {arity: -2, summary: "Document commands, or all of them", syntax: "[command ...]"},
+		},
+		handler: withParts((*Executor).handleCommand),
+	},
+	{
+		name: "CONFIG", arity: -2, flags: flagAdmin,
+		categories: []string{"admin", "slow", "dangerous"}, group: "server",
+		summary: "Read and change the server configuration",
+		subcommands: map[string]*command{
+			"GET":       {arity: -3, summary: "Get configuration parameters", syntax: "pattern [pattern ...]"},
+			"SET":       {arity: -4, summary: "Set configuration parameters", syntax: "parameter value [parameter value ...]"},
+			"RESETSTAT": {arity: 2, summary: "Reset the statistics reported by INFO"},
+			"REWRITE":   {arity: 2, summary: "Save the configuration to the config file"},
+		},
+		handler: withParts((*Executor).handleConfig),
+	},
+	{
+		name: "SLOWLOG", arity: -2, flags: flagAdmin,
+		categories: []string{"admin", "slow", "dangerous"}, group: "server",
+		summary: "Inspect the log of slow commands",
+		subcommands: map[string]*command{
+			"GET":   {arity: -2, summary: "Get the newest entries", syntax: "[count]"},
+			"LEN":   {arity: 2, summary: "Count the entries"},
+			"RESET": {arity: 2, summary: "Clear the log"},
+		},
+		handler: withParts((*Executor).handleSlowlog),
+	},
+	{
+		name: "MONITOR", arity: 1, flags: flagAdmin | flagNoMulti,
+		categories: []string{"admin", "slow", "dangerous"}, group: "server",
+		summary: "Stream every command the server processes",
+		handler: withSession((*Executor).handleMonitor),
+	},
+	{
+		name: "ACL", arity: -2, flags: flagAdmin,
+		categories: []string{"admin", "slow", "dangerous"}, group: "server",
+		summary: "Manage users and their permissions",
+		subcommands: map[string]*command{
+			"WHOAMI":  {arity: 2, summary: "Get the user of the connection"},
+			"SETUSER": {arity: -3, summary: "Create or modify a user", syntax: "username [rule ...]"},
+			"GETUSER": {arity: 3, summary: "Describe a user", syntax: "username"},
+			"DELUSER": {arity: -3, summary: "Delete users", syntax: "username [username ...]"},
+			"LIST":    {arity: 2, summary: "List users with their rules"},
+			"USERS":   {arity: 2, summary: "List user names"},
+			"CAT":     {arity: -2, summary: "List categories, or the commands in one", syntax: "[category]"},
+			"LOAD":    {arity: 2, summary: "Reload users from the ACL file"},
+			"SAVE":    {arity: 2, summary: "Save users to the ACL file"},
+		},
+		handler: (*Executor).handleACL,
+	},
+
+	// Replication
+	{
+		name: "REPLICAOF", arity: 3, flags: flagAdmin | flagNoMulti,
+		categories: []string{"admin", "slow", "dangerous"}, group: "server",
+		summary: "Replicate from a leader, or stop with NO ONE", syntax: "host port",
+		handler: withParts((*Executor).handleReplicaOf),
+	},
+	{
+		name: "PSYNC", arity: 3, flags: flagAdmin | flagNoMulti,
+		categories: []string{"admin", "slow", "dangerous"}, group: "server",
+		summary: "Start the replication stream (used by replicas)", syntax: "replication-id offset",
+		handler: (*Executor).handlePSync,
+	},
+	{
+		name: "ROLE", arity: 1,
+		categories: []string{"admin", "fast", "dangerous"}, group: "server",
+		summary: "Get the replication role of the server",
+		handler: func(e *Executor, _ *Session, _ []string) protocol.Reply { return e.handleRole() },
+	},
+	{
+		name: "RAFT", arity: -2, flags: flagAdmin | flagNoMulti,
+		categories: []string{"admin", "slow", "dangerous"}, group: "server",
+		summary: "Inspect and change the Raft membership",
+		subcommands: map[string]*command{
+			"STATUS": {arity: 2, summary: "Describe this node's view of the cluster"},
+			"ADD":    {arity: 4, summary: "Add a member", syntax: "id address"},
+			"REMOVE": {arity: 3, summary: "Remove a member", syntax: "id"},
+		},
+		// Reached only with Raft disabled: ProcessCommand runs RAFT
+		// itself, without holding e.mu
+		handler: func(*Executor, *Session, []string) protocol.Reply {
+			return protocol.Error("ERR This instance has Raft disabled")
+		},
+	},
+
+	// Cluster
+	{
+		name: "CLUSTER", arity: -2, flags: flagAdmin,
+		categories: []string{"admin", "slow"}, group: "cluster",
+		summary: "Manage hash slots and cluster nodes",
+		subcommands: map[string]*command{
+			"KEYSLOT":         {arity: 3, summary: "Get the hash slot of a key", syntax: "key"},
+			"MYID":            {arity: 2, summary: "Get this node's id"},
+			"MEET":            {arity: 5, summary: "Add a node to the cluster", syntax: "id host port"},
+			"FORGET":          {arity: 3, summary: "Remove a node from the cluster", syntax: "id"},
+			"ADDSLOTS":        {arity: -3, summary: "Assign slots to this node", syntax: "slot [slot ...]"},
+			"ADDSLOTSRANGE":   {arity: -4, summary: "Assign ranges of slots to this node", syntax: "start end [start end ...]"},
+			"DELSLOTS":        {arity: -3, summary: "Unassign slots", syntax: "slot [slot ...]"},
+			"SETSLOT":         {arity: -4, summary: "Change the state of a slot", syntax: "slot IMPORTING|MIGRATING|NODE|STABLE [node-id]"},
+			"SETSLOTRANGE":    {arity: 6, summary: "Assign a range of slots to a node", syntax: "start end NODE node-id"},
+			"SLOTS":           {arity: 2, summary: "Get slot ranges and their nodes"},
+			"NODES":           {arity: 2, summary: "Describe the cluster nodes"},
+			"COUNTKEYSINSLOT": {arity: 3, summary: "Count the local keys in a slot", syntax: "slot"},
+			"GETKEYSINSLOT":   {arity: 4, summary: "Get local keys in a slot", syntax: "slot count"},
+		},
+		handler: withParts((*Executor).handleCluster),
+	},
+	{
+		name: "MIGRATE", arity: -4, flags: flagWrite | flagBlocking | flagNoMulti, firstKey: 3, lastKey: 3, keyStep: 1,
+		categories: []string{"write", "keyspace", "slow", "dangerous"}, group: "cluster",
+		summary: "Move a key and its TTL to another node", syntax: "host port key [AUTH password | AUTH2 username password]",
+		handler: (*Executor).handleMigrate,
+	},
+}
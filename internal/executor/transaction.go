@@ -0,0 +1,90 @@
+package executor
+
+import (
+	"strings"
+
+	"memkv/internal/protocol"
+)
+
+// transactionCommands control a transaction and are run, not queued,
+// between MULTI and EXEC
+var transactionCommands = map[string]bool{
+	"MULTI":   true,
+	"EXEC":    true,
+	"DISCARD": true,
+}
+
+// transaction holds the commands queued between MULTI and EXEC
+type transaction struct {
+	queued [][]string
+
+	// failed is set when a command was rejected while queuing, which
+	// makes EXEC discard the transaction
+	failed bool
+}
+
+// hasWrites reports whether a write command is queued
+func (tx *transaction) hasWrites() bool {
+	for _, parts := range tx.queued {
+		if isWrite(strings.ToUpper(parts[0])) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Executor) handleMulti(sess *Session) protocol.Reply {
+	if sess.tx != nil {
+		return protocol.Error("ERR MULTI calls can not be nested")
+	}
+	// Writes are proposed one at a time under Raft, which can't apply
+	// a group of them atomically
+	if e.raft != nil {
+		return protocol.Error("ERR MULTI is not supported with Raft consensus")
+	}
+	sess.tx = &transaction{}
+	return protocol.OK
+}
+
+// queueCommand adds a command to the session's transaction. Commands
+// that can't be part of one mark the transaction as failed.
+func (e *Executor) queueCommand(sess *Session, c *command, parts []string) protocol.Reply {
+	if c.flags&flagNoMulti != 0 {
+		sess.tx.failed = true
+		return protocol.Errorf("ERR '%s' is not allowed in a transaction", strings.ToUpper(parts[0]))
+	}
+	sess.tx.queued = append(sess.tx.queued, parts)
+	return protocol.Status("QUEUED")
+}
+
+// handleExec runs the queued commands without any other command in
+// between and returns their replies. Replicas and the WAL receive the
+// writes one by one.
+func (e *Executor) handleExec(sess *Session) protocol.Reply {
+	tx := sess.tx
+	if tx == nil {
+		return protocol.Error("ERR EXEC without MULTI")
+	}
+	sess.tx = nil
+	if tx.failed {
+		return protocol.Error("EXECABORT Transaction discarded because of previous errors")
+	}
+
+	replies := make([]protocol.Reply, len(tx.queued))
+	for i, parts := range tx.queued {
+		if e.follower != nil && isWrite(strings.ToUpper(parts[0])) && !sess.master {
+			replies[i] = protocol.Error("READONLY You can't write against a read only replica")
+			continue
+		}
+		replies[i] = e.execute(sess, parts)
+	}
+	return protocol.Array(replies...)
+}
+
+func (e *Executor) handleDiscard(sess *Session) protocol.Reply {
+	if sess.tx == nil {
+		return protocol.Error("ERR DISCARD without MULTI")
+	}
+	sess.tx = nil
+	return protocol.OK
+}
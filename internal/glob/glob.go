@@ -0,0 +1,99 @@
+package glob
+
+// Match reports whether s matches the glob pattern.
+// Supported syntax: '*' matches any sequence, '?' matches any single
+// character, '[abc]' / '[a-z]' / '[^a]' match character classes and
+// '\' escapes the next character.
+func Match(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			// Collapse consecutive stars
+			for len(pattern) > 0 && pattern[0] == '*' {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(s); i++ {
+				if Match(pattern, s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+			pattern = pattern[1:]
+			s = s[1:]
+		case '[':
+			if len(s) == 0 {
+				return false
+			}
+			matched, rest, ok := matchClass(pattern[1:], s[0])
+			if !ok {
+				// Unterminated class, treat '[' literally
+				if s[0] != '[' {
+					return false
+				}
+				pattern = pattern[1:]
+				s = s[1:]
+				continue
+			}
+			if !matched {
+				return false
+			}
+			pattern = rest
+			s = s[1:]
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+		default:
+			if len(s) == 0 || pattern[0] != s[0] {
+				return false
+			}
+			pattern = pattern[1:]
+			s = s[1:]
+		}
+	}
+	return len(s) == 0
+}
+
+// matchClass matches c against the character class at the start of
+// pattern (just after '['). It returns the remaining pattern after ']'.
+func matchClass(pattern string, c byte) (matched bool, rest string, ok bool) {
+	negate := false
+	if len(pattern) > 0 && pattern[0] == '^' {
+		negate = true
+		pattern = pattern[1:]
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case pattern[i] == ']' && i > 0:
+			return matched != negate, pattern[i+1:], true
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			if pattern[i] == c {
+				matched = true
+			}
+		case i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']':
+			lo, hi := pattern[i], pattern[i+2]
+			if lo > hi {
+				lo, hi = hi, lo
+			}
+			if c >= lo && c <= hi {
+				matched = true
+			}
+			i += 2
+		default:
+			if pattern[i] == c {
+				matched = true
+			}
+		}
+	}
+	return false, "", false
+}
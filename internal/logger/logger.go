@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -26,10 +28,25 @@ var logLevelNames = map[LogLevel]string{
 	FATAL: "FATAL",
 }
 
+// String returns the level name in lower case, as used in configuration
+func (l LogLevel) String() string {
+	return strings.ToLower(logLevelNames[l])
+}
+
+// ParseLevel parses a level name such as "info" (case-insensitive)
+func ParseLevel(name string) (LogLevel, error) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return INFO, fmt.Errorf("unknown log level '%s'", name)
+}
+
 // Logger handles logging with different levels and components
 type Logger struct {
 	component string
-	level     LogLevel
+	level     atomic.Int32 // LogLevel, may change while logging
 	output    io.Writer
 }
 
@@ -40,25 +57,27 @@ var (
 
 // init initializes the default logger
 func init() {
-	defaultLogger = &Logger{
-		component: "default",
-		level:     INFO,
-		output:    os.Stdout,
-	}
+	defaultLogger = New("default")
 }
 
 // New creates a new logger for a specific component
 func New(component string) *Logger {
-	return &Logger{
+	l := &Logger{
 		component: component,
-		level:     INFO,
 		output:    os.Stdout,
 	}
+	l.SetLevel(INFO)
+	return l
 }
 
 // SetLevel sets the log level for this logger
 func (l *Logger) SetLevel(level LogLevel) {
-	l.level = level
+	l.level.Store(int32(level))
+}
+
+// Level returns the current log level
+func (l *Logger) Level() LogLevel {
+	return LogLevel(l.level.Load())
 }
 
 // SetOutput sets the output destination for this logger
@@ -69,7 +88,7 @@ func (l *Logger) SetOutput(w io.Writer) {
 // log formats and prints a message if its level is >= the current log level
 func (l *Logger) log(level LogLevel, format string, args ...interface{}) {
 
-	if level < l.level {
+	if level < l.Level() {
 		return
 	}
 
@@ -117,6 +136,11 @@ func SetDefaultLevel(level LogLevel) {
 	defaultLogger.SetLevel(level)
 }
 
+// DefaultLevel returns the log level of the default logger
+func DefaultLevel() LogLevel {
+	return defaultLogger.Level()
+}
+
 // SetDefaultOutput sets the output for the default logger
 func SetDefaultOutput(w io.Writer) {
 	defaultLogger.SetOutput(w)
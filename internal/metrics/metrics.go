@@ -0,0 +1,159 @@
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefBuckets are the default histogram buckets in seconds, spanning fast
+// in-memory commands up to slow disk syncs
+var DefBuckets = []float64{
+	0.00001, 0.000025, 0.00005, 0.0001, 0.00025, 0.0005,
+	0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1,
+}
+
+// Counter is a monotonically increasing value. It is safe for
+// concurrent use and never blocks.
+type Counter struct {
+	v atomic.Uint64
+}
+
+// Inc adds one to the counter
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add adds n to the counter
+func (c *Counter) Add(n uint64) {
+	c.v.Add(n)
+}
+
+// Value returns the current count
+func (c *Counter) Value() uint64 {
+	return c.v.Load()
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	bits atomic.Uint64
+}
+
+// Set sets the gauge to v
+func (g *Gauge) Set(v float64) {
+	g.bits.Store(math.Float64bits(v))
+}
+
+// Add adds delta (which may be negative) to the gauge
+func (g *Gauge) Add(delta float64) {
+	addFloat(&g.bits, delta)
+}
+
+// Value returns the current value
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(g.bits.Load())
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	upper  []float64
+	counts []atomic.Uint64 // per bucket, the last one is +Inf
+	count  atomic.Uint64
+	sum    atomic.Uint64 // float64 bits
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	upper := append([]float64(nil), buckets...)
+	sort.Float64s(upper)
+	return &Histogram{
+		upper:  upper,
+		counts: make([]atomic.Uint64, len(upper)+1),
+	}
+}
+
+// Observe records a value
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.upper, v)
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	addFloat(&h.sum, v)
+}
+
+// ObserveDuration records d in seconds
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+// snapshot returns the cumulative bucket counts, total count and sum
+func (h *Histogram) snapshot() ([]uint64, uint64, float64) {
+	cumulative := make([]uint64, len(h.counts))
+	var total uint64
+	for i := range h.counts {
+		total += h.counts[i].Load()
+		cumulative[i] = total
+	}
+	return cumulative, total, math.Float64frombits(h.sum.Load())
+}
+
+// CounterVec is a set of counters partitioned by one label
+type CounterVec struct {
+	mu       sync.RWMutex
+	counters map[string]*Counter
+}
+
+// With returns the counter for the label value, creating it if needed
+func (v *CounterVec) With(value string) *Counter {
+	v.mu.RLock()
+	c, ok := v.counters[value]
+	v.mu.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if c, ok = v.counters[value]; !ok {
+		c = &Counter{}
+		v.counters[value] = c
+	}
+	return c
+}
+
+// HistogramVec is a set of histograms partitioned by one label
+type HistogramVec struct {
+	buckets []float64
+
+	mu         sync.RWMutex
+	histograms map[string]*Histogram
+}
+
+// With returns the histogram for the label value, creating it if needed
+func (v *HistogramVec) With(value string) *Histogram {
+	v.mu.RLock()
+	h, ok := v.histograms[value]
+	v.mu.RUnlock()
+	if ok {
+		return h
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if h, ok = v.histograms[value]; !ok {
+		h = newHistogram(v.buckets)
+		v.histograms[value] = h
+	}
+	return h
+}
+
+// addFloat atomically adds delta to the float64 stored in bits
+func addFloat(bits *atomic.Uint64, delta float64) {
+	for {
+		old := bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// metric is a registered metric family
+type metric struct {
+	name  string
+	help  string
+	typ   string
+	label string // label name of vectors, "" otherwise
+	write func(w *bufio.Writer, m *metric)
+}
+
+// Registry holds metrics and renders them in the Prometheus text format
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*metric
+	names   map[string]bool
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// Default is the registry the package-level constructors register with
+var Default = NewRegistry()
+
+func (r *Registry) register(m *metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[m.name] {
+		panic(fmt.Sprintf("metrics: %s registered twice", m.name))
+	}
+	r.names[m.name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// NewCounter registers a counter
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{}
+	r.register(&metric{name: name, help: help, typ: "counter", write: func(w *bufio.Writer, m *metric) {
+		writeSample(w, m.name, "", formatUint(c.Value()))
+	}})
+	return c
+}
+
+// NewGauge registers a gauge
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{}
+	r.register(&metric{name: name, help: help, typ: "gauge", write: func(w *bufio.Writer, m *metric) {
+		writeSample(w, m.name, "", formatFloat(g.Value()))
+	}})
+	return g
+}
+
+// NewHistogram registers a histogram with the given bucket upper bounds
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := newHistogram(buckets)
+	r.register(&metric{name: name, help: help, typ: "histogram", write: func(w *bufio.Writer, m *metric) {
+		writeHistogram(w, m.name, "", h)
+	}})
+	return h
+}
+
+// NewCounterVec registers a counter partitioned by label
+func (r *Registry) NewCounterVec(name, help, label string) *CounterVec {
+	v := &CounterVec{counters: make(map[string]*Counter)}
+	r.register(&metric{name: name, help: help, typ: "counter", label: label, write: func(w *bufio.Writer, m *metric) {
+		v.mu.RLock()
+		defer v.mu.RUnlock()
+		for _, value := range sortedKeys(v.counters) {
+			writeSample(w, m.name, labelPair(m.label, value), formatUint(v.counters[value].Value()))
+		}
+	}})
+	return v
+}
+
+// NewHistogramVec registers a histogram partitioned by label
+func (r *Registry) NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	v := &HistogramVec{buckets: buckets, histograms: make(map[string]*Histogram)}
+	r.register(&metric{name: name, help: help, typ: "histogram", label: label, write: func(w *bufio.Writer, m *metric) {
+		v.mu.RLock()
+		defer v.mu.RUnlock()
+		for _, value := range sortedKeys(v.histograms) {
+			writeHistogram(w, m.name, labelPair(m.label, value), v.histograms[value])
+		}
+	}})
+	return v
+}
+
+// NewCounter registers a counter with the default registry
+func NewCounter(name, help string) *Counter {
+	return Default.NewCounter(name, help)
+}
+
+// NewGauge registers a gauge with the default registry
+func NewGauge(name, help string) *Gauge {
+	return Default.NewGauge(name, help)
+}
+
+// NewHistogram registers a histogram with the default registry
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	return Default.NewHistogram(name, help, buckets)
+}
+
+// NewCounterVec registers a counter vector with the default registry
+func NewCounterVec(name, help, label string) *CounterVec {
+	return Default.NewCounterVec(name, help, label)
+}
+
+// NewHistogramVec registers a histogram vector with the default registry
+func NewHistogramVec(name, help, label string, buckets []float64) *HistogramVec {
+	return Default.NewHistogramVec(name, help, label, buckets)
+}
+
+// Write writes all metrics in the Prometheus text exposition format
+func (r *Registry) Write(out io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]*metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+
+	w := bufio.NewWriter(out)
+	for _, m := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+		fmt.Fprintf(w, "# TYPE %s %s\n", m.name, m.typ)
+		m.write(w, m)
+	}
+	return w.Flush()
+}
+
+// Handler serves the default registry over HTTP
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		Default.Write(w)
+	})
+}
+
+func writeSample(w *bufio.Writer, name, labels, value string) {
+	if labels != "" {
+		fmt.Fprintf(w, "%s{%s} %s\n", name, labels, value)
+	} else {
+		fmt.Fprintf(w, "%s %s\n", name, value)
+	}
+}
+
+func writeHistogram(w *bufio.Writer, name, labels string, h *Histogram) {
+	cumulative, count, sum := h.snapshot()
+
+	prefix := ""
+	if labels != "" {
+		prefix = labels + ","
+	}
+	for i, upper := range h.upper {
+		writeSample(w, name+"_bucket", prefix+labelPair("le", formatFloat(upper)), formatUint(cumulative[i]))
+	}
+	writeSample(w, name+"_bucket", prefix+labelPair("le", "+Inf"), formatUint(count))
+	writeSample(w, name+"_sum", labels, formatFloat(sum))
+	writeSample(w, name+"_count", labels, formatUint(count))
+}
+
+func labelPair(name, value string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return name + `="` + r.Replace(value) + `"`
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func formatUint(v uint64) string {
+	return strconv.FormatUint(v, 10)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,43 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInlineArgument is returned for arguments an inline command can't
+// carry
+var ErrInlineArgument = errors.New("argument can't be sent inline")
+
+// valueCommands join their arguments after the key into one value, so
+// their last argument may contain spaces
+var valueCommands = map[string]bool{
+	"SET":     true,
+	"PUBLISH": true,
+}
+
+// Inline encodes args as an inline command, without the line ending.
+// Commands are split on whitespace, so arguments can't be empty or
+// contain whitespace, except the value of SET and PUBLISH, which may
+// contain single spaces between words.
+func Inline(args []string) (string, error) {
+	if len(args) == 0 {
+		return "", fmt.Errorf("%w: empty command", ErrInlineArgument)
+	}
+	last := len(args) - 1
+	for i, arg := range args {
+		if strings.ContainsAny(arg, "\r\n") {
+			return "", fmt.Errorf("%w: %q contains a line break", ErrInlineArgument, arg)
+		}
+		fields := strings.Fields(arg)
+		if len(fields) == 1 && fields[0] == arg {
+			continue
+		}
+		spacedValue := i == last && i >= 2 && valueCommands[strings.ToUpper(args[0])]
+		if !spacedValue || len(fields) == 0 || strings.Join(fields, " ") != arg {
+			return "", fmt.Errorf("%w: %q", ErrInlineArgument, arg)
+		}
+	}
+	return strings.Join(args, " "), nil
+}
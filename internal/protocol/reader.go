@@ -0,0 +1,99 @@
+package protocol
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ErrProtocol is returned for malformed replies
+var ErrProtocol = errors.New("protocol error")
+
+const (
+	// maxBulkLen bounds the size of a single bulk string
+	maxBulkLen = 512 << 20
+
+	// maxArrayLen bounds the number of elements of an array. Snapshots
+	// sent to replicas are a single array, hence the generous limit.
+	maxArrayLen = 1 << 30
+
+	// arrayPrealloc bounds the elements allocated before they are read,
+	// so a length announced by a broken peer can't exhaust memory
+	arrayPrealloc = 1024
+)
+
+// ReadReply reads one reply from r
+func ReadReply(r *bufio.Reader) (Reply, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return Reply{}, err
+	}
+	if line == "" {
+		return Reply{}, fmt.Errorf("%w: empty line", ErrProtocol)
+	}
+
+	body := line[1:]
+	switch Type(line[0]) {
+	case StatusType:
+		return Status(body), nil
+	case ErrorType:
+		return Error(body), nil
+	case IntegerType:
+		n, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return Reply{}, fmt.Errorf("%w: invalid integer %q", ErrProtocol, body)
+		}
+		return Integer(n), nil
+	case BulkType:
+		n, err := strconv.Atoi(body)
+		if err != nil || n < -1 || n > maxBulkLen {
+			return Reply{}, fmt.Errorf("%w: invalid bulk length %q", ErrProtocol, body)
+		}
+		if n == -1 {
+			return Nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return Reply{}, err
+		}
+		if string(data[n:]) != "\r\n" {
+			return Reply{}, fmt.Errorf("%w: bulk string not terminated", ErrProtocol)
+		}
+		return Bulk(string(data[:n])), nil
+	case ArrayType:
+		n, err := strconv.Atoi(body)
+		if err != nil || n < -1 || n > maxArrayLen {
+			return Reply{}, fmt.Errorf("%w: invalid array length %q", ErrProtocol, body)
+		}
+		if n == -1 {
+			return Nil, nil
+		}
+		elems := make([]Reply, 0, min(n, arrayPrealloc))
+		for i := 0; i < n; i++ {
+			elem, err := ReadReply(r)
+			if err != nil {
+				return Reply{}, err
+			}
+			elems = append(elems, elem)
+		}
+		return Array(elems...), nil
+	default:
+		return Reply{}, fmt.Errorf("%w: unexpected reply type %q", ErrProtocol, line[0])
+	}
+}
+
+// Parse decodes a single reply from its wire encoding
+func Parse(data string) (Reply, error) {
+	return ReadReply(bufio.NewReader(strings.NewReader(data)))
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r"), nil
+}
@@ -0,0 +1,160 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Type identifies the kind of a reply
+type Type byte
+
+// Reply types and their wire prefixes. Nil is sent as a bulk string of
+// length -1.
+const (
+	StatusType  Type = '+'
+	ErrorType   Type = '-'
+	IntegerType Type = ':'
+	BulkType    Type = '$'
+	ArrayType   Type = '*'
+	NilType     Type = '_'
+
+	// encodedType carries data that is already in wire format
+	encodedType Type = 0
+)
+
+// Reply is a typed server reply. Replies are framed on the wire as
+//
+//	+status\r\n
+//	-error message\r\n
+//	:integer\r\n
+//	$length\r\nbytes\r\n   ($-1\r\n for nil)
+//	*count\r\n followed by count replies
+type Reply struct {
+	Type  Type
+	Str   string // status, error and bulk
+	Int   int64
+	Elems []Reply
+	raw   []byte
+}
+
+// Common replies
+var (
+	OK   = Status("OK")
+	Nil  = Reply{Type: NilType}
+	Zero = Integer(0)
+	One  = Integer(1)
+)
+
+// Status creates a status reply, for short non-binary strings such as "OK"
+func Status(s string) Reply {
+	return Reply{Type: StatusType, Str: s}
+}
+
+// Error creates an error reply. By convention msg starts with an error
+// code such as ERR, MOVED or NOAUTH.
+func Error(msg string) Reply {
+	return Reply{Type: ErrorType, Str: msg}
+}
+
+// Errorf creates an error reply from a format string
+func Errorf(format string, args ...any) Reply {
+	return Error(fmt.Sprintf(format, args...))
+}
+
+// Integer creates an integer reply
+func Integer(n int64) Reply {
+	return Reply{Type: IntegerType, Int: n}
+}
+
+// Bulk creates a bulk string reply, safe for any bytes
+func Bulk(s string) Reply {
+	return Reply{Type: BulkType, Str: s}
+}
+
+// Array creates an array reply
+func Array(elems ...Reply) Reply {
+	if elems == nil {
+		elems = []Reply{}
+	}
+	return Reply{Type: ArrayType, Elems: elems}
+}
+
+// BulkArray creates an array of bulk strings
+func BulkArray(strs []string) Reply {
+	elems := make([]Reply, len(strs))
+	for i, s := range strs {
+		elems[i] = Bulk(s)
+	}
+	return Array(elems...)
+}
+
+// Encoded wraps data already in wire format, such as the replication
+// stream, so it can be sent as is
+func Encoded(data []byte) Reply {
+	return Reply{Type: encodedType, raw: data}
+}
+
+// IsError reports whether r is an error reply
+func (r Reply) IsError() bool {
+	return r.Type == ErrorType
+}
+
+// Bytes returns the wire encoding of r
+func (r Reply) Bytes() []byte {
+	return r.AppendTo(nil)
+}
+
+// AppendTo appends the wire encoding of r to buf
+func (r Reply) AppendTo(buf []byte) []byte {
+	switch r.Type {
+	case StatusType, ErrorType:
+		// Line breaks would end the frame early
+		buf = append(buf, byte(r.Type))
+		buf = append(buf, strings.NewReplacer("\r", " ", "\n", " ").Replace(r.Str)...)
+		return append(buf, "\r\n"...)
+	case IntegerType:
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, r.Int, 10)
+		return append(buf, "\r\n"...)
+	case BulkType:
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(r.Str)), 10)
+		buf = append(buf, "\r\n"...)
+		buf = append(buf, r.Str...)
+		return append(buf, "\r\n"...)
+	case ArrayType:
+		buf = append(buf, '*')
+		buf = strconv.AppendInt(buf, int64(len(r.Elems)), 10)
+		buf = append(buf, "\r\n"...)
+		for _, elem := range r.Elems {
+			buf = elem.AppendTo(buf)
+		}
+		return buf
+	case NilType:
+		return append(buf, "$-1\r\n"...)
+	default:
+		return append(buf, r.raw...)
+	}
+}
+
+// String renders r as plain text: strings as is, integers in decimal,
+// nil as "(nil)" and array elements on separate lines
+func (r Reply) String() string {
+	switch r.Type {
+	case StatusType, ErrorType, BulkType:
+		return r.Str
+	case IntegerType:
+		return strconv.FormatInt(r.Int, 10)
+	case ArrayType:
+		lines := make([]string, len(r.Elems))
+		for i, elem := range r.Elems {
+			lines[i] = elem.String()
+		}
+		return strings.Join(lines, "\n")
+	case NilType:
+		return "(nil)"
+	default:
+		return string(r.raw)
+	}
+}
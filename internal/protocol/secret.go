@@ -0,0 +1,17 @@
+package protocol
+
+import "strings"
+
+// secretCommands carry passwords in their arguments
+var secretCommands = map[string]bool{
+	"AUTH":    true,
+	"HELLO":   true,
+	"ACL":     true,
+	"MIGRATE": true,
+}
+
+// IsSecret reports whether the command carries credentials, which must
+// be kept out of monitors, the slow log and client history
+func IsSecret(name string) bool {
+	return secretCommands[strings.ToUpper(name)]
+}
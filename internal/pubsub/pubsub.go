@@ -0,0 +1,121 @@
+package pubsub
+
+import (
+	"sort"
+
+	"memkv/internal/glob"
+)
+
+// Subscriber receives messages published to the channels and patterns
+// it is subscribed to. A message is ["message", channel, payload] or
+// ["pmessage", pattern, channel, payload].
+type Subscriber interface {
+	Deliver(msg []string)
+}
+
+// Hub tracks channel and pattern subscriptions and fans out messages
+type Hub struct {
+	channels map[string]map[Subscriber]struct{}
+	patterns map[string]map[Subscriber]struct{}
+}
+
+// NewHub creates an empty pub/sub hub
+func NewHub() *Hub {
+	return &Hub{
+		channels: make(map[string]map[Subscriber]struct{}),
+		patterns: make(map[string]map[Subscriber]struct{}),
+	}
+}
+
+// Subscribe adds s to channel. It returns false if s was already subscribed.
+func (h *Hub) Subscribe(s Subscriber, channel string) bool {
+	return add(h.channels, s, channel)
+}
+
+// Unsubscribe removes s from channel. It returns false if s was not subscribed.
+func (h *Hub) Unsubscribe(s Subscriber, channel string) bool {
+	return remove(h.channels, s, channel)
+}
+
+// PSubscribe adds s to every channel matching the glob pattern
+func (h *Hub) PSubscribe(s Subscriber, pattern string) bool {
+	return add(h.patterns, s, pattern)
+}
+
+// PUnsubscribe removes the pattern subscription of s
+func (h *Hub) PUnsubscribe(s Subscriber, pattern string) bool {
+	return remove(h.patterns, s, pattern)
+}
+
+// Publish delivers message to all subscribers of channel and of every
+// matching pattern, and returns the number of deliveries
+func (h *Hub) Publish(channel, message string) int {
+	receivers := 0
+
+	for s := range h.channels[channel] {
+		s.Deliver([]string{"message", channel, message})
+		receivers++
+	}
+
+	for pattern, subs := range h.patterns {
+		if !glob.Match(pattern, channel) {
+			continue
+		}
+		for s := range subs {
+			s.Deliver([]string{"pmessage", pattern, channel, message})
+			receivers++
+		}
+	}
+
+	return receivers
+}
+
+// Channels returns the active channels matching pattern (all if empty)
+func (h *Hub) Channels(pattern string) []string {
+	channels := make([]string, 0, len(h.channels))
+	for ch := range h.channels {
+		if pattern == "" || glob.Match(pattern, ch) {
+			channels = append(channels, ch)
+		}
+	}
+	sort.Strings(channels)
+	return channels
+}
+
+// NumSub returns the number of subscribers of channel (patterns excluded)
+func (h *Hub) NumSub(channel string) int {
+	return len(h.channels[channel])
+}
+
+// NumPat returns the number of distinct subscribed patterns
+func (h *Hub) NumPat() int {
+	return len(h.patterns)
+}
+
+func add(m map[string]map[Subscriber]struct{}, s Subscriber, name string) bool {
+	subs, ok := m[name]
+	if !ok {
+		subs = make(map[Subscriber]struct{})
+		m[name] = subs
+	}
+	if _, ok := subs[s]; ok {
+		return false
+	}
+	subs[s] = struct{}{}
+	return true
+}
+
+func remove(m map[string]map[Subscriber]struct{}, s Subscriber, name string) bool {
+	subs, ok := m[name]
+	if !ok {
+		return false
+	}
+	if _, ok := subs[s]; !ok {
+		return false
+	}
+	delete(subs, s)
+	if len(subs) == 0 {
+		delete(m, name)
+	}
+	return true
+}
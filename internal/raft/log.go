@@ -0,0 +1,374 @@
+package raft
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"memkv/internal/wal"
+)
+
+// WAL record types used to persist Raft state
+const (
+	opTerm     = "TERM"     // Key: term, Value: votedFor ("-" for none)
+	opEntry    = "ENTRY"    // Key: index:term:type, Value: base64 data
+	opTruncate = "TRUNCATE" // Key: first index removed
+)
+
+// emptyValue stands in for empty record values, which the WAL's
+// space-separated format cannot represent
+const emptyValue = "-"
+
+// EntryType distinguishes client commands from internal entries
+type EntryType int
+
+const (
+	EntryCommand EntryType = iota
+	EntryConfig
+	EntryNoop
+)
+
+// LogEntry is a single entry of the replicated log
+type LogEntry struct {
+	Index int64
+	Term  int64
+	Type  EntryType
+	Data  string
+}
+
+// raftLog is the durable part of a node's state: current term, vote,
+// log entries and the latest snapshot. Entries and votes are appended to
+// the server's WAL; snapshots live in a separate file next to it.
+type raftLog struct {
+	w        *wal.FileWAL
+	snapPath string
+
+	term     int64
+	votedFor string
+
+	entries   []LogEntry // entries following the snapshot
+	snapIndex int64
+	snapTerm  int64
+	snapPeers map[string]string
+	snapData  string
+	snapTime  time.Time // when the snapshot was written, zero if none
+}
+
+// openLog opens (or creates) the Raft log stored at path
+func openLog(path string) (*raftLog, error) {
+	w, err := wal.NewFileWAL(path)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &raftLog{
+		w:        w,
+		snapPath: path + ".snap",
+	}
+
+	if err := l.loadSnapshot(); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	if err := w.Replay(l.replay); err != nil {
+		w.Close()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+func (l *raftLog) replay(e *wal.Entry) error {
+	switch e.Op {
+	case opTerm:
+		term, err := strconv.ParseInt(e.Key, 10, 64)
+		if err != nil {
+			return err
+		}
+		l.term = term
+		l.votedFor = ""
+		if e.Value != emptyValue {
+			l.votedFor = e.Value
+		}
+	case opEntry:
+		entry, err := decodeEntry(e.Key, e.Value)
+		if err != nil {
+			return err
+		}
+		if entry.Index <= l.snapIndex {
+			return nil
+		}
+		l.truncateFrom(entry.Index)
+		l.entries = append(l.entries, entry)
+	case opTruncate:
+		index, err := strconv.ParseInt(e.Key, 10, 64)
+		if err != nil {
+			return err
+		}
+		l.truncateFrom(index)
+	case wal.OpSet, wal.OpSetKeepTTL, wal.OpDelete, wal.OpExpire:
+		return fmt.Errorf("the WAL holds data written without Raft (%s record), start Raft nodes from an empty WAL", e.Op)
+	default:
+		return fmt.Errorf("unknown raft log record: %s", e.Op)
+	}
+	return nil
+}
+
+func encodeEntry(entry LogEntry) *wal.Entry {
+	value := emptyValue
+	if entry.Data != "" {
+		value = base64.StdEncoding.EncodeToString([]byte(entry.Data))
+	}
+	return &wal.Entry{
+		Op:    opEntry,
+		Key:   fmt.Sprintf("%d:%d:%d", entry.Index, entry.Term, entry.Type),
+		Value: value,
+	}
+}
+
+func decodeEntry(key, value string) (LogEntry, error) {
+	var entry LogEntry
+	if _, err := fmt.Sscanf(key, "%d:%d:%d", &entry.Index, &entry.Term, &entry.Type); err != nil {
+		return entry, fmt.Errorf("invalid entry header %q: %w", key, err)
+	}
+	if value == emptyValue {
+		return entry, nil
+	}
+	data, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return entry, fmt.Errorf("invalid entry data: %w", err)
+	}
+	entry.Data = string(data)
+	return entry, nil
+}
+
+// lastIndex returns the index of the newest entry
+func (l *raftLog) lastIndex() int64 {
+	if len(l.entries) == 0 {
+		return l.snapIndex
+	}
+	return l.entries[len(l.entries)-1].Index
+}
+
+// lastTerm returns the term of the newest entry
+func (l *raftLog) lastTerm() int64 {
+	if len(l.entries) == 0 {
+		return l.snapTerm
+	}
+	return l.entries[len(l.entries)-1].Term
+}
+
+// termAt returns the term of the entry at index, or -1 if unknown
+func (l *raftLog) termAt(index int64) int64 {
+	if index == l.snapIndex {
+		return l.snapTerm
+	}
+	if index < l.snapIndex || index > l.lastIndex() {
+		return -1
+	}
+	return l.entries[index-l.snapIndex-1].Term
+}
+
+// entry returns the entry at index, which must be after the snapshot
+func (l *raftLog) entry(index int64) LogEntry {
+	return l.entries[index-l.snapIndex-1]
+}
+
+// slice returns up to max entries starting at index
+func (l *raftLog) slice(index int64, max int) []LogEntry {
+	if index <= l.snapIndex || index > l.lastIndex() {
+		return nil
+	}
+	start := index - l.snapIndex - 1
+	end := int64(len(l.entries))
+	if end-start > int64(max) {
+		end = start + int64(max)
+	}
+	out := make([]LogEntry, end-start)
+	copy(out, l.entries[start:end])
+	return out
+}
+
+// setTerm persists the current term and vote
+func (l *raftLog) setTerm(term int64, votedFor string) error {
+	vote := votedFor
+	if vote == "" {
+		vote = emptyValue
+	}
+	if err := l.w.Write(&wal.Entry{Op: opTerm, Key: strconv.FormatInt(term, 10), Value: vote}); err != nil {
+		return err
+	}
+	l.term = term
+	l.votedFor = votedFor
+	return nil
+}
+
+// append persists entries at the end of the log
+func (l *raftLog) append(entries ...LogEntry) error {
+	for _, entry := range entries {
+		if err := l.w.Write(encodeEntry(entry)); err != nil {
+			return err
+		}
+		l.entries = append(l.entries, entry)
+	}
+	return nil
+}
+
+// truncate persistently removes all entries from index onwards
+func (l *raftLog) truncate(index int64) error {
+	if err := l.w.Write(&wal.Entry{Op: opTruncate, Key: strconv.FormatInt(index, 10), Value: emptyValue}); err != nil {
+		return err
+	}
+	l.truncateFrom(index)
+	return nil
+}
+
+func (l *raftLog) truncateFrom(index int64) {
+	if index <= l.snapIndex {
+		l.entries = nil
+		return
+	}
+	if pos := index - l.snapIndex - 1; pos < int64(len(l.entries)) {
+		l.entries = l.entries[:pos]
+	}
+}
+
+// saveSnapshot stores a snapshot covering the log up to index and drops
+// the covered entries, rewriting the WAL with what remains
+func (l *raftLog) saveSnapshot(index, term int64, peers map[string]string, data string) error {
+	if err := writeSnapshotFile(l.snapPath, index, term, peers, data); err != nil {
+		return err
+	}
+
+	var rest []LogEntry
+	if index < l.lastIndex() && l.termAt(index) == term {
+		rest = append(rest, l.entries[index-l.snapIndex:]...)
+	}
+
+	// Replace the WAL with the current vote and the remaining entries in
+	// one step, a crash in between must not lose the term or the vote
+	vote := l.votedFor
+	if vote == "" {
+		vote = emptyValue
+	}
+	records := []*wal.Entry{{Op: opTerm, Key: strconv.FormatInt(l.term, 10), Value: vote}}
+	for _, entry := range rest {
+		records = append(records, encodeEntry(entry))
+	}
+	if err := l.w.Rewrite(records); err != nil {
+		return err
+	}
+
+	l.snapIndex = index
+	l.snapTerm = term
+	l.snapPeers = copyPeers(peers)
+	l.snapData = data
+	l.snapTime = time.Now()
+	l.entries = rest
+	return nil
+}
+
+func (l *raftLog) loadSnapshot() error {
+	file, err := os.Open(l.snapPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	if info, err := file.Stat(); err == nil {
+		l.snapTime = info.ModTime()
+	}
+
+	reader := bufio.NewReader(file)
+	header, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot header: %w", err)
+	}
+	if _, err := fmt.Sscanf(header, "%d %d", &l.snapIndex, &l.snapTerm); err != nil {
+		return fmt.Errorf("invalid snapshot header: %w", err)
+	}
+
+	peers, err := reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot peers: %w", err)
+	}
+	l.snapPeers, err = ParsePeers(strings.TrimSpace(peers))
+	if err != nil {
+		return err
+	}
+
+	var data strings.Builder
+	if _, err := reader.WriteTo(&data); err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	l.snapData = data.String()
+	return nil
+}
+
+func writeSnapshotFile(path string, index, term int64, peers map[string]string, data string) error {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to create snapshot: %w", err)
+	}
+
+	fmt.Fprintf(file, "%d %d\n%s\n", index, term, FormatPeers(peers))
+	file.WriteString(data)
+
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync snapshot: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close snapshot: %w", err)
+	}
+	return os.Rename(tmp, path)
+}
+
+// ParsePeers parses a "id=host:port,id=host:port" membership list
+func ParsePeers(s string) (map[string]string, error) {
+	peers := make(map[string]string)
+	if s == "" {
+		return peers, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		id, addr, ok := strings.Cut(strings.TrimSpace(item), "=")
+		if !ok || id == "" || addr == "" {
+			return nil, fmt.Errorf("invalid peer %q, expected id=host:port", item)
+		}
+		peers[id] = addr
+	}
+	return peers, nil
+}
+
+// FormatPeers is the inverse of ParsePeers
+func FormatPeers(peers map[string]string) string {
+	ids := make([]string, 0, len(peers))
+	for id := range peers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	items := make([]string, 0, len(ids))
+	for _, id := range ids {
+		items = append(items, id+"="+peers[id])
+	}
+	return strings.Join(items, ",")
+}
+
+func copyPeers(peers map[string]string) map[string]string {
+	out := make(map[string]string, len(peers))
+	for id, addr := range peers {
+		out[id] = addr
+	}
+	return out
+}
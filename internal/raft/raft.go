@@ -0,0 +1,894 @@
+package raft
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+
+	"memkv/internal/logger"
+	"memkv/internal/wal"
+)
+
+var (
+	ErrTimeout         = errors.New("timed out waiting for commit")
+	ErrLeadershipLost  = errors.New("leadership lost before commit")
+	ErrConfigInFlight  = errors.New("a membership change is already in progress")
+	ErrClosed          = errors.New("raft node is closed")
+	ErrUnknownMember   = errors.New("unknown cluster member")
+	ErrDuplicateMember = errors.New("member already exists")
+)
+
+// NotLeaderError is returned when a write reaches a node that isn't the
+// leader. LeaderAddr is the client address of the current leader, if known.
+type NotLeaderError struct {
+	LeaderAddr string
+}
+
+func (e *NotLeaderError) Error() string {
+	if e.LeaderAddr == "" {
+		return "not the leader, leader unknown"
+	}
+	return "not the leader, leader is " + e.LeaderAddr
+}
+
+// Node roles
+const (
+	Follower  = "follower"
+	Candidate = "candidate"
+	Leader    = "leader"
+)
+
+const (
+	heartbeatInterval  = 50 * time.Millisecond
+	minElectionTimeout = 300 * time.Millisecond
+	maxElectionTimeout = 600 * time.Millisecond
+	maxAppendEntries   = 256
+
+	// DefaultSnapshotThreshold is the number of applied entries after
+	// which the log is compacted into a snapshot
+	DefaultSnapshotThreshold = 10000
+)
+
+// FSM is the replicated state machine driven by committed entries
+type FSM interface {
+	// Apply executes a committed command and returns its reply
+	Apply(cmd string) string
+
+	// Snapshot serializes the current state
+	Snapshot() (string, error)
+
+	// Restore replaces the current state with a snapshot
+	Restore(data string) error
+}
+
+// Config holds the settings of a Raft node
+type Config struct {
+	// ID uniquely identifies the node within the cluster
+	ID string
+
+	// Addr is the address the node listens on for Raft RPCs
+	Addr string
+
+	// ClientAddr is the address clients are redirected to when this
+	// node is the leader
+	ClientAddr string
+
+	// Peers is the initial membership (id -> Raft address), including
+	// this node. It is only used when the log holds no membership yet.
+	Peers map[string]string
+
+	// LogPath is the server's WAL, which holds the Raft log. The state
+	// machine keeps no log of its own: it is rebuilt from the snapshot
+	// and the committed entries, so every write is persisted once.
+	LogPath string
+
+	// SnapshotThreshold overrides DefaultSnapshotThreshold when > 0
+	SnapshotThreshold int64
+
+	// TLSConfig, if set, serves Raft RPCs over TLS, and TLSClientConfig
+	// is then used to dial the other nodes
+	TLSConfig       *tls.Config
+	TLSClientConfig *tls.Config
+}
+
+// Status is a point-in-time view of a node
+type Status struct {
+	ID          string
+	Role        string
+	Term        int64
+	Leader      string
+	LeaderAddr  string
+	CommitIndex int64
+	LastApplied int64
+	LastIndex   int64
+	Members     map[string]string
+
+	SnapshotIndex int64
+	LastSnapshot  time.Time // zero if no snapshot was taken
+
+	// LogSize and LogStats describe the WAL holding the log
+	LogSize  int64
+	LogStats wal.Stats
+}
+
+// applyResult is handed to a waiting proposer once its entry is applied
+type applyResult struct {
+	term  int64
+	reply string
+}
+
+// Node is a single member of a Raft cluster
+type Node struct {
+	cfg       Config
+	fsm       FSM
+	log       *raftLog
+	transport *transport
+	listener  net.Listener
+
+	mu          sync.Mutex
+	applyCond   *sync.Cond
+	role        string
+	leaderID    string
+	leaderAddr  string
+	members     map[string]string
+	commitIndex int64
+	lastApplied int64
+	deadline    time.Time
+	lastBeat    time.Time
+
+	// Leader state
+	nextIndex  map[string]int64
+	matchIndex map[string]int64
+	inflight   map[string]bool
+
+	waiters        map[int64]chan applyResult
+	pendingRestore *InstallSnapshotArgs
+
+	closed bool
+	done   chan struct{}
+}
+
+// NewNode opens the Raft log, restores the latest snapshot into fsm and
+// starts serving RPCs on cfg.Addr
+func NewNode(cfg Config, fsm FSM) (*Node, error) {
+	if cfg.SnapshotThreshold <= 0 {
+		cfg.SnapshotThreshold = DefaultSnapshotThreshold
+	}
+
+	l, err := openLog(cfg.LogPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open raft log: %w", err)
+	}
+
+	// The state machine starts out empty and is rebuilt from the
+	// snapshot, then from log entries as they are known to be committed
+	if l.snapIndex > 0 {
+		if err := fsm.Restore(l.snapData); err != nil {
+			l.w.Close()
+			return nil, fmt.Errorf("failed to restore snapshot: %w", err)
+		}
+	}
+
+	n := &Node{
+		cfg:         cfg,
+		fsm:         fsm,
+		log:         l,
+		transport:   newTransport(cfg.TLSClientConfig),
+		role:        Follower,
+		commitIndex: l.snapIndex,
+		lastApplied: l.snapIndex,
+		nextIndex:   make(map[string]int64),
+		matchIndex:  make(map[string]int64),
+		inflight:    make(map[string]bool),
+		waiters:     make(map[int64]chan applyResult),
+		done:        make(chan struct{}),
+	}
+	n.applyCond = sync.NewCond(&n.mu)
+	n.members = n.latestMembers()
+	n.resetDeadline()
+
+	server := rpc.NewServer()
+	if err := server.Register(&Service{n: n}); err != nil {
+		l.w.Close()
+		return nil, err
+	}
+
+	n.listener, err = net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		l.w.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", cfg.Addr, err)
+	}
+	if cfg.TLSConfig != nil {
+		n.listener = tls.NewListener(n.listener, cfg.TLSConfig)
+	}
+	go n.serve(server)
+
+	go n.run()
+	go n.applier()
+
+	logger.Info("Raft node %s listening on %s (term %d, %d log entries)",
+		cfg.ID, cfg.Addr, l.term, l.lastIndex()-l.snapIndex)
+	return n, nil
+}
+
+// serve accepts Raft RPC connections until the listener is closed
+func (n *Node) serve(server *rpc.Server) {
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			return
+		}
+		go server.ServeConn(conn)
+	}
+}
+
+// Close stops the node
+func (n *Node) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	close(n.done)
+	n.applyCond.Broadcast()
+	n.mu.Unlock()
+
+	n.listener.Close()
+	n.transport.close()
+	return n.log.w.Close()
+}
+
+// Status returns the node's current state
+func (n *Node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	size, _ := n.log.w.Size()
+	return Status{
+		ID:          n.cfg.ID,
+		Role:        n.role,
+		Term:        n.log.term,
+		Leader:      n.leaderID,
+		LeaderAddr:  n.leaderAddr,
+		CommitIndex: n.commitIndex,
+		LastApplied: n.lastApplied,
+		LastIndex:   n.log.lastIndex(),
+		Members:     copyPeers(n.members),
+
+		SnapshotIndex: n.log.snapIndex,
+		LastSnapshot:  n.log.snapTime,
+
+		LogSize:  size,
+		LogStats: n.log.w.Stats(),
+	}
+}
+
+// Propose replicates cmd and returns the FSM's reply once the entry is
+// committed and applied
+func (n *Node) Propose(cmd string, timeout time.Duration) (string, error) {
+	return n.propose(EntryCommand, cmd, timeout)
+}
+
+// AddMember adds a node to the cluster
+func (n *Node) AddMember(id, addr string, timeout time.Duration) error {
+	return n.changeMembers(timeout, func(members map[string]string) error {
+		if _, ok := members[id]; ok {
+			return ErrDuplicateMember
+		}
+		members[id] = addr
+		return nil
+	})
+}
+
+// RemoveMember removes a node from the cluster
+func (n *Node) RemoveMember(id string, timeout time.Duration) error {
+	return n.changeMembers(timeout, func(members map[string]string) error {
+		if _, ok := members[id]; !ok {
+			return ErrUnknownMember
+		}
+		delete(members, id)
+		return nil
+	})
+}
+
+// changeMembers proposes a single-server membership change. The new
+// configuration takes effect as soon as it is appended to the log.
+func (n *Node) changeMembers(timeout time.Duration, change func(map[string]string) error) error {
+	n.mu.Lock()
+	if n.role != Leader {
+		n.mu.Unlock()
+		return &NotLeaderError{LeaderAddr: n.leaderAddr}
+	}
+	for i := n.commitIndex + 1; i <= n.log.lastIndex(); i++ {
+		if n.log.entry(i).Type == EntryConfig {
+			n.mu.Unlock()
+			return ErrConfigInFlight
+		}
+	}
+
+	members := copyPeers(n.members)
+	if err := change(members); err != nil {
+		n.mu.Unlock()
+		return err
+	}
+	n.mu.Unlock()
+
+	_, err := n.propose(EntryConfig, FormatPeers(members), timeout)
+	return err
+}
+
+func (n *Node) propose(typ EntryType, data string, timeout time.Duration) (string, error) {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return "", ErrClosed
+	}
+	if n.role != Leader {
+		n.mu.Unlock()
+		return "", &NotLeaderError{LeaderAddr: n.leaderAddr}
+	}
+
+	entry := LogEntry{
+		Index: n.log.lastIndex() + 1,
+		Term:  n.log.term,
+		Type:  typ,
+		Data:  data,
+	}
+	if err := n.log.append(entry); err != nil {
+		n.mu.Unlock()
+		return "", fmt.Errorf("failed to append to raft log: %w", err)
+	}
+	if typ == EntryConfig {
+		n.setMembers(n.latestMembers())
+	}
+
+	ch := make(chan applyResult, 1)
+	n.waiters[entry.Index] = ch
+	n.matchIndex[n.cfg.ID] = entry.Index
+	n.advanceCommit()
+	n.broadcast()
+	n.mu.Unlock()
+
+	select {
+	case res := <-ch:
+		if res.term != entry.Term {
+			return "", ErrLeadershipLost
+		}
+		return res.reply, nil
+	case <-time.After(timeout):
+		n.mu.Lock()
+		delete(n.waiters, entry.Index)
+		n.mu.Unlock()
+		return "", ErrTimeout
+	case <-n.done:
+		return "", ErrClosed
+	}
+}
+
+// run drives elections and heartbeats
+func (n *Node) run() {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.done:
+			return
+		case <-ticker.C:
+		}
+
+		n.mu.Lock()
+		switch n.role {
+		case Leader:
+			if time.Since(n.lastBeat) >= heartbeatInterval {
+				n.broadcast()
+			}
+		default:
+			if _, member := n.members[n.cfg.ID]; member && time.Now().After(n.deadline) {
+				n.startElection()
+			}
+		}
+		n.mu.Unlock()
+	}
+}
+
+func (n *Node) resetDeadline() {
+	spread := int64(maxElectionTimeout - minElectionTimeout)
+	n.deadline = time.Now().Add(minElectionTimeout + time.Duration(rand.Int63n(spread)))
+}
+
+// startElection becomes a candidate and requests votes. Caller holds n.mu.
+func (n *Node) startElection() {
+	term := n.log.term + 1
+	if err := n.log.setTerm(term, n.cfg.ID); err != nil {
+		logger.Error("Raft: failed to persist term: %v", err)
+		return
+	}
+	n.role = Candidate
+	n.leaderID = ""
+	n.leaderAddr = ""
+	n.resetDeadline()
+	logger.Info("Raft: %s starting election for term %d", n.cfg.ID, term)
+
+	votes := 1
+	if votes > len(n.members)/2 {
+		n.becomeLeader()
+		return
+	}
+
+	args := &RequestVoteArgs{
+		Term:         term,
+		CandidateID:  n.cfg.ID,
+		LastLogIndex: n.log.lastIndex(),
+		LastLogTerm:  n.log.lastTerm(),
+	}
+
+	for id, addr := range n.members {
+		if id == n.cfg.ID {
+			continue
+		}
+		go func(addr string) {
+			var reply RequestVoteReply
+			if err := n.transport.call(addr, "RequestVote", args, &reply); err != nil {
+				return
+			}
+
+			n.mu.Lock()
+			defer n.mu.Unlock()
+
+			if reply.Term > n.log.term {
+				n.stepDown(reply.Term)
+				return
+			}
+			if n.role != Candidate || n.log.term != term || !reply.VoteGranted {
+				return
+			}
+			votes++
+			if votes > len(n.members)/2 {
+				n.becomeLeader()
+			}
+		}(addr)
+	}
+}
+
+// becomeLeader takes over leadership. Caller holds n.mu.
+func (n *Node) becomeLeader() {
+	n.role = Leader
+	n.leaderID = n.cfg.ID
+	n.leaderAddr = n.cfg.ClientAddr
+	logger.Info("Raft: %s became leader for term %d", n.cfg.ID, n.log.term)
+
+	for id := range n.members {
+		n.nextIndex[id] = n.log.lastIndex() + 1
+		n.matchIndex[id] = 0
+	}
+
+	// A no-op from the new term lets earlier entries commit
+	entry := LogEntry{Index: n.log.lastIndex() + 1, Term: n.log.term, Type: EntryNoop}
+	if err := n.log.append(entry); err != nil {
+		logger.Error("Raft: failed to append no-op: %v", err)
+	}
+	n.matchIndex[n.cfg.ID] = n.log.lastIndex()
+	n.advanceCommit()
+	n.broadcast()
+}
+
+// stepDown reverts to follower for term. Caller holds n.mu.
+func (n *Node) stepDown(term int64) {
+	if term > n.log.term {
+		if err := n.log.setTerm(term, ""); err != nil {
+			logger.Error("Raft: failed to persist term: %v", err)
+		}
+		n.leaderID = ""
+		n.leaderAddr = ""
+	}
+	if n.role != Follower {
+		logger.Info("Raft: %s stepping down in term %d", n.cfg.ID, n.log.term)
+	}
+	n.role = Follower
+	n.resetDeadline()
+}
+
+// broadcast sends AppendEntries (or snapshots) to all peers. Caller holds n.mu.
+func (n *Node) broadcast() {
+	n.lastBeat = time.Now()
+	for id := range n.members {
+		if id != n.cfg.ID && !n.inflight[id] {
+			n.inflight[id] = true
+			go n.replicate(id)
+		}
+	}
+}
+
+// replicate brings a single peer up to date
+func (n *Node) replicate(id string) {
+	n.mu.Lock()
+	defer func() {
+		n.inflight[id] = false
+		n.mu.Unlock()
+	}()
+
+	addr, ok := n.members[id]
+	if n.role != Leader || !ok {
+		return
+	}
+	term := n.log.term
+
+	next := n.nextIndex[id]
+	if next < 1 {
+		next = 1
+	}
+
+	// The entries the peer needs were compacted away
+	if next <= n.log.snapIndex {
+		args := &InstallSnapshotArgs{
+			Term:             term,
+			LeaderID:         n.cfg.ID,
+			LeaderClientAddr: n.cfg.ClientAddr,
+			LastIndex:        n.log.snapIndex,
+			LastTerm:         n.log.snapTerm,
+			Peers:            copyPeers(n.log.snapPeers),
+			Data:             n.log.snapData,
+		}
+		n.mu.Unlock()
+		var reply InstallSnapshotReply
+		err := n.transport.call(addr, "InstallSnapshot", args, &reply)
+		n.mu.Lock()
+
+		if err != nil {
+			return
+		}
+		if reply.Term > n.log.term {
+			n.stepDown(reply.Term)
+			return
+		}
+		if n.role == Leader && n.log.term == term {
+			n.matchIndex[id] = args.LastIndex
+			n.nextIndex[id] = args.LastIndex + 1
+		}
+		return
+	}
+
+	args := &AppendEntriesArgs{
+		Term:             term,
+		LeaderID:         n.cfg.ID,
+		LeaderClientAddr: n.cfg.ClientAddr,
+		PrevLogIndex:     next - 1,
+		PrevLogTerm:      n.log.termAt(next - 1),
+		Entries:          n.log.slice(next, maxAppendEntries),
+		LeaderCommit:     n.commitIndex,
+	}
+	n.mu.Unlock()
+	var reply AppendEntriesReply
+	err := n.transport.call(addr, "AppendEntries", args, &reply)
+	n.mu.Lock()
+
+	if err != nil {
+		return
+	}
+	if reply.Term > n.log.term {
+		n.stepDown(reply.Term)
+		return
+	}
+	if n.role != Leader || n.log.term != term {
+		return
+	}
+
+	if reply.Success {
+		match := args.PrevLogIndex + int64(len(args.Entries))
+		if match > n.matchIndex[id] {
+			n.matchIndex[id] = match
+		}
+		n.nextIndex[id] = match + 1
+		n.advanceCommit()
+		return
+	}
+
+	// Back off towards the follower's log end
+	next--
+	if reply.LastIndex+1 < next {
+		next = reply.LastIndex + 1
+	}
+	if next < 1 {
+		next = 1
+	}
+	n.nextIndex[id] = next
+}
+
+// advanceCommit commits the highest index stored on a majority, as long
+// as it belongs to the current term. Caller holds n.mu.
+func (n *Node) advanceCommit() {
+	for index := n.log.lastIndex(); index > n.commitIndex; index-- {
+		if n.log.termAt(index) != n.log.term {
+			break
+		}
+
+		count := 0
+		for id := range n.members {
+			if id == n.cfg.ID || n.matchIndex[id] >= index {
+				count++
+			}
+		}
+		if count > len(n.members)/2 {
+			n.commitIndex = index
+			n.applyCond.Broadcast()
+			break
+		}
+	}
+}
+
+// latestMembers returns the newest configuration in the log or snapshot.
+// Caller holds n.mu.
+func (n *Node) latestMembers() map[string]string {
+	for i := len(n.log.entries) - 1; i >= 0; i-- {
+		if n.log.entries[i].Type == EntryConfig {
+			if peers, err := ParsePeers(n.log.entries[i].Data); err == nil {
+				return peers
+			}
+		}
+	}
+	if n.log.snapPeers != nil {
+		return copyPeers(n.log.snapPeers)
+	}
+	return copyPeers(n.cfg.Peers)
+}
+
+// setMembers switches to a new configuration. Caller holds n.mu.
+func (n *Node) setMembers(members map[string]string) {
+	n.members = members
+	for id := range members {
+		if _, ok := n.nextIndex[id]; !ok {
+			n.nextIndex[id] = n.log.lastIndex() + 1
+			n.matchIndex[id] = 0
+		}
+	}
+	logger.Info("Raft: membership is now %s", FormatPeers(members))
+}
+
+func (n *Node) handleRequestVote(args *RequestVoteArgs, reply *RequestVoteReply) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if args.Term > n.log.term {
+		n.stepDown(args.Term)
+	}
+	reply.Term = n.log.term
+
+	if args.Term < n.log.term {
+		return
+	}
+
+	upToDate := args.LastLogTerm > n.log.lastTerm() ||
+		(args.LastLogTerm == n.log.lastTerm() && args.LastLogIndex >= n.log.lastIndex())
+
+	if (n.log.votedFor == "" || n.log.votedFor == args.CandidateID) && upToDate {
+		if err := n.log.setTerm(n.log.term, args.CandidateID); err != nil {
+			logger.Error("Raft: failed to persist vote: %v", err)
+			return
+		}
+		reply.VoteGranted = true
+		n.resetDeadline()
+	}
+}
+
+func (n *Node) handleAppendEntries(args *AppendEntriesArgs, reply *AppendEntriesReply) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	reply.Term = n.log.term
+	if args.Term < n.log.term {
+		return
+	}
+	if args.Term > n.log.term || n.role != Follower {
+		n.stepDown(args.Term)
+		reply.Term = n.log.term
+	}
+	n.leaderID = args.LeaderID
+	n.leaderAddr = args.LeaderClientAddr
+	n.resetDeadline()
+
+	reply.LastIndex = n.log.lastIndex()
+	if args.PrevLogIndex > n.log.lastIndex() {
+		return
+	}
+	if args.PrevLogIndex >= n.log.snapIndex && n.log.termAt(args.PrevLogIndex) != args.PrevLogTerm {
+		reply.LastIndex = args.PrevLogIndex - 1
+		return
+	}
+
+	membersChanged := false
+	for _, entry := range args.Entries {
+		if entry.Index <= n.log.snapIndex {
+			continue
+		}
+		if entry.Index <= n.log.lastIndex() {
+			if n.log.termAt(entry.Index) == entry.Term {
+				continue
+			}
+			if n.log.entry(entry.Index).Type == EntryConfig {
+				membersChanged = true
+			}
+			if err := n.log.truncate(entry.Index); err != nil {
+				logger.Error("Raft: failed to truncate log: %v", err)
+				return
+			}
+		}
+		if err := n.log.append(entry); err != nil {
+			logger.Error("Raft: failed to append entries: %v", err)
+			return
+		}
+		if entry.Type == EntryConfig {
+			membersChanged = true
+		}
+	}
+	if membersChanged {
+		n.setMembers(n.latestMembers())
+	}
+
+	lastNew := args.PrevLogIndex + int64(len(args.Entries))
+	if args.LeaderCommit > n.commitIndex {
+		n.commitIndex = args.LeaderCommit
+		if lastNew < n.commitIndex {
+			n.commitIndex = lastNew
+		}
+		n.applyCond.Broadcast()
+	}
+
+	reply.Success = true
+	reply.LastIndex = n.log.lastIndex()
+}
+
+func (n *Node) handleInstallSnapshot(args *InstallSnapshotArgs, reply *InstallSnapshotReply) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	reply.Term = n.log.term
+	if args.Term < n.log.term {
+		return
+	}
+	if args.Term > n.log.term || n.role != Follower {
+		n.stepDown(args.Term)
+		reply.Term = n.log.term
+	}
+	n.leaderID = args.LeaderID
+	n.leaderAddr = args.LeaderClientAddr
+	n.resetDeadline()
+
+	if args.LastIndex <= n.log.snapIndex || args.LastIndex <= n.lastApplied {
+		return
+	}
+
+	if err := n.log.saveSnapshot(args.LastIndex, args.LastTerm, args.Peers, args.Data); err != nil {
+		logger.Error("Raft: failed to save snapshot: %v", err)
+		return
+	}
+	n.setMembers(n.latestMembers())
+	if n.commitIndex < args.LastIndex {
+		n.commitIndex = args.LastIndex
+	}
+
+	// The applier restores the FSM outside n.mu
+	n.pendingRestore = args
+	n.applyCond.Broadcast()
+	logger.Info("Raft: installed snapshot at index %d from %s", args.LastIndex, args.LeaderID)
+}
+
+// applier feeds committed entries to the FSM in order
+func (n *Node) applier() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for {
+		for !n.closed && n.pendingRestore == nil && n.lastApplied >= n.commitIndex {
+			n.applyCond.Wait()
+		}
+		if n.closed {
+			return
+		}
+
+		if snap := n.pendingRestore; snap != nil {
+			n.pendingRestore = nil
+			n.mu.Unlock()
+			err := n.fsm.Restore(snap.Data)
+			n.mu.Lock()
+			if err != nil {
+				logger.Error("Raft: failed to restore snapshot: %v", err)
+				continue
+			}
+			n.lastApplied = snap.LastIndex
+			continue
+		}
+
+		entries := n.log.slice(n.lastApplied+1, maxAppendEntries)
+		if max := n.commitIndex - n.lastApplied; int64(len(entries)) > max {
+			entries = entries[:max]
+		}
+		if len(entries) == 0 {
+			// Committed entries are only in a snapshot we haven't restored
+			n.applyCond.Wait()
+			continue
+		}
+		n.mu.Unlock()
+
+		for _, entry := range entries {
+			reply := "OK"
+			if entry.Type == EntryCommand {
+				reply = n.fsm.Apply(entry.Data)
+			}
+
+			n.mu.Lock()
+			n.lastApplied = entry.Index
+			if ch, ok := n.waiters[entry.Index]; ok {
+				ch <- applyResult{term: entry.Term, reply: reply}
+				delete(n.waiters, entry.Index)
+			}
+			if entry.Type == EntryConfig {
+				n.configCommitted()
+			}
+			n.mu.Unlock()
+		}
+
+		n.mu.Lock()
+		if n.lastApplied-n.log.snapIndex >= n.cfg.SnapshotThreshold {
+			n.compact()
+		}
+	}
+}
+
+// configCommitted steps down a leader that removed itself from the
+// cluster once the change is committed. Caller holds n.mu.
+func (n *Node) configCommitted() {
+	if _, member := n.members[n.cfg.ID]; !member && n.role == Leader {
+		logger.Info("Raft: %s removed from the cluster, stepping down", n.cfg.ID)
+		n.role = Follower
+		n.leaderID = ""
+		n.leaderAddr = ""
+	}
+}
+
+// compact snapshots the FSM at lastApplied and trims the log. Caller
+// holds n.mu; it is released while the FSM is serialized.
+func (n *Node) compact() {
+	index := n.lastApplied
+	term := n.log.termAt(index)
+	members := n.membersAt(index)
+
+	// Only the applier advances lastApplied, so the FSM stays at index
+	n.mu.Unlock()
+	data, err := n.fsm.Snapshot()
+	n.mu.Lock()
+	if err != nil {
+		logger.Error("Raft: snapshot failed: %v", err)
+		return
+	}
+	if index <= n.log.snapIndex {
+		return
+	}
+
+	if err := n.log.saveSnapshot(index, term, members, data); err != nil {
+		logger.Error("Raft: failed to save snapshot: %v", err)
+		return
+	}
+	logger.Info("Raft: compacted log up to index %d", index)
+}
+
+// membersAt returns the configuration in effect at index. Caller holds n.mu.
+func (n *Node) membersAt(index int64) map[string]string {
+	for i := index; i > n.log.snapIndex; i-- {
+		if entry := n.log.entry(i); entry.Type == EntryConfig {
+			if peers, err := ParsePeers(entry.Data); err == nil {
+				return peers
+			}
+		}
+	}
+	if n.log.snapPeers != nil {
+		return copyPeers(n.log.snapPeers)
+	}
+	return copyPeers(n.cfg.Peers)
+}
@@ -0,0 +1,372 @@
+package raft
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// kvFSM is a state machine of "SET key value" commands
+type kvFSM struct {
+	mu   sync.Mutex
+	data map[string]string
+}
+
+func newKVFSM() *kvFSM {
+	return &kvFSM{data: make(map[string]string)}
+}
+
+func (f *kvFSM) Apply(cmd string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.Fields(cmd)
+	if len(parts) != 3 || parts[0] != "SET" {
+		return "ERR unknown command"
+	}
+	f.data[parts[1]] = parts[2]
+	return "OK"
+}
+
+func (f *kvFSM) Snapshot() (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	keys := make([]string, 0, len(f.data))
+	for key := range f.data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s %s\n", key, f.data[key])
+	}
+	return b.String(), nil
+}
+
+func (f *kvFSM) Restore(data string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.data = make(map[string]string)
+	for _, line := range strings.Split(data, "\n") {
+		if key, value, ok := strings.Cut(line, " "); ok {
+			f.data[key] = value
+		}
+	}
+	return nil
+}
+
+func (f *kvFSM) get(key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.data[key]
+}
+
+// testCluster runs Raft nodes on local ports, each with its own log.
+// Nodes listen on addrs and start with peers as their membership.
+type testCluster struct {
+	t         *testing.T
+	dir       string
+	addrs     map[string]string
+	peers     map[string]string
+	threshold int64
+	tls       *tls.Config // serves and dials RPCs over TLS if set
+	nodes     map[string]*Node
+	fsms      map[string]*kvFSM
+}
+
+func newTestCluster(t *testing.T, ids ...string) *testCluster {
+	c := &testCluster{
+		t:     t,
+		dir:   t.TempDir(),
+		addrs: make(map[string]string),
+		peers: make(map[string]string),
+		nodes: make(map[string]*Node),
+		fsms:  make(map[string]*kvFSM),
+	}
+	for _, id := range ids {
+		c.addrs[id] = freeAddr(t)
+		c.peers[id] = c.addrs[id]
+	}
+	t.Cleanup(func() {
+		for _, n := range c.nodes {
+			n.Close()
+		}
+	})
+	return c
+}
+
+// freeAddr returns a local address nothing listens on
+func freeAddr(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().String()
+}
+
+// start runs the node id from its log, which survives restarts
+func (c *testCluster) start(id string) {
+	c.t.Helper()
+
+	fsm := newKVFSM()
+	n, err := NewNode(Config{
+		ID:                id,
+		Addr:              c.addrs[id],
+		ClientAddr:        "client-" + id,
+		Peers:             c.peers,
+		LogPath:           filepath.Join(c.dir, id+".wal"),
+		SnapshotThreshold: c.threshold,
+		TLSConfig:         c.tls,
+		TLSClientConfig:   c.tls,
+	}, fsm)
+	if err != nil {
+		c.t.Fatalf("starting %s: %v", id, err)
+	}
+	c.nodes[id] = n
+	c.fsms[id] = fsm
+}
+
+func (c *testCluster) stop(id string) {
+	c.nodes[id].Close()
+	delete(c.nodes, id)
+}
+
+// leader waits for one of the running nodes to lead
+func (c *testCluster) leader() *Node {
+	c.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		for _, n := range c.nodes {
+			if n.Status().Role == Leader {
+				return n
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.t.Fatal("no leader elected")
+	return nil
+}
+
+// set proposes a write on the leader
+func (c *testCluster) set(key, value string) {
+	c.t.Helper()
+
+	reply, err := c.leader().Propose("SET "+key+" "+value, 5*time.Second)
+	if err != nil || reply != "OK" {
+		c.t.Fatalf("SET %s: reply %q, err %v", key, reply, err)
+	}
+}
+
+// waitFor waits until the running node id has applied key=value
+func (c *testCluster) waitFor(id, key, value string) {
+	c.t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if c.fsms[id].get(key) == value {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.t.Fatalf("%s: %s = %q, want %q", id, key, c.fsms[id].get(key), value)
+}
+
+func TestReplicationAndFailover(t *testing.T) {
+	c := newTestCluster(t, "n1", "n2", "n3")
+	for id := range c.peers {
+		c.start(id)
+	}
+
+	c.set("a", "1")
+	for id := range c.nodes {
+		c.waitFor(id, "a", "1")
+	}
+
+	// Followers redirect writes to the leader's client address
+	leader := c.leader()
+	for id, n := range c.nodes {
+		if n == leader {
+			continue
+		}
+		_, err := n.Propose("SET x y", time.Second)
+		var notLeader *NotLeaderError
+		if !errors.As(err, &notLeader) || notLeader.LeaderAddr != leader.cfg.ClientAddr {
+			t.Fatalf("%s: write on follower returned %v, want a redirect to %s", id, err, leader.cfg.ClientAddr)
+		}
+	}
+
+	// The remaining majority elects a new leader and keeps committing
+	old := leader.cfg.ID
+	c.stop(old)
+	c.set("b", "2")
+	for id := range c.nodes {
+		c.waitFor(id, "b", "2")
+	}
+
+	// The old leader rebuilds its state from its log and catches up
+	c.start(old)
+	c.waitFor(old, "a", "1")
+	c.waitFor(old, "b", "2")
+}
+
+func TestSnapshotInstall(t *testing.T) {
+	c := newTestCluster(t, "n1", "n2", "n3")
+	c.threshold = 5
+	c.start("n1")
+	c.start("n2")
+
+	// n3 misses enough writes for them to be compacted away
+	for i := 0; i < 20; i++ {
+		c.set(fmt.Sprintf("k%d", i), fmt.Sprint(i))
+	}
+	if st := c.leader().Status(); st.SnapshotIndex == 0 {
+		t.Fatalf("leader did not compact its log: %+v", st)
+	}
+
+	c.start("n3")
+	c.waitFor("n3", "k0", "0")
+	c.waitFor("n3", "k19", "19")
+}
+
+func TestMembershipChange(t *testing.T) {
+	c := newTestCluster(t, "n1", "n2", "n3")
+	for id := range c.peers {
+		c.start(id)
+	}
+	c.set("a", "1")
+
+	// n4 starts without members, so it waits to be added instead of
+	// electing itself, and learns the data once it is
+	peers := c.peers
+	c.addrs["n4"] = freeAddr(t)
+	c.peers = map[string]string{}
+	c.start("n4")
+	c.peers = peers
+
+	if err := c.leader().AddMember("n4", c.addrs["n4"], 5*time.Second); err != nil {
+		t.Fatalf("adding n4: %v", err)
+	}
+	c.waitFor("n4", "a", "1")
+	if members := c.leader().Status().Members; len(members) != 4 {
+		t.Fatalf("members after adding n4: %v", members)
+	}
+
+	if err := c.leader().RemoveMember("n4", 5*time.Second); err != nil {
+		t.Fatalf("removing n4: %v", err)
+	}
+	if members := c.leader().Status().Members; len(members) != 3 {
+		t.Fatalf("members after removing n4: %v", members)
+	}
+}
+
+func TestSnapshotKeepsVoteAndEntries(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "raft.wal")
+	l, err := openLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.setTerm(3, "n2"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 5; i++ {
+		if err := l.append(LogEntry{Index: i, Term: 3, Data: fmt.Sprintf("SET k%d v", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := l.saveSnapshot(3, 3, map[string]string{"n1": "a"}, "k1 v\n"); err != nil {
+		t.Fatal(err)
+	}
+	l.w.Close()
+
+	// The rewritten WAL alone must bring back the vote and the entries
+	// the snapshot doesn't cover
+	l, err = openLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.w.Close()
+	if l.term != 3 || l.votedFor != "n2" {
+		t.Fatalf("term %d, vote %q after reopening, want 3 and n2", l.term, l.votedFor)
+	}
+	if l.snapIndex != 3 || l.lastIndex() != 5 || l.entry(4).Data != "SET k4 v" {
+		t.Fatalf("snapshot index %d, last index %d after reopening, want 3 and 5", l.snapIndex, l.lastIndex())
+	}
+}
+
+// selfSignedTLS returns a config that presents and trusts a
+// certificate for 127.0.0.1
+func selfSignedTLS(t *testing.T) *tls.Config {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &tls.Config{
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		RootCAs:      pool,
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+}
+
+func TestTLS(t *testing.T) {
+	c := newTestCluster(t, "n1", "n2", "n3")
+	c.tls = selfSignedTLS(t)
+	for _, id := range []string{"n1", "n2", "n3"} {
+		c.start(id)
+	}
+
+	c.set("a", "1")
+	for _, id := range []string{"n1", "n2", "n3"} {
+		c.waitFor(id, "a", "1")
+	}
+
+	// A plaintext peer can't talk to the cluster
+	plain := newTransport(nil)
+	defer plain.close()
+	var reply RequestVoteReply
+	if err := plain.call(c.addrs["n1"], "RequestVote", &RequestVoteArgs{CandidateID: "x"}, &reply); err == nil {
+		t.Fatal("plaintext RequestVote succeeded against a TLS node")
+	}
+}
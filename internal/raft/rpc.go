@@ -0,0 +1,159 @@
+package raft
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+// RequestVoteArgs is sent by candidates to gather votes
+type RequestVoteArgs struct {
+	Term         int64
+	CandidateID  string
+	LastLogIndex int64
+	LastLogTerm  int64
+}
+
+// RequestVoteReply is the response to RequestVote
+type RequestVoteReply struct {
+	Term        int64
+	VoteGranted bool
+}
+
+// AppendEntriesArgs replicates log entries and doubles as heartbeat
+type AppendEntriesArgs struct {
+	Term             int64
+	LeaderID         string
+	LeaderClientAddr string
+	PrevLogIndex     int64
+	PrevLogTerm      int64
+	Entries          []LogEntry
+	LeaderCommit     int64
+}
+
+// AppendEntriesReply is the response to AppendEntries. On failure
+// LastIndex hints where the leader should retry from.
+type AppendEntriesReply struct {
+	Term      int64
+	Success   bool
+	LastIndex int64
+}
+
+// InstallSnapshotArgs transfers a snapshot to a lagging follower
+type InstallSnapshotArgs struct {
+	Term             int64
+	LeaderID         string
+	LeaderClientAddr string
+	LastIndex        int64
+	LastTerm         int64
+	Peers            map[string]string
+	Data             string
+}
+
+// InstallSnapshotReply is the response to InstallSnapshot
+type InstallSnapshotReply struct {
+	Term int64
+}
+
+// rpcTimeout bounds every peer RPC so a dead peer can't stall replication
+const rpcTimeout = 500 * time.Millisecond
+
+// Service exposes a node's RPC handlers through net/rpc
+type Service struct {
+	n *Node
+}
+
+func (s *Service) RequestVote(args *RequestVoteArgs, reply *RequestVoteReply) error {
+	s.n.handleRequestVote(args, reply)
+	return nil
+}
+
+func (s *Service) AppendEntries(args *AppendEntriesArgs, reply *AppendEntriesReply) error {
+	s.n.handleAppendEntries(args, reply)
+	return nil
+}
+
+func (s *Service) InstallSnapshot(args *InstallSnapshotArgs, reply *InstallSnapshotReply) error {
+	s.n.handleInstallSnapshot(args, reply)
+	return nil
+}
+
+// transport manages RPC connections to peers
+type transport struct {
+	mu      sync.Mutex
+	clients map[string]*rpc.Client
+
+	// tlsConfig, if set, secures connections to peers
+	tlsConfig *tls.Config
+}
+
+func newTransport(tlsConfig *tls.Config) *transport {
+	return &transport{clients: make(map[string]*rpc.Client), tlsConfig: tlsConfig}
+}
+
+// call invokes method on the peer at addr with a timeout
+func (t *transport) call(addr, method string, args, reply interface{}) error {
+	client, err := t.client(addr)
+	if err != nil {
+		return err
+	}
+
+	call := client.Go("Service."+method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if call.Error != nil {
+			t.drop(addr, client)
+		}
+		return call.Error
+	case <-time.After(rpcTimeout):
+		t.drop(addr, client)
+		return fmt.Errorf("rpc %s to %s timed out", method, addr)
+	}
+}
+
+func (t *transport) client(addr string) (*rpc.Client, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if c, ok := t.clients[addr]; ok {
+		return c, nil
+	}
+
+	var conn net.Conn
+	var err error
+	dialer := &net.Dialer{Timeout: rpcTimeout}
+	if t.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, t.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	c := rpc.NewClient(conn)
+	t.clients[addr] = c
+	return c, nil
+}
+
+func (t *transport) drop(addr string, c *rpc.Client) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.clients[addr] == c {
+		delete(t.clients, addr)
+	}
+	c.Close()
+}
+
+func (t *transport) close() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for addr, c := range t.clients {
+		c.Close()
+		delete(t.clients, addr)
+	}
+}
@@ -0,0 +1,68 @@
+package replication
+
+import "sync"
+
+// DefaultBacklogSize is the default capacity of the replication backlog
+const DefaultBacklogSize = 1 << 20
+
+// Backlog is a fixed-size ring buffer holding the most recent bytes of
+// the replication stream so reconnecting replicas can resume from their
+// last offset instead of requiring a full sync
+type Backlog struct {
+	mu    sync.Mutex
+	buf   []byte
+	start int64 // replication offset of the oldest byte held
+	end   int64 // replication offset just past the newest byte held
+}
+
+// NewBacklog creates a backlog holding up to size bytes, starting at offset
+func NewBacklog(size int, offset int64) *Backlog {
+	if size <= 0 {
+		size = DefaultBacklogSize
+	}
+	return &Backlog{
+		buf:   make([]byte, size),
+		start: offset,
+		end:   offset,
+	}
+}
+
+// Append adds data to the backlog, discarding the oldest bytes if full
+func (b *Backlog) Append(data []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	size := int64(len(b.buf))
+	for _, c := range data {
+		b.buf[b.end%size] = c
+		b.end++
+	}
+	if b.end-b.start > size {
+		b.start = b.end - size
+	}
+}
+
+// ReadFrom returns all bytes from offset to the end of the stream. ok is
+// false when offset is no longer (or not yet) covered by the backlog.
+func (b *Backlog) ReadFrom(offset int64) (data []byte, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if offset < b.start || offset > b.end {
+		return nil, false
+	}
+
+	size := int64(len(b.buf))
+	data = make([]byte, 0, b.end-offset)
+	for i := offset; i < b.end; i++ {
+		data = append(data, b.buf[i%size])
+	}
+	return data, true
+}
+
+// Offset returns the replication offset just past the newest byte
+func (b *Backlog) Offset() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.end
+}
@@ -0,0 +1,328 @@
+package replication
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"memkv/internal/logger"
+	"memkv/internal/protocol"
+)
+
+// Link states reported by Follower.State
+const (
+	StateConnecting = "connecting"
+	StateSync       = "sync"
+	StateConnected  = "connected"
+)
+
+const (
+	minReconnectDelay = 100 * time.Millisecond
+	maxReconnectDelay = 5 * time.Second
+
+	// PingInterval is how often a leader pings idle replicas, so that
+	// they can tell it apart from a dead one, which they give up on once
+	// Timeout passes without receiving anything
+	PingInterval = 10 * time.Second
+	Timeout      = 60 * time.Second
+)
+
+// Handler applies the replication stream received from the leader
+type Handler interface {
+	// Reset discards the local dataset before a full sync
+	Reset() error
+
+	// Apply executes a single command from the stream
+	Apply(args []string) error
+}
+
+// Follower keeps a local dataset in sync with a leader. It performs a
+// full sync on first contact and afterwards resumes with a partial sync
+// from the leader's backlog whenever the link drops.
+type Follower struct {
+	addr    string
+	handler Handler
+
+	// user and password authenticate with the leader before PSYNC. No
+	// AUTH is sent if password is empty.
+	user     string
+	password string
+
+	// tlsConfig, if set, secures the link to the leader's TLS port
+	tlsConfig *tls.Config
+
+	mu     sync.Mutex
+	replID string
+	offset int64
+	state  string
+	conn   net.Conn
+	closed bool
+	done   chan struct{}
+}
+
+// NewFollower creates a follower of the leader at host:port
+func NewFollower(host string, port int, handler Handler) *Follower {
+	return &Follower{
+		addr:    net.JoinHostPort(host, strconv.Itoa(port)),
+		handler: handler,
+		replID:  "?",
+		offset:  -1,
+		state:   StateConnecting,
+		done:    make(chan struct{}),
+	}
+}
+
+// SetAuth makes the follower authenticate as user (the default user if
+// empty) with password before syncing. It must be called before Start.
+func (f *Follower) SetAuth(user, password string) {
+	f.user = user
+	f.password = password
+}
+
+// SetTLS makes the follower connect to the leader over TLS with cfg.
+// It must be called before Start.
+func (f *Follower) SetTLS(cfg *tls.Config) {
+	f.tlsConfig = cfg
+}
+
+// Start runs the replication link in the background
+func (f *Follower) Start() {
+	go f.run()
+}
+
+// Addr returns the leader address
+func (f *Follower) Addr() string {
+	return f.addr
+}
+
+// State returns the current link state
+func (f *Follower) State() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.state
+}
+
+// Offset returns the replication offset processed so far
+func (f *Follower) Offset() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.offset
+}
+
+// Close stops the replication link
+func (f *Follower) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return
+	}
+	f.closed = true
+	close(f.done)
+	if f.conn != nil {
+		f.conn.Close()
+	}
+}
+
+func (f *Follower) run() {
+	delay := minReconnectDelay
+
+	for {
+		synced, err := f.sync()
+
+		f.mu.Lock()
+		closed := f.closed
+		f.state = StateConnecting
+		f.conn = nil
+		f.mu.Unlock()
+		if closed {
+			return
+		}
+
+		// A link that got as far as streaming starts over with a short
+		// delay, only repeated failures to sync back off
+		if synced {
+			delay = minReconnectDelay
+		}
+		logger.Warn("Replication link to %s lost: %v (retrying in %v)", f.addr, err, delay)
+		select {
+		case <-f.done:
+			return
+		case <-time.After(delay):
+		}
+
+		if delay *= 2; delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// sync connects to the leader, negotiates a full or partial resync and
+// then applies the command stream until the connection fails. synced
+// reports whether the resync succeeded before the failure.
+func (f *Follower) sync() (synced bool, err error) {
+	var conn net.Conn
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if f.tlsConfig != nil {
+		conn, err = tls.DialWithDialer(dialer, "tcp", f.addr, f.tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", f.addr)
+	}
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return false, nil
+	}
+	f.conn = conn
+	f.state = StateSync
+	replID, offset := f.replID, f.offset
+	f.mu.Unlock()
+
+	reader := bufio.NewReader(&timeoutReader{conn: conn, timeout: Timeout})
+	if err := f.auth(conn, reader); err != nil {
+		return false, err
+	}
+
+	if _, err := fmt.Fprintf(conn, "PSYNC %s %d\n", replID, offset); err != nil {
+		return false, err
+	}
+
+	reply, err := protocol.ReadReply(reader)
+	if err != nil {
+		return false, err
+	}
+	if reply.Type != protocol.StatusType {
+		return false, fmt.Errorf("unexpected PSYNC reply: %s", reply)
+	}
+
+	fields := strings.Fields(reply.Str)
+	switch {
+	case len(fields) == 3 && fields[0] == "FULLRESYNC":
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("invalid FULLRESYNC offset: %w", err)
+		}
+		if err := f.loadSnapshot(reader); err != nil {
+			return false, fmt.Errorf("full sync failed: %w", err)
+		}
+		f.mu.Lock()
+		f.replID = fields[1]
+		f.offset = offset
+		f.mu.Unlock()
+		logger.Info("Full sync with %s complete at offset %d", f.addr, offset)
+	case len(fields) == 2 && fields[0] == "CONTINUE":
+		logger.Info("Partial resync with %s from offset %d", f.addr, offset)
+	default:
+		return false, fmt.Errorf("unexpected PSYNC reply: %s", reply.Str)
+	}
+
+	f.mu.Lock()
+	f.state = StateConnected
+	f.mu.Unlock()
+
+	// Stream: every reply is a write command, offsets count raw bytes
+	for {
+		cmd, err := protocol.ReadReply(reader)
+		if err != nil {
+			return true, err
+		}
+		args, err := commandArgs(cmd)
+		if err != nil {
+			return true, err
+		}
+		if err := f.handler.Apply(args); err != nil {
+			logger.Error("Failed to apply replicated command %q: %v", args, err)
+		}
+
+		f.mu.Lock()
+		f.offset += int64(len(cmd.Bytes()))
+		f.mu.Unlock()
+	}
+}
+
+// auth authenticates with the leader if a password is configured
+func (f *Follower) auth(conn net.Conn, reader *bufio.Reader) error {
+	if f.password == "" {
+		return nil
+	}
+
+	cmd := "AUTH " + f.password
+	if f.user != "" {
+		cmd = "AUTH " + f.user + " " + f.password
+	}
+	if _, err := fmt.Fprintf(conn, "%s\n", cmd); err != nil {
+		return err
+	}
+
+	reply, err := protocol.ReadReply(reader)
+	if err != nil {
+		return err
+	}
+	if reply.IsError() {
+		return fmt.Errorf("authentication with leader failed: %s", reply.Str)
+	}
+	return nil
+}
+
+// loadSnapshot replaces the local dataset with the leader's snapshot,
+// sent as an array of commands
+func (f *Follower) loadSnapshot(reader *bufio.Reader) error {
+	snapshot, err := protocol.ReadReply(reader)
+	if err != nil {
+		return err
+	}
+	if snapshot.Type != protocol.ArrayType {
+		return fmt.Errorf("invalid snapshot: %s", snapshot)
+	}
+
+	if err := f.handler.Reset(); err != nil {
+		return err
+	}
+
+	for _, cmd := range snapshot.Elems {
+		args, err := commandArgs(cmd)
+		if err != nil {
+			return err
+		}
+		if err := f.handler.Apply(args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// timeoutReader fails a read once timeout passes without data from conn
+type timeoutReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+	return r.conn.Read(p)
+}
+
+// commandArgs extracts a command sent as an array of bulk strings
+func commandArgs(cmd protocol.Reply) ([]string, error) {
+	if cmd.Type != protocol.ArrayType || len(cmd.Elems) == 0 {
+		return nil, fmt.Errorf("%w: expected a command, got %s", protocol.ErrProtocol, cmd)
+	}
+	args := make([]string, len(cmd.Elems))
+	for i, elem := range cmd.Elems {
+		if elem.Type != protocol.BulkType {
+			return nil, fmt.Errorf("%w: expected a bulk string argument", protocol.ErrProtocol)
+		}
+		args[i] = elem.Str
+	}
+	return args, nil
+}
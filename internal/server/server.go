@@ -1,12 +1,19 @@
 package server
 
 import (
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"os"
+	"strconv"
+	"time"
 
 	"memkv/internal/eventloop"
 	"memkv/internal/executor"
 	"memkv/internal/logger"
+	"memkv/internal/raft"
+	"memkv/internal/wal"
 )
 
 // Server represents the KV-Store server
@@ -14,54 +21,376 @@ type Server struct {
 	port     int
 	executor *executor.Executor
 	loop     *eventloop.EventLoop
+
+	unixSocket     string
+	unixSocketPerm os.FileMode
+
+	tlsPort     int
+	tlsConfig   *tls.Config
+	tlsListener net.Listener
+
+	pubsubOutputLimit int
 }
 
 // Config holds server configuration
 type Config struct {
-	Port    int
+	Port    int // 0 disables the TCP listener
 	WALPath string
+
+	// UnixSocket is the path of an optional Unix domain socket listener,
+	// created with UnixSocketPerm permissions (default 0700)
+	UnixSocket     string
+	UnixSocketPerm os.FileMode
+
+	// NotifyKeyspaceEvents selects keyspace notification classes using
+	// the K/E/g/$/x/e/A flags. Empty disables notifications.
+	NotifyKeyspaceEvents string
+
+	// ReplicaOfHost and ReplicaOfPort start the server as a replica of
+	// the given leader. Empty host runs the server as a leader.
+	ReplicaOfHost string
+	ReplicaOfPort int
+
+	// MasterUser and MasterAuth authenticate with the leader before
+	// syncing. No AUTH is sent if MasterAuth is empty.
+	MasterUser string
+	MasterAuth string
+
+	// RaftID enables Raft replication when set, with the Raft log kept
+	// in the WAL. RaftAddr is the address for Raft RPCs and RaftPeers the
+	// initial "id=host:port,..." membership (including this node).
+	RaftID    string
+	RaftAddr  string
+	RaftPeers string
+
+	// ClusterEnabled partitions keys into hash slots. ClusterNodeID
+	// identifies this node (generated if empty) and ClusterAnnounceAddr
+	// is the address other nodes redirect clients to. The nodes and
+	// slots are kept in ClusterConfigFile across restarts.
+	ClusterEnabled      bool
+	ClusterNodeID       string
+	ClusterAnnounceAddr string
+	ClusterConfigFile   string
+
+	// MaxMemory limits the approximate dataset size in bytes (0 means
+	// unlimited); MaxMemoryPolicy picks what happens when it is reached
+	MaxMemory       int64
+	MaxMemoryPolicy string
+
+	// ACLFile holds ACL users loaded at startup and written by ACL SAVE.
+	// RequirePass sets a password on the default user.
+	ACLFile     string
+	RequirePass string
+
+	// TLSPort enables a TLS listener next to the plaintext one, which
+	// stays open unless Port is 0. TLSCACertFile, if set, requires
+	// clients to present a certificate signed by that CA. TLSMinVersion
+	// is "1.2" (default) or "1.3".
+	//
+	// Replication, Raft RPCs and MIGRATE use plain TCP unless
+	// TLSInterNode is set, in which case they use TLS with the same
+	// certificate and CA: the leader given to ReplicaOfPort and MIGRATE
+	// targets are then reached on their TLS ports.
+	TLSPort       int
+	TLSCertFile   string
+	TLSKeyFile    string
+	TLSCACertFile string
+	TLSMinVersion string
+	TLSInterNode  bool
+
+	// SlowlogLogSlowerThan is the slow log threshold in microseconds
+	// (0 keeps the default, negative disables the log); SlowlogMaxLen
+	// bounds the number of entries kept (0 keeps the default)
+	SlowlogLogSlowerThan int64
+	SlowlogMaxLen        int
+
+	// AppendFsync is the WAL fsync policy: always (default), everysec or no
+	AppendFsync string
+
+	// Timeout closes clients idle for longer than this (0 disables it)
+	Timeout time.Duration
+
+	// PubSubOutputLimit disconnects subscribers and monitors that leave
+	// more pushed output unread than this many bytes (0 keeps the
+	// default, negative removes the limit)
+	PubSubOutputLimit int
+
+	// ConfigFile is the file the configuration was loaded from, which
+	// CONFIG REWRITE updates. Empty disables CONFIG REWRITE.
+	ConfigFile string
 }
 
 // New creates a new server instance
 func New(cfg Config) (*Server, error) {
-	// Create executor with storage and WAL
-	exec, err := executor.New(cfg.WALPath)
+	var tlsCfg *tls.Config
+	if cfg.TLSPort > 0 {
+		var err error
+		if tlsCfg, err = newTLSConfig(cfg); err != nil {
+			return nil, err
+		}
+	} else if cfg.TLSInterNode {
+		return nil, errors.New("inter-node TLS requires a TLS port")
+	}
+
+	// Create executor with storage and WAL. Under Raft the WAL holds the
+	// Raft log and storage is rebuilt from it, so storage logs nothing.
+	var exec *executor.Executor
+	var err error
+	if cfg.RaftID != "" {
+		exec, err = executor.NewWithWAL(wal.NewDiscardWAL())
+	} else {
+		exec, err = executor.New(cfg.WALPath)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to create executor: %w", err)
 	}
 
+	if err := exec.SetNotifyKeyspaceEvents(cfg.NotifyKeyspaceEvents); err != nil {
+		exec.Close()
+		return nil, fmt.Errorf("invalid keyspace notification config: %w", err)
+	}
+
+	if err := configureACL(exec, cfg); err != nil {
+		exec.Close()
+		return nil, err
+	}
+
+	exec.SetMaxMemory(cfg.MaxMemory)
+	if cfg.MaxMemoryPolicy != "" {
+		if err := exec.SetMaxMemoryPolicy(cfg.MaxMemoryPolicy); err != nil {
+			exec.Close()
+			return nil, err
+		}
+	}
+
+	if cfg.SlowlogLogSlowerThan != 0 {
+		exec.SetSlowlogThreshold(cfg.SlowlogLogSlowerThan)
+	}
+	if cfg.SlowlogMaxLen > 0 {
+		exec.SetSlowlogMaxLen(cfg.SlowlogMaxLen)
+	}
+
+	if cfg.AppendFsync != "" {
+		if err := exec.SetFsyncPolicy(cfg.AppendFsync); err != nil {
+			exec.Close()
+			return nil, err
+		}
+	}
+	exec.SetIdleTimeout(cfg.Timeout)
+	exec.SetConfigFile(cfg.ConfigFile)
+	exposeReadOnlyConfig(exec, cfg)
+
+	if cfg.ClusterEnabled {
+		addr := cfg.ClusterAnnounceAddr
+		if addr == "" {
+			addr = net.JoinHostPort("127.0.0.1", strconv.Itoa(clientPort(cfg)))
+		}
+		if err := exec.EnableCluster(cfg.ClusterNodeID, addr, cfg.ClusterConfigFile); err != nil {
+			exec.Close()
+			return nil, err
+		}
+	}
+
+	exec.SetMasterAuth(cfg.MasterUser, cfg.MasterAuth)
+	var raftTLS *tls.Config
+	if cfg.TLSInterNode {
+		raftTLS = tlsCfg
+		exec.SetInterNodeTLS(interNodeTLSConfig(tlsCfg))
+	}
+	if cfg.RaftID != "" {
+		if err := enableRaft(exec, cfg, raftTLS); err != nil {
+			exec.Close()
+			return nil, fmt.Errorf("failed to start raft: %w", err)
+		}
+	} else if cfg.ReplicaOfHost != "" {
+		exec.ReplicaOf(cfg.ReplicaOfHost, cfg.ReplicaOfPort)
+	}
+
+	perm := cfg.UnixSocketPerm
+	if perm == 0 {
+		perm = 0700
+	}
+
+	outputLimit := cfg.PubSubOutputLimit
+	switch {
+	case outputLimit == 0:
+		outputLimit = eventloop.DefaultPubSubOutputLimit
+	case outputLimit < 0:
+		outputLimit = 0
+	}
+
 	return &Server{
-		port:     cfg.Port,
-		executor: exec,
+		port:           cfg.Port,
+		executor:       exec,
+		unixSocket:     cfg.UnixSocket,
+		unixSocketPerm: perm,
+		tlsPort:        cfg.TLSPort,
+		tlsConfig:      tlsCfg,
+
+		pubsubOutputLimit: outputLimit,
 	}, nil
 }
 
+// exposeReadOnlyConfig makes startup-only settings visible to CONFIG GET
+func exposeReadOnlyConfig(exec *executor.Executor, cfg Config) {
+	exec.SetReadOnlyConfig("port", strconv.Itoa(cfg.Port))
+	exec.SetReadOnlyConfig("wal", cfg.WALPath)
+	exec.SetReadOnlyConfig("unixsocket", cfg.UnixSocket)
+	exec.SetReadOnlyConfig("tls-port", strconv.Itoa(cfg.TLSPort))
+	exec.SetReadOnlyConfig("aclfile", cfg.ACLFile)
+	exec.SetReadOnlyConfig("cluster", strconv.FormatBool(cfg.ClusterEnabled))
+	exec.SetReadOnlyConfig("cluster-config-file", cfg.ClusterConfigFile)
+	exec.SetReadOnlyConfig("raft-id", cfg.RaftID)
+}
+
+// configureACL loads the ACL file, if any, and applies RequirePass
+func configureACL(exec *executor.Executor, cfg Config) error {
+	if cfg.ACLFile != "" {
+		if _, err := os.Stat(cfg.ACLFile); os.IsNotExist(err) {
+			// ACL SAVE will create it
+			exec.SetACLFile(cfg.ACLFile)
+		} else if err := exec.LoadACLFile(cfg.ACLFile); err != nil {
+			return fmt.Errorf("failed to load ACL file: %w", err)
+		}
+	}
+
+	if cfg.RequirePass != "" {
+		if err := exec.RequirePass(cfg.RequirePass); err != nil {
+			return fmt.Errorf("failed to set password: %w", err)
+		}
+	}
+	return nil
+}
+
+// clientPort is the port other nodes send clients to: the plaintext
+// port, or the TLS port when only TLS is served
+func clientPort(cfg Config) int {
+	if cfg.Port == 0 {
+		return cfg.TLSPort
+	}
+	return cfg.Port
+}
+
+// enableRaft starts the Raft node described by cfg, serving and dialing
+// Raft RPCs over TLS with tlsCfg if set
+func enableRaft(exec *executor.Executor, cfg Config, tlsCfg *tls.Config) error {
+	peers, err := raft.ParsePeers(cfg.RaftPeers)
+	if err != nil {
+		return err
+	}
+	if _, ok := peers[cfg.RaftID]; !ok {
+		peers[cfg.RaftID] = cfg.RaftAddr
+	}
+
+	// Clients are redirected to the leader's host on its client port
+	host, _, err := net.SplitHostPort(cfg.RaftAddr)
+	if err != nil {
+		return fmt.Errorf("invalid raft address: %w", err)
+	}
+
+	raftCfg := raft.Config{
+		ID:         cfg.RaftID,
+		Addr:       cfg.RaftAddr,
+		ClientAddr: net.JoinHostPort(host, strconv.Itoa(clientPort(cfg))),
+		Peers:      peers,
+		LogPath:    cfg.WALPath,
+	}
+	if tlsCfg != nil {
+		raftCfg.TLSConfig = tlsCfg
+		raftCfg.TLSClientConfig = interNodeTLSConfig(tlsCfg)
+	}
+	return exec.EnableRaft(raftCfg)
+}
+
 // Start starts the server
 func (s *Server) Start() error {
+	var listeners []net.Listener
+	defer func() {
+		for _, l := range listeners {
+			l.Close()
+		}
+	}()
+
 	// Start TCP listener
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
-	if err != nil {
-		return fmt.Errorf("failed to start listener: %w", err)
+	if s.port > 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", s.port))
+		if err != nil {
+			return fmt.Errorf("failed to start listener: %w", err)
+		}
+		listeners = append(listeners, listener)
+		logger.Info("Listening on port %d", s.port)
+	}
+
+	// Start Unix socket listener
+	if s.unixSocket != "" {
+		listener, err := listenUnix(s.unixSocket, s.unixSocketPerm)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, listener)
+		logger.Info("Listening on unix socket %s", s.unixSocket)
 	}
-	defer listener.Close()
 
-	logger.Info("Listening on port %d", s.port)
+	if len(listeners) == 0 && s.tlsConfig == nil {
+		return fmt.Errorf("no listener configured, set a port, a unix socket or a TLS port")
+	}
 
 	// Create event loop
-	loop, err := eventloop.New(listener, s.executor)
+	loop, err := eventloop.New(listeners, s.executor)
 	if err != nil {
-		listener.Close()
 		return fmt.Errorf("failed to create event loop: %w", err)
 	}
 	s.loop = loop
 	defer s.loop.Close()
+	loop.SetPubSubOutputLimit(s.pubsubOutputLimit)
+
+	// TLS clients are bridged into the event loop after their handshake,
+	// at the cost of two goroutines per connection (see ServeConn)
+	if s.tlsConfig != nil {
+		tlsListener, err := tls.Listen("tcp", fmt.Sprintf(":%d", s.tlsPort), s.tlsConfig)
+		if err != nil {
+			return fmt.Errorf("failed to start TLS listener: %w", err)
+		}
+		s.tlsListener = tlsListener
+		defer tlsListener.Close()
+
+		logger.Info("Listening for TLS on port %d", s.tlsPort)
+		go s.acceptTLS(tlsListener)
+	}
 
 	// Run the event loop (blocking)
 	return s.loop.Run()
 }
 
+// listenUnix listens on a Unix domain socket at path, replacing a stale
+// socket file left behind by a previous run
+func listenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start unix listener: %w", err)
+	}
+
+	if err := os.Chmod(path, perm); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+	return listener, nil
+}
+
 // Close gracefully shuts down the server
 func (s *Server) Close() error {
+	if s.tlsListener != nil {
+		s.tlsListener.Close()
+	}
 	if s.loop != nil {
 		s.loop.Close()
 	}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	"memkv/internal/logger"
+)
+
+// tlsHandshakeTimeout bounds how long a client may take to complete the handshake
+const tlsHandshakeTimeout = 10 * time.Second
+
+// newTLSConfig builds the server TLS configuration. A client CA enables
+// mutual TLS: clients must present a certificate signed by it.
+func newTLSConfig(cfg Config) (*tls.Config, error) {
+	if cfg.TLSCertFile == "" || cfg.TLSKeyFile == "" {
+		return nil, errors.New("TLS requires a certificate and a key")
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+
+	minVersion, err := parseTLSVersion(cfg.TLSMinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsCfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   minVersion,
+	}
+
+	if cfg.TLSCACertFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", cfg.TLSCACertFile)
+		}
+		tlsCfg.ClientCAs = pool
+		tlsCfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsCfg, nil
+}
+
+// interNodeTLSConfig derives the configuration used to dial other nodes
+// from the server's: it presents the same certificate, for peers that
+// require client certificates, and trusts the client CA if one is set
+// (the system roots otherwise). Peer certificates must be valid for the
+// host names or IPs the nodes are dialed with.
+func interNodeTLSConfig(server *tls.Config) *tls.Config {
+	return &tls.Config{
+		Certificates: server.Certificates,
+		RootCAs:      server.ClientCAs,
+		MinVersion:   server.MinVersion,
+	}
+}
+
+// parseTLSVersion parses the minimum TLS version. Versions before 1.2
+// are rejected as insecure.
+func parseTLSVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS version '%s', use 1.2 or 1.3", v)
+	}
+}
+
+// acceptTLS accepts TLS clients, completes their handshake and hands
+// them to the event loop. It returns when the listener is closed.
+func (s *Server) acceptTLS(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			logger.Error("TLS accept failed: %v", err)
+			continue
+		}
+
+		go s.handshake(conn.(*tls.Conn))
+	}
+}
+
+func (s *Server) handshake(conn *tls.Conn) {
+	conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+	if err := conn.Handshake(); err != nil {
+		logger.Warn("TLS handshake with %s failed: %v", conn.RemoteAddr(), err)
+		conn.Close()
+		return
+	}
+	conn.SetDeadline(time.Time{})
+
+	if err := s.loop.ServeConn(conn); err != nil {
+		logger.Error("Failed to serve TLS connection: %v", err)
+		conn.Close()
+	}
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// EvictionPolicy selects which keys are removed when maxmemory is reached
+type EvictionPolicy string
+
+const (
+	NoEviction    EvictionPolicy = "noeviction"
+	AllKeysLRU    EvictionPolicy = "allkeys-lru"
+	AllKeysLFU    EvictionPolicy = "allkeys-lfu"
+	AllKeysRandom EvictionPolicy = "allkeys-random"
+	VolatileLRU   EvictionPolicy = "volatile-lru"
+	VolatileTTL   EvictionPolicy = "volatile-ttl"
+)
+
+// DefaultEvictionSamples is the number of keys sampled per eviction
+const DefaultEvictionSamples = 5
+
+// ParseEvictionPolicy validates a policy name
+func ParseEvictionPolicy(name string) (EvictionPolicy, error) {
+	switch p := EvictionPolicy(name); p {
+	case NoEviction, AllKeysLRU, AllKeysLFU, AllKeysRandom, VolatileLRU, VolatileTTL:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown eviction policy '%s'", name)
+	}
+}
+
+// volatile reports whether the policy only evicts keys with a TTL
+func (p EvictionPolicy) volatile() bool {
+	return p == VolatileLRU || p == VolatileTTL
+}
+
+// RemoveCause tells a remove hook why a key disappeared
+type RemoveCause int
+
+const (
+	RemoveExpired RemoveCause = iota
+	RemoveEvicted
+)
+
+// entryOverhead approximates the per-key bookkeeping cost in bytes
+const entryOverhead = 64
+
+// entrySize estimates the memory used by a key-value pair
+func entrySize(key, value string) int64 {
+	return int64(len(key)+len(value)) + entryOverhead
+}
+
+// LFU counter tuning, as in Redis: new keys start at lfuInitVal, the
+// counter grows logarithmically and loses one point per idle minute
+const (
+	lfuInitVal   = 5
+	lfuLogFactor = 10
+)
+
+// lfuIncr probabilistically increments a logarithmic access counter
+func lfuIncr(counter uint8) uint8 {
+	if counter == 255 {
+		return counter
+	}
+	base := float64(0)
+	if counter > lfuInitVal {
+		base = float64(counter - lfuInitVal)
+	}
+	if rand.Float64() < 1.0/(base*lfuLogFactor+1) {
+		counter++
+	}
+	return counter
+}
+
+// lfuDecay lowers counter by one for every minute since lastAccess
+func lfuDecay(counter uint8, lastAccess, nowMillis int64) uint8 {
+	minutes := (nowMillis - lastAccess) / 60000
+	if minutes >= int64(counter) {
+		return 0
+	}
+	return counter - uint8(minutes)
+}
+
+// pickVictim samples keys and returns the database and key of the best
+// eviction candidate for the current policy, or "" if there is none
+func (ps *PersistentStorage) pickVictim() (int, string) {
+	var (
+		bestDB    int
+		best      string
+		bestScore int64
+		sampled   int
+	)
+
+	consider := func(db int, key string) bool {
+		d := ps.dbs[db]
+		it := d.store[key]
+		var score int64 // lower is evicted first
+		switch ps.policy {
+		case AllKeysLRU, VolatileLRU:
+			score = it.access
+		case AllKeysLFU:
+			score = int64(lfuDecay(it.freq, it.access, ps.nowMillis()))<<48 | it.access&(1<<48-1)
+		case VolatileTTL:
+			score = d.expires[key]
+		}
+		if best == "" || score < bestScore {
+			bestDB, best, bestScore = db, key, score
+		}
+		sampled++
+		return ps.policy == AllKeysRandom || sampled >= ps.samples
+	}
+
+	// Map iteration starts at a random position, which gives the
+	// sampling. The databases are visited from a random one on.
+	start := rand.Intn(len(ps.dbs))
+	for i := range ps.dbs {
+		db := (start + i) % len(ps.dbs)
+		if ps.policy.volatile() {
+			for key := range ps.dbs[db].expires {
+				if consider(db, key) {
+					return bestDB, best
+				}
+			}
+			continue
+		}
+		for key := range ps.dbs[db].store {
+			if consider(db, key) {
+				return bestDB, best
+			}
+		}
+	}
+	return bestDB, best
+}
@@ -2,14 +2,47 @@ package storage
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"memkv/internal/wal"
 )
 
+// item is a stored value with the metadata used for eviction
+type item struct {
+	value  string
+	access int64 // unix milliseconds of the last access (LRU clock)
+	freq   uint8 // logarithmic access counter (LFU)
+}
+
+// database is one numbered keyspace
+type database struct {
+	store   map[string]*item
+	expires map[string]int64 // key -> expiry in unix milliseconds
+}
+
+func newDatabase() *database {
+	return &database{
+		store:   make(map[string]*item),
+		expires: make(map[string]int64),
+	}
+}
+
 // PersistentStorage is a memory storage with WAL for durability
 type PersistentStorage struct {
-	store map[string]string
-	wal   wal.WAL // Now using interface
+	dbs []*database
+	db  int     // selected database
+	wal wal.WAL // Now using interface
+
+	used      int64 // approximate bytes used by keys and values
+	maxMemory int64 // 0 means unlimited
+	policy    EvictionPolicy
+	samples   int
+
+	onRemove func(db int, key string, cause RemoveCause)
+
+	lastCompaction time.Time
 }
 
 // NewPersistentStorage creates a new persistent storage with file-based WAL
@@ -29,8 +62,13 @@ func NewPersistentStorageWithWAL(w wal.WAL) (*PersistentStorage, error) {
 
 func newPersistentStorageWithWAL(w wal.WAL) (*PersistentStorage, error) {
 	ps := &PersistentStorage{
-		store: make(map[string]string),
-		wal:   w,
+		dbs:     make([]*database, Databases),
+		wal:     w,
+		policy:  NoEviction,
+		samples: DefaultEvictionSamples,
+	}
+	for i := range ps.dbs {
+		ps.dbs[i] = newDatabase()
 	}
 
 	// Recover from WAL
@@ -45,11 +83,54 @@ func newPersistentStorageWithWAL(w wal.WAL) (*PersistentStorage, error) {
 // recover replays the WAL to restore state
 func (ps *PersistentStorage) recover() error {
 	return ps.wal.Replay(func(entry *wal.Entry) error {
+		if !validDB(entry.DB) {
+			return fmt.Errorf("invalid database %d for %s", entry.DB, entry.Key)
+		}
+		d := ps.dbs[entry.DB]
+
 		switch entry.Op {
 		case wal.OpSet:
-			ps.store[entry.Key] = entry.Value
+			ps.put(d, entry.Key, entry.Value)
+		case wal.OpSetKeepTTL:
+			ps.putKeepTTL(d, entry.Key, entry.Value)
 		case wal.OpDelete:
-			delete(ps.store, entry.Key)
+			ps.remove(d, entry.Key)
+		case wal.OpExpire:
+			at, err := strconv.ParseInt(entry.Value, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid expiry for %s: %w", entry.Key, err)
+			}
+			if _, ok := d.store[entry.Key]; !ok {
+				return nil
+			}
+			if at == 0 {
+				delete(d.expires, entry.Key)
+			} else {
+				d.expires[entry.Key] = at
+			}
+		case wal.OpMove:
+			dst, err := strconv.Atoi(entry.Value)
+			if err != nil || !validDB(dst) {
+				return fmt.Errorf("invalid destination for %s: %q", entry.Key, entry.Value)
+			}
+			ps.move(d, ps.dbs[dst], entry.Key)
+		case wal.OpSwapDB:
+			other, err := strconv.Atoi(entry.Key)
+			if err != nil || !validDB(other) {
+				return fmt.Errorf("invalid database to swap with: %q", entry.Key)
+			}
+			ps.dbs[entry.DB], ps.dbs[other] = ps.dbs[other], ps.dbs[entry.DB]
+		case wal.OpFlushDB:
+			ps.flush(entry.DB)
+		case wal.OpRename:
+			ps.rename(d, entry.Key, entry.Value)
+		case wal.OpCopy:
+			dst, newkey, _ := strings.Cut(entry.Value, " ")
+			n, err := strconv.Atoi(dst)
+			if err != nil || !validDB(n) || newkey == "" {
+				return fmt.Errorf("invalid copy destination for %s: %q", entry.Key, entry.Value)
+			}
+			ps.copy(d, ps.dbs[n], entry.Key, newkey)
 		default:
 			return fmt.Errorf("unknown operation: %s", entry.Op)
 		}
@@ -57,55 +138,506 @@ func (ps *PersistentStorage) recover() error {
 	})
 }
 
-func (ps *PersistentStorage) Get(key string) (string, error) {
-	value, ok := ps.store[key]
+func validDB(db int) bool {
+	return db >= 0 && db < Databases
+}
+
+func (ps *PersistentStorage) nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+// selected returns the selected database
+func (ps *PersistentStorage) selected() *database {
+	return ps.dbs[ps.db]
+}
+
+// put stores a value in memory, clearing any TTL like SET does
+func (ps *PersistentStorage) put(d *database, key, value string) {
+	if old, ok := d.store[key]; ok {
+		ps.used -= entrySize(key, old.value)
+	}
+	d.store[key] = &item{
+		value:  value,
+		access: ps.nowMillis(),
+		freq:   lfuInitVal,
+	}
+	delete(d.expires, key)
+	ps.used += entrySize(key, value)
+}
+
+// putKeepTTL stores a value in memory, leaving the key's TTL as it is
+func (ps *PersistentStorage) putKeepTTL(d *database, key, value string) {
+	at, ok := d.expires[key]
+	ps.put(d, key, value)
+	if ok {
+		d.expires[key] = at
+	}
+}
+
+// remove drops a key from memory
+func (ps *PersistentStorage) remove(d *database, key string) {
+	if old, ok := d.store[key]; ok {
+		ps.used -= entrySize(key, old.value)
+		delete(d.store, key)
+	}
+	delete(d.expires, key)
+}
+
+// move transfers key and its TTL from src to dst in memory
+func (ps *PersistentStorage) move(src, dst *database, key string) {
+	it, ok := src.store[key]
+	if !ok {
+		return
+	}
+	ps.remove(dst, key)
+	dst.store[key] = it
+	if at, ok := src.expires[key]; ok {
+		dst.expires[key] = at
+	}
+	delete(src.store, key)
+	delete(src.expires, key)
+}
+
+// rename gives key the name newkey in memory, replacing any newkey
+func (ps *PersistentStorage) rename(d *database, key, newkey string) {
+	it, ok := d.store[key]
+	if !ok || key == newkey {
+		return
+	}
+	at, hasTTL := d.expires[key]
+
+	ps.remove(d, key)
+	ps.remove(d, newkey)
+	d.store[newkey] = it
+	if hasTTL {
+		d.expires[newkey] = at
+	}
+	ps.used += entrySize(newkey, it.value)
+}
+
+// copy stores key's value and TTL from src under newkey in dst in
+// memory, replacing any newkey
+func (ps *PersistentStorage) copy(src, dst *database, key, newkey string) {
+	it, ok := src.store[key]
+	if !ok || (src == dst && key == newkey) {
+		return
+	}
+	ps.put(dst, newkey, it.value)
+	if at, ok := src.expires[key]; ok {
+		dst.expires[newkey] = at
+	}
+}
+
+// flush empties database db in memory
+func (ps *PersistentStorage) flush(db int) {
+	for key, it := range ps.dbs[db].store {
+		ps.used -= entrySize(key, it.value)
+	}
+	ps.dbs[db] = newDatabase()
+}
+
+// lookup returns the live item for key in database db, expiring it if
+// its TTL elapsed
+func (ps *PersistentStorage) lookup(db int, key string) *item {
+	d := ps.dbs[db]
+	it, ok := d.store[key]
 	if !ok {
+		return nil
+	}
+	if at, ok := d.expires[key]; ok && at <= ps.nowMillis() {
+		ps.drop(db, key, RemoveExpired)
+		return nil
+	}
+	return it
+}
+
+// touch records an access for LRU/LFU
+func (ps *PersistentStorage) touch(it *item) {
+	now := ps.nowMillis()
+	it.freq = lfuIncr(lfuDecay(it.freq, it.access, now))
+	it.access = now
+}
+
+// drop deletes a key on behalf of the server (expiry or eviction),
+// recording the deletion in the WAL
+func (ps *PersistentStorage) drop(db int, key string, cause RemoveCause) error {
+	if err := ps.wal.WriteDelete(db, key); err != nil {
+		return fmt.Errorf("WAL write failed: %w", err)
+	}
+	ps.remove(ps.dbs[db], key)
+
+	if ps.onRemove != nil {
+		ps.onRemove(db, key, cause)
+	}
+	return nil
+}
+
+// ensureMemory evicts keys until storing value under key in d fits in
+// maxmemory
+func (ps *PersistentStorage) ensureMemory(d *database, key, value string) error {
+	if ps.maxMemory <= 0 {
+		return nil
+	}
+
+	for {
+		need := ps.used + entrySize(key, value)
+		if old, ok := d.store[key]; ok {
+			need -= entrySize(key, old.value)
+		}
+		if need <= ps.maxMemory {
+			return nil
+		}
+
+		if ps.policy == NoEviction {
+			return ErrOOM
+		}
+		db, victim := ps.pickVictim()
+		if victim == "" {
+			return ErrOOM
+		}
+		if err := ps.drop(db, victim, RemoveEvicted); err != nil {
+			return err
+		}
+	}
+}
+
+func (ps *PersistentStorage) Get(key string) (string, error) {
+	it := ps.lookup(ps.db, key)
+	if it == nil {
 		return "", ErrKeyNotFound
 	}
-	return value, nil
+	ps.touch(it)
+	return it.value, nil
 }
 
 func (ps *PersistentStorage) Set(key string, value string) error {
+	// Make room before logging the write
+	if err := ps.ensureMemory(ps.selected(), key, value); err != nil {
+		return err
+	}
+
 	// Write to WAL first (Write-Ahead)
-	if err := ps.wal.WriteSet(key, value); err != nil {
+	if err := ps.wal.WriteSet(ps.db, key, value); err != nil {
 		return fmt.Errorf("WAL write failed: %w", err)
 	}
 
 	// Then update memory
-	ps.store[key] = value
+	ps.put(ps.selected(), key, value)
+	return nil
+}
+
+// SetKeepTTL is Set without clearing the key's TTL, logged as a single
+// entry so a crash can't leave the new value without its expiry
+func (ps *PersistentStorage) SetKeepTTL(key string, value string) error {
+	if err := ps.ensureMemory(ps.selected(), key, value); err != nil {
+		return err
+	}
+
+	if err := ps.wal.WriteSetKeepTTL(ps.db, key, value); err != nil {
+		return fmt.Errorf("WAL write failed: %w", err)
+	}
+	ps.putKeepTTL(ps.selected(), key, value)
 	return nil
 }
 
 func (ps *PersistentStorage) Delete(key string) error {
-	if _, ok := ps.store[key]; !ok {
+	if ps.lookup(ps.db, key) == nil {
 		return ErrKeyNotFound
 	}
 
 	// Write to WAL first
-	if err := ps.wal.WriteDelete(key); err != nil {
+	if err := ps.wal.WriteDelete(ps.db, key); err != nil {
 		return fmt.Errorf("WAL write failed: %w", err)
 	}
 
 	// Then delete from memory
-	delete(ps.store, key)
+	ps.remove(ps.selected(), key)
 	return nil
 }
 
 func (ps *PersistentStorage) Exists(key string) bool {
-	_, ok := ps.store[key]
-	return ok
+	return ps.lookup(ps.db, key) != nil
 }
 
 func (ps *PersistentStorage) Keys() []string {
-	keys := make([]string, 0, len(ps.store))
-	for k := range ps.store {
+	d := ps.selected()
+	now := ps.nowMillis()
+	keys := make([]string, 0, len(d.store))
+	for k := range d.store {
+		if at, ok := d.expires[k]; ok && at <= now {
+			continue
+		}
 		keys = append(keys, k)
 	}
 	return keys
 }
 
 func (ps *PersistentStorage) Size() int {
-	return len(ps.store)
+	size := 0
+	for _, d := range ps.dbs {
+		size += len(d.store)
+	}
+	return size
+}
+
+// Select makes key operations apply to database db
+func (ps *PersistentStorage) Select(db int) error {
+	if !validDB(db) {
+		return ErrInvalidDB
+	}
+	ps.db = db
+	return nil
+}
+
+// DBSize returns the number of keys in database db
+func (ps *PersistentStorage) DBSize(db int) int {
+	if !validDB(db) {
+		return 0
+	}
+	return len(ps.dbs[db].store)
+}
+
+// Move moves key with its TTL from the selected database to db. It fails
+// with ErrKeyExists if db already has the key.
+func (ps *PersistentStorage) Move(key string, db int) error {
+	if !validDB(db) {
+		return ErrInvalidDB
+	}
+	if ps.lookup(ps.db, key) == nil {
+		return ErrKeyNotFound
+	}
+	if ps.lookup(db, key) != nil {
+		return ErrKeyExists
+	}
+
+	// A single entry, so a crash never leaves the key in both or neither
+	if err := ps.wal.WriteMove(ps.db, key, db); err != nil {
+		return fmt.Errorf("WAL write failed: %w", err)
+	}
+	ps.move(ps.selected(), ps.dbs[db], key)
+	return nil
+}
+
+// SwapDB exchanges the contents of databases a and b
+func (ps *PersistentStorage) SwapDB(a, b int) error {
+	if !validDB(a) || !validDB(b) {
+		return ErrInvalidDB
+	}
+	if err := ps.wal.WriteSwapDB(a, b); err != nil {
+		return fmt.Errorf("WAL write failed: %w", err)
+	}
+	ps.dbs[a], ps.dbs[b] = ps.dbs[b], ps.dbs[a]
+	return nil
+}
+
+// FlushDB removes all keys from the selected database
+func (ps *PersistentStorage) FlushDB() error {
+	if err := ps.wal.WriteFlushDB(ps.db); err != nil {
+		return fmt.Errorf("WAL write failed: %w", err)
+	}
+	ps.flush(ps.db)
+	return nil
+}
+
+// Rename renames key to newkey, overwriting newkey and keeping the TTL
+func (ps *PersistentStorage) Rename(key, newkey string) error {
+	if ps.lookup(ps.db, key) == nil {
+		return ErrKeyNotFound
+	}
+	if key == newkey {
+		return nil
+	}
+
+	// A single entry, so a crash never leaves both keys or neither
+	if err := ps.wal.WriteRename(ps.db, key, newkey); err != nil {
+		return fmt.Errorf("WAL write failed: %w", err)
+	}
+	ps.rename(ps.selected(), key, newkey)
+	return nil
+}
+
+// Copy copies key with its TTL to newkey in database db. Unless replace
+// is set it fails with ErrKeyExists if newkey is there already.
+func (ps *PersistentStorage) Copy(key string, db int, newkey string, replace bool) error {
+	if !validDB(db) {
+		return ErrInvalidDB
+	}
+	it := ps.lookup(ps.db, key)
+	if it == nil {
+		return ErrKeyNotFound
+	}
+	if ps.lookup(db, newkey) != nil && !replace {
+		return ErrKeyExists
+	}
+
+	// Evicting to make room may remove the source itself
+	if err := ps.ensureMemory(ps.dbs[db], newkey, it.value); err != nil {
+		return err
+	}
+	if ps.lookup(ps.db, key) == nil {
+		return ErrKeyNotFound
+	}
+
+	if err := ps.wal.WriteCopy(ps.db, key, db, newkey); err != nil {
+		return fmt.Errorf("WAL write failed: %w", err)
+	}
+	ps.copy(ps.selected(), ps.dbs[db], key, newkey)
+	return nil
+}
+
+// RandomKey returns a random live key of the selected database
+func (ps *PersistentStorage) RandomKey() (string, error) {
+	d := ps.selected()
+	now := ps.nowMillis()
+
+	// Map iteration starts at a random position
+	for key := range d.store {
+		if at, ok := d.expires[key]; ok && at <= now {
+			continue
+		}
+		return key, nil
+	}
+	return "", ErrKeyNotFound
+}
+
+// Touch records an access to key like a read does. It reports whether
+// the key exists.
+func (ps *PersistentStorage) Touch(key string) bool {
+	it := ps.lookup(ps.db, key)
+	if it == nil {
+		return false
+	}
+	ps.touch(it)
+	return true
+}
+
+// Object describes key without counting as an access
+func (ps *PersistentStorage) Object(key string) (ObjectInfo, error) {
+	it := ps.lookup(ps.db, key)
+	if it == nil {
+		return ObjectInfo{}, ErrKeyNotFound
+	}
+	now := ps.nowMillis()
+	return ObjectInfo{
+		Value: it.value,
+		Idle:  time.Duration(now-it.access) * time.Millisecond,
+		Freq:  lfuDecay(it.freq, it.access, now),
+	}, nil
+}
+
+// Expire sets the time at which key is deleted automatically
+func (ps *PersistentStorage) Expire(key string, at time.Time) error {
+	if ps.lookup(ps.db, key) == nil {
+		return ErrKeyNotFound
+	}
+
+	ms := at.UnixMilli()
+	if err := ps.wal.WriteExpire(ps.db, key, ms); err != nil {
+		return fmt.Errorf("WAL write failed: %w", err)
+	}
+	ps.selected().expires[key] = ms
+	return nil
+}
+
+// Persist removes the TTL of key. It reports whether a TTL was removed.
+func (ps *PersistentStorage) Persist(key string) (bool, error) {
+	if ps.lookup(ps.db, key) == nil {
+		return false, ErrKeyNotFound
+	}
+	d := ps.selected()
+	if _, ok := d.expires[key]; !ok {
+		return false, nil
+	}
+
+	if err := ps.wal.WriteExpire(ps.db, key, 0); err != nil {
+		return false, fmt.Errorf("WAL write failed: %w", err)
+	}
+	delete(d.expires, key)
+	return true, nil
+}
+
+// TTL returns the remaining time to live of key. ok is false if the key
+// has no expiry.
+func (ps *PersistentStorage) TTL(key string) (ttl time.Duration, ok bool, err error) {
+	if ps.lookup(ps.db, key) == nil {
+		return 0, false, ErrKeyNotFound
+	}
+	at, ok := ps.selected().expires[key]
+	if !ok {
+		return 0, false, nil
+	}
+	return time.Duration(at-ps.nowMillis()) * time.Millisecond, true, nil
+}
+
+// ExpireCycle samples up to max keys with a TTL across the databases and
+// deletes the expired ones. It returns the number of keys removed.
+func (ps *PersistentStorage) ExpireCycle(max int) int {
+	type expiredKey struct {
+		db  int
+		key string
+	}
+
+	now := ps.nowMillis()
+	var expired []expiredKey
+	for db, d := range ps.dbs {
+		for key, at := range d.expires {
+			if max--; max < 0 {
+				break
+			}
+			if at <= now {
+				expired = append(expired, expiredKey{db, key})
+			}
+		}
+	}
+
+	for _, k := range expired {
+		ps.drop(k.db, k.key, RemoveExpired)
+	}
+	return len(expired)
+}
+
+// SetMaxMemory sets the memory limit in bytes (0 disables it)
+func (ps *PersistentStorage) SetMaxMemory(bytes int64) {
+	ps.maxMemory = bytes
+}
+
+// MaxMemory returns the memory limit in bytes
+func (ps *PersistentStorage) MaxMemory() int64 {
+	return ps.maxMemory
+}
+
+// SetEvictionPolicy sets the policy used when maxmemory is reached
+func (ps *PersistentStorage) SetEvictionPolicy(p EvictionPolicy) {
+	ps.policy = p
+}
+
+// EvictionPolicy returns the current eviction policy
+func (ps *PersistentStorage) EvictionPolicy() EvictionPolicy {
+	return ps.policy
+}
+
+// UsedMemory returns the approximate bytes used by the dataset
+func (ps *PersistentStorage) UsedMemory() int64 {
+	return ps.used
+}
+
+// SetRemoveHook registers a callback for keys removed by expiry or eviction
+func (ps *PersistentStorage) SetRemoveHook(hook func(db int, key string, cause RemoveCause)) {
+	ps.onRemove = hook
+}
+
+// Clear removes the keys of every database and discards the WAL history
+func (ps *PersistentStorage) Clear() error {
+	if err := ps.wal.Truncate(); err != nil {
+		return fmt.Errorf("WAL truncate failed: %w", err)
+	}
+
+	for i := range ps.dbs {
+		ps.dbs[i] = newDatabase()
+	}
+	ps.used = 0
+	ps.lastCompaction = time.Now()
+	return nil
 }
 
 func (ps *PersistentStorage) Close() error {
@@ -114,5 +646,34 @@ func (ps *PersistentStorage) Close() error {
 
 // Compact truncates the WAL (call after creating snapshot)
 func (ps *PersistentStorage) Compact() error {
-	return ps.wal.Truncate()
+	if err := ps.wal.Truncate(); err != nil {
+		return err
+	}
+	ps.lastCompaction = time.Now()
+	return nil
+}
+
+// Persistence reports the WAL size and write statistics
+func (ps *PersistentStorage) Persistence() PersistenceInfo {
+	size, _ := ps.wal.Size()
+	return PersistenceInfo{
+		WALSize:        size,
+		WAL:            ps.wal.Stats(),
+		LastCompaction: ps.lastCompaction,
+	}
+}
+
+// SetSyncPolicy changes when WAL writes are fsynced
+func (ps *PersistentStorage) SetSyncPolicy(p wal.SyncPolicy) {
+	ps.wal.SetSyncPolicy(p)
+}
+
+// SyncPolicy returns the WAL fsync policy
+func (ps *PersistentStorage) SyncPolicy() wal.SyncPolicy {
+	return ps.wal.SyncPolicy()
+}
+
+// Sync flushes WAL writes not yet synced
+func (ps *PersistentStorage) Sync() error {
+	return ps.wal.Sync()
 }
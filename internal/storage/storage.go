@@ -1,19 +1,82 @@
 package storage
 
-import "errors"
+import (
+	"errors"
+	"time"
+
+	"memkv/internal/wal"
+)
 
 var (
 	ErrKeyNotFound = errors.New("key not found")
 	ErrKeyExists   = errors.New("key already exists")
+	ErrOOM         = errors.New("OOM command not allowed when used memory > 'maxmemory'")
+	ErrInvalidDB   = errors.New("DB index is out of range")
 )
 
-// Storage defines the interface for key-value storage operations
+// Databases is the number of numbered databases, selected with Select
+const Databases = 16
+
+// Storage defines the interface for key-value storage operations. Key
+// operations apply to the database chosen with Select, 0 by default.
 type Storage interface {
 	Get(key string) (string, error)
 	Set(key string, value string) error
+	SetKeepTTL(key string, value string) error
 	Delete(key string) error
 	Exists(key string) bool
 	Keys() []string
-	Size() int
+	Size() int // keys in all databases
+	Clear() error
 	Close() error
+
+	// Databases
+	Select(db int) error
+	DBSize(db int) int
+	Move(key string, db int) error
+	SwapDB(a, b int) error
+	FlushDB() error
+
+	// Key operations spanning two keys, each a single WAL entry
+	Rename(key, newkey string) error
+	Copy(key string, db int, newkey string, replace bool) error
+
+	// Introspection
+	RandomKey() (string, error)
+	Touch(key string) bool
+	Object(key string) (ObjectInfo, error)
+
+	// Expiry
+	Expire(key string, at time.Time) error
+	Persist(key string) (bool, error)
+	TTL(key string) (time.Duration, bool, error)
+	ExpireCycle(max int) int
+
+	// Memory limits
+	SetMaxMemory(bytes int64)
+	MaxMemory() int64
+	SetEvictionPolicy(p EvictionPolicy)
+	EvictionPolicy() EvictionPolicy
+	UsedMemory() int64
+	SetRemoveHook(hook func(db int, key string, cause RemoveCause))
+
+	// Persistence
+	Persistence() PersistenceInfo
+	SetSyncPolicy(p wal.SyncPolicy)
+	SyncPolicy() wal.SyncPolicy
+	Sync() error
+}
+
+// ObjectInfo describes a key for OBJECT
+type ObjectInfo struct {
+	Value string
+	Idle  time.Duration // since the last access
+	Freq  uint8         // logarithmic access counter used by LFU eviction
+}
+
+// PersistenceInfo describes the state of the storage's durability layer
+type PersistenceInfo struct {
+	WALSize        int64
+	WAL            wal.Stats
+	LastCompaction time.Time // zero if the WAL was never truncated
 }
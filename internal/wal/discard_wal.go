@@ -0,0 +1,41 @@
+package wal
+
+// DiscardWAL is a WAL that records nothing. It backs storage that is made
+// durable by other means, such as a Raft log kept in the real WAL.
+type DiscardWAL struct {
+	policy SyncPolicy
+}
+
+// NewDiscardWAL creates a WAL that discards every write
+func NewDiscardWAL() *DiscardWAL {
+	return &DiscardWAL{policy: SyncAlways}
+}
+
+// Write discards the entry
+func (w *DiscardWAL) Write(entry *Entry) error {
+	if entry == nil {
+		return ErrInvalidEntry
+	}
+	return nil
+}
+
+func (w *DiscardWAL) WriteSet(db int, key, value string) error                   { return nil }
+func (w *DiscardWAL) WriteSetKeepTTL(db int, key, value string) error            { return nil }
+func (w *DiscardWAL) WriteDelete(db int, key string) error                       { return nil }
+func (w *DiscardWAL) WriteExpire(db int, key string, atMillis int64) error       { return nil }
+func (w *DiscardWAL) WriteMove(db int, key string, dst int) error                { return nil }
+func (w *DiscardWAL) WriteSwapDB(a, b int) error                                 { return nil }
+func (w *DiscardWAL) WriteFlushDB(db int) error                                  { return nil }
+func (w *DiscardWAL) WriteRename(db int, key, newkey string) error               { return nil }
+func (w *DiscardWAL) WriteCopy(db int, key string, dst int, newkey string) error { return nil }
+
+// Replay has nothing to replay
+func (w *DiscardWAL) Replay(callback func(*Entry) error) error { return nil }
+
+func (w *DiscardWAL) Close() error               { return nil }
+func (w *DiscardWAL) Truncate() error            { return nil }
+func (w *DiscardWAL) Size() (int64, error)       { return 0, nil }
+func (w *DiscardWAL) Stats() Stats               { return Stats{} }
+func (w *DiscardWAL) Sync() error                { return nil }
+func (w *DiscardWAL) SetSyncPolicy(p SyncPolicy) { w.policy = p }
+func (w *DiscardWAL) SyncPolicy() SyncPolicy     { return w.policy }
@@ -4,13 +4,33 @@ import (
 	"bufio"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"memkv/internal/metrics"
+)
+
+var (
+	bytesWrittenMetric = metrics.NewCounter("memkv_wal_bytes_written_total",
+		"Bytes appended to write-ahead logs")
+	fsyncDurationMetric = metrics.NewHistogram("memkv_wal_fsync_duration_seconds",
+		"Duration of write-ahead log fsync calls", metrics.DefBuckets)
 )
 
+// maxEntryLen bounds a WAL line on replay, matching the longest command
+// the server accepts
+const maxEntryLen = 64 << 20
+
 // FileWAL is a file-based implementation of WAL
 type FileWAL struct {
 	filepath string
 	file     *os.File
 	closed   bool
+	stats    Stats
+
+	policy SyncPolicy
+	dirty  bool // written since the last fsync
 }
 
 // NewFileWAL creates a new file-based WAL
@@ -28,6 +48,7 @@ func NewFileWAL(filepath string) (*FileWAL, error) {
 		filepath: filepath,
 		file:     file,
 		closed:   false,
+		policy:   SyncAlways,
 	}, nil
 }
 
@@ -41,37 +62,192 @@ func (w *FileWAL) Write(entry *Entry) error {
 		return ErrInvalidEntry
 	}
 
-	// Write in simple space-separated format
-	line := fmt.Sprintf("%s %s %s\n", entry.Op, entry.Key, entry.Value)
-	if _, err := w.file.WriteString(line); err != nil {
+	n, err := w.file.WriteString(formatEntry(entry))
+	w.stats.BytesWritten += int64(n)
+	bytesWrittenMetric.Add(uint64(n))
+	if err != nil {
 		return fmt.Errorf("failed to write to WAL: %w", err)
 	}
 
+	w.dirty = true
+
 	// Sync to ensure durability
-	if err := w.file.Sync(); err != nil {
+	if w.policy == SyncAlways {
+		return w.sync()
+	}
+	return nil
+}
+
+// formatEntry encodes an entry in the simple space-separated format,
+// led by the database
+func formatEntry(entry *Entry) string {
+	return fmt.Sprintf("%d %s %s %s\n", entry.DB, entry.Op, entry.Key, entry.Value)
+}
+
+// Rewrite replaces the contents of the WAL with entries. They are written
+// and fsynced to a temporary file that is then renamed over the WAL, so a
+// crash leaves either the old or the new contents, never a mix.
+func (w *FileWAL) Rewrite(entries []*Entry) error {
+	if w.closed {
+		return ErrWALClosed
+	}
+
+	tmp := w.filepath + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_APPEND|os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create WAL: %w", err)
+	}
+
+	writer := bufio.NewWriter(file)
+	var written int64
+	for _, entry := range entries {
+		n, _ := writer.WriteString(formatEntry(entry))
+		written += int64(n)
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write WAL: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync WAL: %w", err)
+	}
+	if err := os.Rename(tmp, w.filepath); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to replace WAL: %w", err)
+	}
+
+	w.file.Close()
+	w.file = file
+	w.dirty = false
+	w.stats.BytesWritten += written
+	bytesWrittenMetric.Add(uint64(written))
+	return nil
+}
+
+// sync fsyncs the file and records its latency
+func (w *FileWAL) sync() error {
+	start := time.Now()
+	err := w.file.Sync()
+	w.stats.LastSync = time.Since(start)
+	w.stats.SyncTime += w.stats.LastSync
+	w.stats.Syncs++
+	fsyncDurationMetric.ObserveDuration(w.stats.LastSync)
+	if err != nil {
 		return fmt.Errorf("failed to sync WAL: %w", err)
 	}
 
+	w.dirty = false
 	return nil
 }
 
+// Sync flushes writes not yet synced under the current policy
+func (w *FileWAL) Sync() error {
+	if w.closed {
+		return ErrWALClosed
+	}
+	if !w.dirty {
+		return nil
+	}
+	return w.sync()
+}
+
+// SetSyncPolicy changes when writes are fsynced
+func (w *FileWAL) SetSyncPolicy(p SyncPolicy) {
+	w.policy = p
+}
+
+// SyncPolicy returns the current fsync policy
+func (w *FileWAL) SyncPolicy() SyncPolicy {
+	return w.policy
+}
+
 // WriteSet writes a SET operation to the WAL
-func (w *FileWAL) WriteSet(key, value string) error {
+func (w *FileWAL) WriteSet(db int, key, value string) error {
 	return w.Write(&Entry{
+		DB:    db,
 		Op:    OpSet,
 		Key:   key,
 		Value: value,
 	})
 }
 
+// WriteSetKeepTTL writes a SET that keeps the key's expiry to the WAL
+func (w *FileWAL) WriteSetKeepTTL(db int, key, value string) error {
+	return w.Write(&Entry{
+		DB:    db,
+		Op:    OpSetKeepTTL,
+		Key:   key,
+		Value: value,
+	})
+}
+
 // WriteDelete writes a DELETE operation to the WAL
-func (w *FileWAL) WriteDelete(key string) error {
+func (w *FileWAL) WriteDelete(db int, key string) error {
 	return w.Write(&Entry{
+		DB:  db,
 		Op:  OpDelete,
 		Key: key,
 	})
 }
 
+// WriteExpire writes an EXPIRE operation to the WAL
+func (w *FileWAL) WriteExpire(db int, key string, atMillis int64) error {
+	return w.Write(&Entry{
+		DB:    db,
+		Op:    OpExpire,
+		Key:   key,
+		Value: strconv.FormatInt(atMillis, 10),
+	})
+}
+
+// WriteMove writes a MOVE of key from db to dst to the WAL
+func (w *FileWAL) WriteMove(db int, key string, dst int) error {
+	return w.Write(&Entry{
+		DB:    db,
+		Op:    OpMove,
+		Key:   key,
+		Value: strconv.Itoa(dst),
+	})
+}
+
+// WriteSwapDB writes a SWAPDB operation to the WAL
+func (w *FileWAL) WriteSwapDB(a, b int) error {
+	return w.Write(&Entry{
+		DB:  a,
+		Op:  OpSwapDB,
+		Key: strconv.Itoa(b),
+	})
+}
+
+// WriteFlushDB writes a FLUSHDB operation to the WAL
+func (w *FileWAL) WriteFlushDB(db int) error {
+	return w.Write(&Entry{
+		DB: db,
+		Op: OpFlushDB,
+	})
+}
+
+// WriteRename writes a RENAME of key to newkey to the WAL
+func (w *FileWAL) WriteRename(db int, key, newkey string) error {
+	return w.Write(&Entry{
+		DB:    db,
+		Op:    OpRename,
+		Key:   key,
+		Value: newkey,
+	})
+}
+
+// WriteCopy writes a COPY of key to newkey in dst to the WAL
+func (w *FileWAL) WriteCopy(db int, key string, dst int, newkey string) error {
+	return w.Write(&Entry{
+		DB:    db,
+		Op:    OpCopy,
+		Key:   key,
+		Value: strconv.Itoa(dst) + " " + newkey,
+	})
+}
+
 // Replay replays the WAL entries using the provided callback
 func (w *FileWAL) Replay(callback func(*Entry) error) error {
 	file, err := os.Open(w.filepath)
@@ -85,19 +261,37 @@ func (w *FileWAL) Replay(callback func(*Entry) error) error {
 	defer file.Close()
 
 	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxEntryLen)
 	lineNum := 0
 
 	for scanner.Scan() {
 		lineNum++
 		line := scanner.Text()
 
+		// Entries start with their database, except those written
+		// before there were several, which belong to database 0
 		var entry Entry
-		n, err := fmt.Sscanf(line, "%s %s %s", &entry.Op, &entry.Key, &entry.Value)
-		if err != nil || n < 2 {
+		if db, rest, ok := strings.Cut(line, " "); ok {
+			if n, err := strconv.Atoi(db); err == nil && n >= 0 {
+				entry.DB, line = n, rest
+			}
+		}
+
+		// DELETE entries have no value and FLUSHDB entries no key. The
+		// value is the rest of the line, spaces included.
+		fields := strings.SplitN(line, " ", 3)
+		if fields[0] == "" || (fields[0] != OpFlushDB && (len(fields) < 2 || fields[1] == "")) {
 			// Log warning but continue - don't let one bad entry stop recovery
-			fmt.Printf("Warning: failed to parse WAL entry at line %d: %v\n", lineNum, err)
+			fmt.Printf("Warning: failed to parse WAL entry at line %d: %q\n", lineNum, scanner.Text())
 			continue
 		}
+		entry.Op = fields[0]
+		if len(fields) > 1 {
+			entry.Key = fields[1]
+		}
+		if len(fields) == 3 {
+			entry.Value = fields[2]
+		}
 
 		if err := callback(&entry); err != nil {
 			return fmt.Errorf("replay callback failed at line %d: %w", lineNum, err)
@@ -160,3 +354,8 @@ func (w *FileWAL) Size() (int64, error) {
 	}
 	return info.Size(), nil
 }
+
+// Stats returns write and fsync statistics
+func (w *FileWAL) Stats() Stats {
+	return w.stats
+}
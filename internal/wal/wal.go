@@ -1,6 +1,10 @@
 package wal
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
 	ErrInvalidEntry = errors.New("invalid WAL entry")
@@ -9,27 +13,82 @@ var (
 
 // Operation types
 const (
-	OpSet    = "SET"
-	OpDelete = "DELETE"
+	OpSet        = "SET"
+	OpSetKeepTTL = "SETKEEPTTL" // SET leaving the key's expiry as it is
+	OpDelete     = "DELETE"
+	OpExpire     = "EXPIRE"  // Value is the expiry in unix milliseconds, 0 clears it
+	OpMove       = "MOVE"    // Value is the destination database
+	OpSwapDB     = "SWAPDB"  // Key is the database swapped with DB
+	OpFlushDB    = "FLUSHDB" // No key
+	OpRename     = "RENAME"  // Value is the new name
+	OpCopy       = "COPY"    // Value is the destination database and key
+)
+
+// SyncPolicy controls when writes are flushed to disk with fsync
+type SyncPolicy string
+
+const (
+	SyncAlways   SyncPolicy = "always"   // fsync after every write
+	SyncEverySec SyncPolicy = "everysec" // fsync once per second via Sync
+	SyncNo       SyncPolicy = "no"       // leave flushing to the OS
 )
 
+// ParseSyncPolicy validates a sync policy name
+func ParseSyncPolicy(name string) (SyncPolicy, error) {
+	switch p := SyncPolicy(name); p {
+	case SyncAlways, SyncEverySec, SyncNo:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown fsync policy '%s'", name)
+}
+
 // Entry represents a single WAL entry
 type Entry struct {
+	DB    int // database the entry applies to
 	Op    string
 	Key   string
 	Value string
 }
 
+// Stats describes the write activity of a WAL
+type Stats struct {
+	BytesWritten int64
+	Syncs        int64
+	SyncTime     time.Duration // total time spent in fsync
+	LastSync     time.Duration // duration of the most recent fsync
+}
+
 // WAL defines the interface for Write-Ahead Log operations
 type WAL interface {
 	// Write appends an entry to the WAL
 	Write(entry *Entry) error
 
 	// WriteSet writes a SET operation to the WAL
-	WriteSet(key, value string) error
+	WriteSet(db int, key, value string) error
+
+	// WriteSetKeepTTL writes a SET that keeps the key's expiry to the WAL
+	WriteSetKeepTTL(db int, key, value string) error
 
 	// WriteDelete writes a DELETE operation to the WAL
-	WriteDelete(key string) error
+	WriteDelete(db int, key string) error
+
+	// WriteExpire writes an EXPIRE operation to the WAL
+	WriteExpire(db int, key string, atMillis int64) error
+
+	// WriteMove writes a MOVE of key from db to dst to the WAL
+	WriteMove(db int, key string, dst int) error
+
+	// WriteSwapDB writes a SWAPDB operation to the WAL
+	WriteSwapDB(a, b int) error
+
+	// WriteFlushDB writes a FLUSHDB operation to the WAL
+	WriteFlushDB(db int) error
+
+	// WriteRename writes a RENAME of key to newkey to the WAL
+	WriteRename(db int, key, newkey string) error
+
+	// WriteCopy writes a COPY of key to newkey in dst to the WAL
+	WriteCopy(db int, key string, dst int, newkey string) error
 
 	// Replay replays all WAL entries using the provided callback
 	Replay(callback func(*Entry) error) error
@@ -42,4 +101,16 @@ type WAL interface {
 
 	// Size returns the current size of the WAL in bytes
 	Size() (int64, error)
+
+	// Stats returns write and fsync statistics
+	Stats() Stats
+
+	// Sync flushes writes not yet synced under the current policy
+	Sync() error
+
+	// SetSyncPolicy changes when writes are fsynced
+	SetSyncPolicy(p SyncPolicy)
+
+	// SyncPolicy returns the current fsync policy
+	SyncPolicy() SyncPolicy
 }
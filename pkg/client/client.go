@@ -0,0 +1,369 @@
+// Package client is a Go client for memkv with a bounded connection
+// pool, automatic reconnects, pipelines and transactions.
+//
+//	c := client.New(client.Options{Addr: "localhost:6178"})
+//	defer c.Close()
+//
+//	if err := c.Set(ctx, "greeting", "hello world"); err != nil {
+//		return err
+//	}
+//	v, err := c.Get(ctx, "greeting")
+//	if errors.Is(err, client.ErrNil) {
+//		// the key does not exist
+//	}
+//
+// Errors distinguish nil replies (ErrNil), error replies from the server
+// (*Error) and network failures (*NetError). Commands failing with a
+// network error are retried on a new connection with exponential
+// backoff when they can't have been applied: the connection could not
+// be made or nothing was sent, or they only read. Writes whose reply was
+// lost fail instead of risking being applied twice, unless RetryWrites
+// is set; set MaxRetries to -1 to turn retries off entirely.
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Options configure a client. Zero fields take the documented defaults.
+type Options struct {
+	// Network is "tcp" (the default) or "unix"
+	Network string
+	// Addr is the server address, localhost:6178 by default
+	Addr string
+	// TLSConfig enables TLS when set
+	TLSConfig *tls.Config
+
+	// Username and Password authenticate new connections with AUTH. The
+	// username may be empty for the default user.
+	Username string
+	Password string
+	// ClientName is set on new connections with CLIENT SETNAME
+	ClientName string
+	// DB is the database new connections select. Running SELECT with Do
+	// would only switch the pooled connection it happens to use.
+	DB int
+
+	// DialTimeout limits connecting, 5 seconds by default
+	DialTimeout time.Duration
+	// ReadTimeout and WriteTimeout limit each exchange with the server,
+	// 3 seconds by default. -1 disables them. A context deadline
+	// shortens them.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+
+	// PoolSize is the maximum number of open connections, 10 by default
+	PoolSize int
+	// PoolTimeout is how long a command waits for a free connection,
+	// ReadTimeout plus one second by default
+	PoolTimeout time.Duration
+	// IdleTimeout closes connections unused for this long, 5 minutes by
+	// default
+	IdleTimeout time.Duration
+	// HealthCheckInterval is how long a connection may sit idle before
+	// it must answer a PING to be reused, 1 minute by default
+	HealthCheckInterval time.Duration
+
+	// MaxRetries is how often a command failing with a network error is
+	// retried, 3 by default. -1 disables retries.
+	MaxRetries int
+	// RetryWrites also retries writes that may have reached the server,
+	// for callers whose writes are safe to apply twice
+	RetryWrites bool
+	// MinRetryBackoff and MaxRetryBackoff bound the wait before each
+	// retry, which doubles from the minimum, 8ms and 512ms by default
+	MinRetryBackoff time.Duration
+	MaxRetryBackoff time.Duration
+}
+
+func (o *Options) setDefaults() {
+	if o.Network == "" {
+		o.Network = "tcp"
+	}
+	if o.Addr == "" {
+		o.Addr = "localhost:6178"
+	}
+	if o.DialTimeout == 0 {
+		o.DialTimeout = 5 * time.Second
+	}
+	switch o.ReadTimeout {
+	case 0:
+		o.ReadTimeout = 3 * time.Second
+	case -1:
+		o.ReadTimeout = 0
+	}
+	switch o.WriteTimeout {
+	case 0:
+		o.WriteTimeout = 3 * time.Second
+	case -1:
+		o.WriteTimeout = 0
+	}
+	if o.PoolSize <= 0 {
+		o.PoolSize = 10
+	}
+	if o.PoolTimeout == 0 {
+		o.PoolTimeout = o.ReadTimeout + time.Second
+	}
+	if o.IdleTimeout == 0 {
+		o.IdleTimeout = 5 * time.Minute
+	}
+	if o.HealthCheckInterval == 0 {
+		o.HealthCheckInterval = time.Minute
+	}
+	switch o.MaxRetries {
+	case 0:
+		o.MaxRetries = 3
+	case -1:
+		o.MaxRetries = 0
+	}
+	if o.MinRetryBackoff == 0 {
+		o.MinRetryBackoff = 8 * time.Millisecond
+	}
+	if o.MaxRetryBackoff == 0 {
+		o.MaxRetryBackoff = 512 * time.Millisecond
+	}
+}
+
+// Client is a pool of connections to one server. It is safe for
+// concurrent use.
+type Client struct {
+	opts   Options
+	pool   *pool
+	closed atomic.Bool
+}
+
+// New creates a client. Connections are opened as commands need them.
+func New(opts Options) *Client {
+	opts.setDefaults()
+	c := &Client{opts: opts}
+	c.pool = newPool(&c.opts)
+	return c
+}
+
+// Close closes the client's connections
+func (c *Client) Close() error {
+	c.closed.Store(true)
+	return c.pool.close()
+}
+
+// PoolStats counts the client's connections
+type PoolStats struct {
+	InUse int
+	Idle  int
+}
+
+// PoolStats returns the number of connections in use and idle
+func (c *Client) PoolStats() PoolStats {
+	inUse, idle := c.pool.stats()
+	return PoolStats{InUse: inUse, Idle: idle}
+}
+
+// readOnlyCommands can be retried after a network error, running them
+// twice has no effect. A transaction qualifies if it only holds these.
+var readOnlyCommands = map[string]bool{
+	"PING": true, "GET": true, "EXISTS": true, "TTL": true, "PTTL": true,
+	"KEYS": true, "SCAN": true, "TYPE": true, "RANDOMKEY": true,
+	"DBSIZE": true, "INFO": true, "MULTI": true, "EXEC": true,
+}
+
+// retryable reports whether batch may run again after failing with err
+func (c *Client) retryable(batch [][]string, err *NetError) bool {
+	if err.unsent || c.opts.RetryWrites {
+		return true
+	}
+	for _, args := range batch {
+		if !readOnlyCommands[strings.ToUpper(args[0])] {
+			return false
+		}
+	}
+	return true
+}
+
+// withConn runs fn, which sends batch, on a pooled connection, retrying
+// on a fresh one with backoff while it fails with a network error and
+// the batch is retryable
+func (c *Client) withConn(ctx context.Context, batch [][]string, fn func(cn *conn) error) error {
+	for attempt := 0; ; attempt++ {
+		if c.closed.Load() {
+			return ErrClosed
+		}
+		if attempt > 0 {
+			if err := sleep(ctx, c.backoff(attempt)); err != nil {
+				return err
+			}
+		}
+
+		cn, err := c.pool.get(ctx)
+		if err == nil {
+			err = fn(cn)
+			c.pool.put(cn)
+		}
+
+		var netErr *NetError
+		if !errors.As(err, &netErr) || !c.retryable(batch, netErr) ||
+			attempt >= c.opts.MaxRetries || ctx.Err() != nil {
+			return err
+		}
+	}
+}
+
+// backoff returns the wait before a retry: the minimum backoff doubled
+// for every attempt, capped and jittered down by up to half
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.opts.MaxRetryBackoff
+	if attempt < 32 {
+		d = min(c.opts.MinRetryBackoff<<(attempt-1), d)
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// process runs cmds in one round trip and stores their results. Error
+// replies only fail their own command; other errors fail them all.
+func (c *Client) process(ctx context.Context, cmds []*Cmd) error {
+	batch := make([][]string, len(cmds))
+	for i, cmd := range cmds {
+		batch[i] = cmd.args
+	}
+
+	err := c.withConn(ctx, batch, func(cn *conn) error {
+		replies, err := cn.roundTrip(ctx, &c.opts, batch)
+		if err != nil {
+			return err
+		}
+		for i, cmd := range cmds {
+			cmd.setReply(replies[i])
+		}
+		return nil
+	})
+	if err != nil {
+		for _, cmd := range cmds {
+			cmd.err = err
+		}
+	}
+	return err
+}
+
+func (c *Client) do(ctx context.Context, args ...string) *Cmd {
+	cmd := newCmd(args...)
+	c.process(ctx, []*Cmd{cmd})
+	return cmd
+}
+
+// Do runs any command. See Cmd.Result for the values it returns.
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	return c.do(ctx, args...).Result()
+}
+
+// Ping checks that the server is reachable
+func (c *Client) Ping(ctx context.Context) error {
+	return c.do(ctx, "PING").Err()
+}
+
+// Get returns the value of key, or ErrNil if it does not exist
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	return c.do(ctx, "GET", key).Text()
+}
+
+// Set stores value under key, clearing any TTL. The value may contain
+// single spaces between words but no line breaks.
+func (c *Client) Set(ctx context.Context, key, value string) error {
+	return c.do(ctx, "SET", key, value).Err()
+}
+
+// SetTTL stores value under key with a time to live, in one transaction
+func (c *Client) SetTTL(ctx context.Context, key, value string, ttl time.Duration) error {
+	tx := c.TxPipeline()
+	tx.Set(key, value)
+	tx.Expire(key, ttl)
+	_, err := tx.Exec(ctx)
+	return err
+}
+
+// Del deletes keys, atomically, and returns how many of them existed
+func (c *Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	return c.do(ctx, append([]string{"DEL"}, keys...)...).Int()
+}
+
+// Exists reports whether key exists
+func (c *Client) Exists(ctx context.Context, key string) (bool, error) {
+	return c.do(ctx, "EXISTS", key).Bool()
+}
+
+// Incr increments the integer stored at key and returns the new value.
+// A missing key counts as 0.
+func (c *Client) Incr(ctx context.Context, key string) (int64, error) {
+	return c.do(ctx, "INCR", key).Int()
+}
+
+// IncrBy adds delta to the integer stored at key and returns the new value
+func (c *Client) IncrBy(ctx context.Context, key string, delta int64) (int64, error) {
+	return c.do(ctx, "INCRBY", key, strconv.FormatInt(delta, 10)).Int()
+}
+
+// Decr decrements the integer stored at key and returns the new value
+func (c *Client) Decr(ctx context.Context, key string) (int64, error) {
+	return c.do(ctx, "DECR", key).Int()
+}
+
+// Expire sets the time to live of key with millisecond precision. It
+// reports whether the key exists.
+func (c *Client) Expire(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return c.do(ctx, "PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10)).Bool()
+}
+
+// Persist removes the time to live of key. It reports whether there was
+// one.
+func (c *Client) Persist(ctx context.Context, key string) (bool, error) {
+	return c.do(ctx, "PERSIST", key).Bool()
+}
+
+// NoTTL is returned by TTL for keys that never expire
+const NoTTL time.Duration = -1
+
+// TTL returns the remaining time to live of key, NoTTL if it has none,
+// or ErrNil if the key does not exist
+func (c *Client) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ms, err := c.do(ctx, "PTTL", key).Int()
+	switch {
+	case err != nil:
+		return 0, err
+	case ms == -2:
+		return 0, ErrNil
+	case ms == -1:
+		return NoTTL, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Keys returns every key. Scan walks large keyspaces without loading
+// them in one reply.
+func (c *Client) Keys(ctx context.Context) ([]string, error) {
+	return c.do(ctx, "KEYS").Strings()
+}
+
+// Publish sends message to channel and returns the number of
+// subscribers that received it
+func (c *Client) Publish(ctx context.Context, channel, message string) (int64, error) {
+	return c.do(ctx, "PUBLISH", channel, message).Int()
+}
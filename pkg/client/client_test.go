@@ -0,0 +1,222 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer answers inline commands with reply, which returns the
+// encoded reply or "" to drop the connection without replying
+type fakeServer struct {
+	t     *testing.T
+	ln    net.Listener
+	reply func(args []string) string
+
+	mu       sync.Mutex
+	received []string
+}
+
+func newFakeServer(t *testing.T, reply func(args []string) string) *fakeServer {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{t: t, ln: ln, reply: reply}
+	t.Cleanup(func() { ln.Close() })
+	go s.serve()
+	return s
+}
+
+func (s *fakeServer) serve() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(nc)
+	}
+}
+
+func (s *fakeServer) handle(nc net.Conn) {
+	defer nc.Close()
+
+	rd := bufio.NewReader(nc)
+	for {
+		line, err := rd.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		s.mu.Lock()
+		s.received = append(s.received, strings.Join(args, " "))
+		s.mu.Unlock()
+
+		reply := s.reply(args)
+		if reply == "" {
+			return
+		}
+		nc.Write([]byte(reply))
+	}
+}
+
+// count returns how often the server received cmd
+func (s *fakeServer) count(cmd string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, received := range s.received {
+		if received == cmd {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *fakeServer) client(opts Options) *Client {
+	opts.Addr = s.ln.Addr().String()
+	opts.MinRetryBackoff = time.Millisecond
+	opts.MaxRetryBackoff = time.Millisecond
+	c := New(opts)
+	s.t.Cleanup(func() { c.Close() })
+	return c
+}
+
+// dropFirst drops the connection the first time cmd is received
+func dropFirst(cmd, reply string) func(args []string) string {
+	var once sync.Once
+	return func(args []string) string {
+		dropped := false
+		if strings.Join(args, " ") == cmd {
+			once.Do(func() { dropped = true })
+		}
+		if dropped {
+			return ""
+		}
+		return reply
+	}
+}
+
+func TestWriteNotRetriedAfterLostReply(t *testing.T) {
+	s := newFakeServer(t, dropFirst("INCR counter", ":1\r\n"))
+	c := s.client(Options{})
+
+	var netErr *NetError
+	if _, err := c.Incr(context.Background(), "counter"); !errors.As(err, &netErr) {
+		t.Fatalf("INCR with a lost reply returned %v, want a NetError", err)
+	}
+	if n := s.count("INCR counter"); n != 1 {
+		t.Fatalf("INCR was sent %d times, want once", n)
+	}
+}
+
+func TestWriteRetriedWhenOptedIn(t *testing.T) {
+	s := newFakeServer(t, dropFirst("INCR counter", ":1\r\n"))
+	c := s.client(Options{RetryWrites: true})
+
+	if n, err := c.Incr(context.Background(), "counter"); err != nil || n != 1 {
+		t.Fatalf("INCR = %d, %v, want 1 after a retry", n, err)
+	}
+	if n := s.count("INCR counter"); n != 2 {
+		t.Fatalf("INCR was sent %d times, want twice", n)
+	}
+}
+
+func TestReadRetried(t *testing.T) {
+	s := newFakeServer(t, dropFirst("GET key", "$5\r\nvalue\r\n"))
+	c := s.client(Options{})
+
+	if v, err := c.Get(context.Background(), "key"); err != nil || v != "value" {
+		t.Fatalf("GET = %q, %v, want value after a retry", v, err)
+	}
+	if n := s.count("GET key"); n != 2 {
+		t.Fatalf("GET was sent %d times, want twice", n)
+	}
+}
+
+func TestDialRetried(t *testing.T) {
+	// Nothing listens on the address until after the first attempt
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	c := New(Options{Addr: addr, MinRetryBackoff: 50 * time.Millisecond, MaxRetryBackoff: 50 * time.Millisecond})
+	defer c.Close()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return
+		}
+		s := &fakeServer{t: t, ln: ln, reply: func([]string) string { return ":1\r\n" }}
+		t.Cleanup(func() { ln.Close() })
+		s.serve()
+	}()
+
+	if n, err := c.Incr(context.Background(), "counter"); err != nil || n != 1 {
+		t.Fatalf("INCR = %d, %v, want 1 once the server is up", n, err)
+	}
+}
+
+func TestErrorsMapped(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		if args[0] == "GET" {
+			return "$-1\r\n"
+		}
+		return "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"
+	})
+	c := s.client(Options{})
+
+	if _, err := c.Get(context.Background(), "missing"); !errors.Is(err, ErrNil) {
+		t.Fatalf("GET of a missing key returned %v, want ErrNil", err)
+	}
+	var replyErr *Error
+	if _, err := c.Incr(context.Background(), "key"); !errors.As(err, &replyErr) || replyErr.Code != "WRONGTYPE" {
+		t.Fatalf("INCR returned %v, want a WRONGTYPE error reply", err)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	s := newFakeServer(t, func(args []string) string {
+		if args[0] == "PING" {
+			return "+PONG\r\n"
+		}
+		return ":1\r\n"
+	})
+	c := s.client(Options{HealthCheckInterval: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	if _, err := c.Incr(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Incr(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.count("PING"); n != 0 {
+		t.Fatalf("%d PINGs for a connection used right away, want none", n)
+	}
+
+	// A connection idle past the interval is checked before it is reused
+	time.Sleep(20 * time.Millisecond)
+	if _, err := c.Incr(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if n := s.count("PING"); n != 1 {
+		t.Fatalf("%d PINGs for an idle connection, want 1", n)
+	}
+	if st := c.PoolStats(); st.InUse != 0 || st.Idle != 1 {
+		t.Fatalf("pool stats %+v, want one idle connection", st)
+	}
+}
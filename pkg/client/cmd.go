@@ -0,0 +1,126 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"memkv/internal/protocol"
+)
+
+// Cmd is a command and, once run, its result
+type Cmd struct {
+	args []string
+	val  any
+	err  error
+}
+
+func newCmd(args ...string) *Cmd {
+	return &Cmd{args: args}
+}
+
+// Args returns the command and its arguments
+func (c *Cmd) Args() []string {
+	return c.args
+}
+
+// Err returns the error of the command: ErrNil for a nil reply, an
+// *Error for an error reply or the error that kept it from running
+func (c *Cmd) Err() error {
+	return c.err
+}
+
+// Result returns the reply as a string (status and bulk replies), an
+// int64, or a []any of those for arrays. Nil elements of an array are
+// nil and error elements are *Error values.
+func (c *Cmd) Result() (any, error) {
+	return c.val, c.err
+}
+
+// Text returns a string reply
+func (c *Cmd) Text() (string, error) {
+	if c.err != nil {
+		return "", c.err
+	}
+	s, ok := c.val.(string)
+	if !ok {
+		return "", c.unexpected()
+	}
+	return s, nil
+}
+
+// Int returns an integer reply
+func (c *Cmd) Int() (int64, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, ok := c.val.(int64)
+	if !ok {
+		return 0, c.unexpected()
+	}
+	return n, nil
+}
+
+// Bool returns an integer reply as true if it is not 0
+func (c *Cmd) Bool() (bool, error) {
+	n, err := c.Int()
+	return n != 0, err
+}
+
+// Strings returns an array reply of strings
+func (c *Cmd) Strings() ([]string, error) {
+	if c.err != nil {
+		return nil, c.err
+	}
+	vals, ok := c.val.([]any)
+	if !ok {
+		return nil, c.unexpected()
+	}
+	strs := make([]string, len(vals))
+	for i, v := range vals {
+		if strs[i], ok = v.(string); !ok {
+			return nil, c.unexpected()
+		}
+	}
+	return strs, nil
+}
+
+// Duration returns an integer reply in milliseconds as a duration
+func (c *Cmd) Duration() (time.Duration, error) {
+	n, err := c.Int()
+	return time.Duration(n) * time.Millisecond, err
+}
+
+func (c *Cmd) unexpected() error {
+	return fmt.Errorf("memkv: unexpected reply %T to %s", c.val, c.args[0])
+}
+
+// setReply stores the result of the command from its reply
+func (c *Cmd) setReply(r protocol.Reply) {
+	switch r.Type {
+	case protocol.ErrorType:
+		c.err = parseError(r.Str)
+	case protocol.NilType:
+		c.err = ErrNil
+	default:
+		c.val = replyValue(r)
+	}
+}
+
+func replyValue(r protocol.Reply) any {
+	switch r.Type {
+	case protocol.ErrorType:
+		return parseError(r.Str)
+	case protocol.NilType:
+		return nil
+	case protocol.IntegerType:
+		return r.Int
+	case protocol.ArrayType:
+		vals := make([]any, len(r.Elems))
+		for i, elem := range r.Elems {
+			vals[i] = replyValue(elem)
+		}
+		return vals
+	default:
+		return r.Str
+	}
+}
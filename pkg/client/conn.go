@@ -0,0 +1,161 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"memkv/internal/protocol"
+)
+
+// conn is a connection to the server owned by the pool
+type conn struct {
+	nc     net.Conn
+	rd     *bufio.Reader
+	wr     *bufio.Writer
+	usedAt time.Time
+
+	// sent counts the bytes written to nc
+	sent int64
+
+	// broken is set after a network error; the pool closes the
+	// connection instead of reusing it
+	broken bool
+}
+
+// dial opens a connection and authenticates it
+func dial(ctx context.Context, opts *Options) (*conn, error) {
+	dialer := &net.Dialer{Timeout: opts.DialTimeout}
+	var nc net.Conn
+	var err error
+	if opts.TLSConfig != nil {
+		td := &tls.Dialer{NetDialer: dialer, Config: opts.TLSConfig}
+		nc, err = td.DialContext(ctx, opts.Network, opts.Addr)
+	} else {
+		nc, err = dialer.DialContext(ctx, opts.Network, opts.Addr)
+	}
+	if err != nil {
+		return nil, &NetError{Op: "dial", Err: err, unsent: true}
+	}
+
+	cn := &conn{
+		nc:     nc,
+		rd:     bufio.NewReader(nc),
+		usedAt: time.Now(),
+	}
+	cn.wr = bufio.NewWriter(cn)
+
+	var setup [][]string
+	if opts.Password != "" {
+		if opts.Username != "" {
+			setup = append(setup, []string{"AUTH", opts.Username, opts.Password})
+		} else {
+			setup = append(setup, []string{"AUTH", opts.Password})
+		}
+	}
+	if opts.ClientName != "" {
+		setup = append(setup, []string{"CLIENT", "SETNAME", opts.ClientName})
+	}
+	if opts.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(opts.DB)})
+	}
+	if len(setup) == 0 {
+		return cn, nil
+	}
+
+	replies, err := cn.roundTrip(ctx, opts, setup)
+	if err == nil {
+		for i, r := range replies {
+			if r.IsError() {
+				err = fmt.Errorf("memkv: %s failed: %w", setup[i][0], parseError(r.Str))
+				break
+			}
+		}
+	}
+	if err != nil {
+		cn.close()
+		return nil, err
+	}
+	return cn, nil
+}
+
+// roundTrip writes cmds in one batch and reads a reply to each. A
+// network error or cancelled context marks the connection broken, since
+// replies may still be in flight.
+func (cn *conn) roundTrip(ctx context.Context, opts *Options, cmds [][]string) ([]protocol.Reply, error) {
+	lines := make([]string, len(cmds))
+	for i, args := range cmds {
+		line, err := protocol.Inline(args)
+		if err != nil {
+			return nil, fmt.Errorf("memkv: %w", err)
+		}
+		lines[i] = line
+	}
+
+	// A context without a deadline can still be cancelled, which the
+	// blocked write or read notices through an expired deadline
+	stop := context.AfterFunc(ctx, func() { cn.nc.SetDeadline(time.Now()) })
+	defer stop()
+
+	replies, err := cn.exchange(ctx, opts, lines)
+	cn.usedAt = time.Now()
+	if err != nil {
+		cn.broken = true
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	}
+	return replies, nil
+}
+
+func (cn *conn) exchange(ctx context.Context, opts *Options, lines []string) ([]protocol.Reply, error) {
+	cn.nc.SetWriteDeadline(deadline(ctx, opts.WriteTimeout))
+	sent := cn.sent
+	for _, line := range lines {
+		cn.wr.WriteString(line)
+		cn.wr.WriteByte('\n')
+	}
+	if err := cn.wr.Flush(); err != nil {
+		return nil, &NetError{Op: "write", Err: err, unsent: cn.sent == sent}
+	}
+
+	cn.nc.SetReadDeadline(deadline(ctx, opts.ReadTimeout))
+	replies := make([]protocol.Reply, len(lines))
+	for i := range replies {
+		r, err := protocol.ReadReply(cn.rd)
+		if err != nil {
+			return nil, &NetError{Op: "read", Err: err}
+		}
+		replies[i] = r
+	}
+	return replies, nil
+}
+
+// Write sends p on the connection, counting the bytes sent
+func (cn *conn) Write(p []byte) (int, error) {
+	n, err := cn.nc.Write(p)
+	cn.sent += int64(n)
+	return n, err
+}
+
+func (cn *conn) close() error {
+	return cn.nc.Close()
+}
+
+// deadline is the earlier of the context's deadline and timeout from
+// now. A zero timeout means no limit.
+func deadline(ctx context.Context, timeout time.Duration) time.Time {
+	var t time.Time
+	if timeout > 0 {
+		t = time.Now().Add(timeout)
+	}
+	if d, ok := ctx.Deadline(); ok && (t.IsZero() || d.Before(t)) {
+		t = d
+	}
+	return t
+}
@@ -0,0 +1,63 @@
+package client
+
+import (
+	"errors"
+	"strings"
+
+	"memkv/internal/protocol"
+)
+
+var (
+	// ErrNil is returned when the server replies with nil, such as GET of
+	// a missing key
+	ErrNil = errors.New("memkv: nil reply")
+
+	// ErrClosed is returned by commands on a closed client
+	ErrClosed = errors.New("memkv: client is closed")
+
+	// ErrPoolTimeout is returned when no connection became free within
+	// Options.PoolTimeout
+	ErrPoolTimeout = errors.New("memkv: timed out waiting for a connection")
+
+	// ErrBadArgument is returned for arguments the inline protocol can't
+	// carry: empty ones, line breaks, and whitespace anywhere but in the
+	// value of SET and PUBLISH
+	ErrBadArgument = protocol.ErrInlineArgument
+)
+
+// Error is an error reply from the server. The command reached the
+// server, so the connection is still usable.
+type Error struct {
+	Code    string // first word of the reply, such as ERR, NOPERM or MOVED
+	Message string // the rest of the reply
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return e.Code
+	}
+	return e.Code + " " + e.Message
+}
+
+func parseError(s string) *Error {
+	code, msg, _ := strings.Cut(s, " ")
+	return &Error{Code: code, Message: msg}
+}
+
+// NetError is a failure talking to the server: dialing, a broken
+// connection or a timeout. The connection it happened on is discarded.
+type NetError struct {
+	Op  string // "dial", "write" or "read"
+	Err error
+
+	// unsent is set when no byte of the commands reached the server
+	unsent bool
+}
+
+func (e *NetError) Error() string {
+	return "memkv: " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *NetError) Unwrap() error {
+	return e.Err
+}
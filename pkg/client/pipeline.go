@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// Pipeline queues commands and sends them in one round trip. In a
+// transaction pipeline, from TxPipeline, they are wrapped in MULTI and
+// EXEC and run without other clients' commands in between.
+type Pipeline struct {
+	c    *Client
+	tx   bool
+	cmds []*Cmd
+}
+
+// Pipeline creates a pipeline
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{c: c}
+}
+
+// TxPipeline creates a pipeline run as a transaction
+func (c *Client) TxPipeline() *Pipeline {
+	return &Pipeline{c: c, tx: true}
+}
+
+// Do queues any command. Its result is available once Exec returns.
+func (p *Pipeline) Do(args ...string) *Cmd {
+	cmd := newCmd(args...)
+	p.cmds = append(p.cmds, cmd)
+	return cmd
+}
+
+// Get queues GET key
+func (p *Pipeline) Get(key string) *Cmd {
+	return p.Do("GET", key)
+}
+
+// Set queues SET key value
+func (p *Pipeline) Set(key, value string) *Cmd {
+	return p.Do("SET", key, value)
+}
+
+// Del queues DEL key [key ...]
+func (p *Pipeline) Del(keys ...string) *Cmd {
+	return p.Do(append([]string{"DEL"}, keys...)...)
+}
+
+// Incr queues INCR key
+func (p *Pipeline) Incr(key string) *Cmd {
+	return p.Do("INCR", key)
+}
+
+// IncrBy queues INCRBY key delta
+func (p *Pipeline) IncrBy(key string, delta int64) *Cmd {
+	return p.Do("INCRBY", key, strconv.FormatInt(delta, 10))
+}
+
+// Expire queues PEXPIRE key with ttl in milliseconds
+func (p *Pipeline) Expire(key string, ttl time.Duration) *Cmd {
+	return p.Do("PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10))
+}
+
+// Len returns the number of queued commands
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Discard drops the queued commands
+func (p *Pipeline) Discard() {
+	p.cmds = nil
+}
+
+// Exec sends the queued commands and returns them with their results.
+// The error is that of the first command that failed. The pipeline is
+// empty afterwards and can be reused.
+func (p *Pipeline) Exec(ctx context.Context) ([]*Cmd, error) {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+
+	var err error
+	if p.tx {
+		err = p.c.processTx(ctx, cmds)
+	} else {
+		err = p.c.process(ctx, cmds)
+	}
+	if err != nil {
+		return cmds, err
+	}
+	for _, cmd := range cmds {
+		if cmd.err != nil && cmd.err != ErrNil {
+			return cmds, cmd.err
+		}
+	}
+	return cmds, nil
+}
+
+// processTx runs cmds between MULTI and EXEC. A command rejected while
+// queuing makes the server discard the transaction; that command keeps
+// its own error and the others get the EXECABORT error.
+func (c *Client) processTx(ctx context.Context, cmds []*Cmd) error {
+	batch := make([][]string, 0, len(cmds)+2)
+	batch = append(batch, []string{"MULTI"})
+	for _, cmd := range cmds {
+		batch = append(batch, cmd.args)
+	}
+	batch = append(batch, []string{"EXEC"})
+
+	err := c.withConn(ctx, batch, func(cn *conn) error {
+		replies, err := cn.roundTrip(ctx, &c.opts, batch)
+		if err != nil {
+			return err
+		}
+		if replies[0].IsError() {
+			return parseError(replies[0].Str)
+		}
+
+		exec := newCmd("EXEC")
+		exec.setReply(replies[len(replies)-1])
+		results, ok := exec.val.([]any)
+		if !ok || len(results) != len(cmds) {
+			for i, cmd := range cmds {
+				switch queued := replies[i+1]; {
+				case queued.IsError():
+					cmd.setReply(queued)
+				case exec.err != nil:
+					cmd.err = exec.err
+				default:
+					cmd.err = exec.unexpected()
+				}
+			}
+			return nil
+		}
+
+		for i, cmd := range cmds {
+			switch v := results[i].(type) {
+			case *Error:
+				cmd.err = v
+			case nil:
+				cmd.err = ErrNil
+			default:
+				cmd.val = v
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for _, cmd := range cmds {
+			cmd.err = err
+		}
+	}
+	return err
+}
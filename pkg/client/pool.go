@@ -0,0 +1,125 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pool is a bounded set of connections. A slot in sem is held for every
+// connection in use, and connections are only dialed when none is idle,
+// so at most Options.PoolSize are ever open.
+type pool struct {
+	opts *Options
+	sem  chan struct{}
+
+	mu     sync.Mutex
+	idle   []*conn // most recently used last
+	closed bool
+}
+
+func newPool(opts *Options) *pool {
+	return &pool{
+		opts: opts,
+		sem:  make(chan struct{}, opts.PoolSize),
+	}
+}
+
+// get returns a connection, waiting up to PoolTimeout for one to be
+// free. Idle connections past IdleTimeout are closed, and those idle
+// past HealthCheckInterval must answer a PING before they are reused.
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	timer := time.NewTimer(p.opts.PoolTimeout)
+	defer timer.Stop()
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-timer.C:
+		return nil, ErrPoolTimeout
+	}
+
+	for {
+		cn, err := p.popIdle()
+		if err != nil {
+			<-p.sem
+			return nil, err
+		}
+		if cn == nil {
+			break
+		}
+
+		idle := time.Since(cn.usedAt)
+		if idle > p.opts.IdleTimeout || (idle > p.opts.HealthCheckInterval && !p.healthy(ctx, cn)) {
+			cn.close()
+			continue
+		}
+		return cn, nil
+	}
+
+	cn, err := dial(ctx, p.opts)
+	if err != nil {
+		<-p.sem
+		return nil, err
+	}
+	return cn, nil
+}
+
+// put returns a connection taken with get, closing it if it broke
+func (p *pool) put(cn *conn) {
+	p.mu.Lock()
+	if cn.broken || p.closed {
+		cn.close()
+	} else {
+		p.idle = append(p.idle, cn)
+	}
+	p.mu.Unlock()
+	<-p.sem
+}
+
+func (p *pool) popIdle() (*conn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return nil, ErrClosed
+	}
+	if len(p.idle) == 0 {
+		return nil, nil
+	}
+	cn := p.idle[len(p.idle)-1]
+	p.idle = p.idle[:len(p.idle)-1]
+	return cn, nil
+}
+
+func (p *pool) healthy(ctx context.Context, cn *conn) bool {
+	replies, err := cn.roundTrip(ctx, p.opts, [][]string{{"PING"}})
+	return err == nil && !replies[0].IsError()
+}
+
+// stats counts the open connections
+func (p *pool) stats() (inUse, idle int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.sem), len(p.idle)
+}
+
+// close closes the idle connections. Those in use are closed when they
+// are returned.
+func (p *pool) close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return ErrClosed
+	}
+	p.closed = true
+	var firstErr error
+	for _, cn := range p.idle {
+		if err := cn.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	p.idle = nil
+	return firstErr
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"strconv"
+)
+
+// ScanIterator walks the keyspace with SCAN, a batch at a time. Keys
+// that exist for the whole walk are returned exactly once; keys added or
+// deleted meanwhile may or may not be.
+type ScanIterator struct {
+	c     *Client
+	match string
+	count int
+
+	cursor  string
+	started bool
+	keys    []string
+	key     string
+	err     error
+}
+
+// Scan returns an iterator over the keys matching the glob pattern
+// match ("" for all), fetching about count keys per round trip (0 for
+// the server's default)
+//
+//	it := c.Scan("user:*", 100)
+//	for it.Next(ctx) {
+//		fmt.Println(it.Key())
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+func (c *Client) Scan(match string, count int) *ScanIterator {
+	return &ScanIterator{c: c, match: match, count: count, cursor: "0"}
+}
+
+// Next advances to the next key, fetching a batch when needed. It
+// returns false when the walk is done or failed.
+func (it *ScanIterator) Next(ctx context.Context) bool {
+	for len(it.keys) == 0 {
+		if it.err != nil || (it.started && it.cursor == "0") {
+			return false
+		}
+		it.fetch(ctx)
+	}
+	it.key, it.keys = it.keys[0], it.keys[1:]
+	return true
+}
+
+func (it *ScanIterator) fetch(ctx context.Context) {
+	args := []string{"SCAN", it.cursor}
+	if it.match != "" {
+		args = append(args, "MATCH", it.match)
+	}
+	if it.count > 0 {
+		args = append(args, "COUNT", strconv.Itoa(it.count))
+	}
+
+	cmd := it.c.do(ctx, args...)
+	vals, ok := cmd.val.([]any)
+	if cmd.err != nil {
+		it.err = cmd.err
+		return
+	}
+	if !ok || len(vals) != 2 {
+		it.err = cmd.unexpected()
+		return
+	}
+	cursor, ok1 := vals[0].(string)
+	batch := &Cmd{args: args, val: vals[1]}
+	keys, err := batch.Strings()
+	if !ok1 || err != nil {
+		it.err = cmd.unexpected()
+		return
+	}
+
+	it.cursor = cursor
+	it.keys = keys
+	it.started = true
+}
+
+// Key returns the key Next advanced to
+func (it *ScanIterator) Key() string {
+	return it.key
+}
+
+// Err returns the error that ended the walk, if any
+func (it *ScanIterator) Err() error {
+	return it.err
+}
@@ -0,0 +1,28 @@
+//go:build !unix
+
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+)
+
+// lockDir creates the lock file at path, failing if it exists. Unlike
+// the flock used on Unix, a crash leaves the file behind and it must be
+// removed by hand.
+func lockDir(path string) (func() error, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, ErrLocked
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lock file: %w", err)
+	}
+	f.WriteString(strconv.Itoa(os.Getpid()) + "\n")
+	f.Close()
+
+	return func() error { return os.Remove(path) }, nil
+}
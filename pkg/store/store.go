@@ -0,0 +1,369 @@
+// Package store embeds memkv in a Go program: the WAL-backed storage,
+// expiry and commands of the server, without a network in between.
+//
+//	db, err := store.Open("/var/lib/mytool", store.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	defer db.Close()
+//
+//	if err := db.Set("greeting", "hello world"); err != nil {
+//		return err
+//	}
+//	v, err := db.Get("greeting")
+//
+// Every command runs atomically and is durable according to the fsync
+// policy, as on the server. A data directory can be open in only one
+// process at a time.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"memkv/internal/executor"
+	"memkv/internal/protocol"
+	"memkv/pkg/client"
+)
+
+const (
+	walFile  = "wal.log"
+	lockFile = "LOCK"
+)
+
+var (
+	// ErrLocked is returned by Open when another process has the data
+	// directory open
+	ErrLocked = errors.New("store: data directory is in use by another process")
+
+	// ErrClosed is returned by methods of a closed DB
+	ErrClosed = errors.New("store: database is closed")
+
+	// ErrNil is returned for nil replies, such as Get of a missing key.
+	// It is the client's ErrNil, so code can handle both alike.
+	ErrNil = client.ErrNil
+
+	// ErrBadArgument is returned for arguments commands can't carry, as
+	// in the client
+	ErrBadArgument = client.ErrBadArgument
+)
+
+// Error is an error reply to a command, the same type the client returns
+type Error = client.Error
+
+// NoTTL is returned by TTL for keys that never expire
+const NoTTL = client.NoTTL
+
+// connectionCommands change the mode of a connection, which a DB
+// doesn't have; transactions go through Tx instead
+var connectionCommands = map[string]bool{
+	"SUBSCRIBE":    true,
+	"UNSUBSCRIBE":  true,
+	"PSUBSCRIBE":   true,
+	"PUNSUBSCRIBE": true,
+	"MONITOR":      true,
+	"PSYNC":        true,
+	"MULTI":        true,
+	"EXEC":         true,
+	"DISCARD":      true,
+}
+
+// Options configure a DB. Zero fields take the server's defaults.
+type Options struct {
+	// Fsync is the WAL fsync policy: always (the default), everysec or no
+	Fsync string
+
+	// MaxMemory limits the data size in bytes, 0 for no limit
+	MaxMemory int64
+	// MaxMemoryPolicy is the eviction policy once MaxMemory is reached,
+	// noeviction by default
+	MaxMemoryPolicy string
+}
+
+// DB is an open data directory. It is safe for concurrent use.
+type DB struct {
+	dir    string
+	unlock func() error
+	e      *executor.Executor
+
+	// mu serializes commands on sess, the DB's stand-in for a client
+	// connection
+	mu     sync.Mutex
+	sess   *executor.Session
+	closed bool
+}
+
+// Open opens the data directory dir, creating it if needed, and
+// recovers its data from the WAL
+func Open(dir string, opts Options) (*DB, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	}
+	unlock, err := lockDir(filepath.Join(dir, lockFile))
+	if err != nil {
+		return nil, err
+	}
+
+	e, err := executor.New(filepath.Join(dir, walFile))
+	if err != nil {
+		unlock()
+		return nil, err
+	}
+	if err := configure(e, opts); err != nil {
+		e.Close()
+		unlock()
+		return nil, err
+	}
+
+	return &DB{
+		dir:    dir,
+		unlock: unlock,
+		e:      e,
+		sess:   e.NewSession("embedded", nil),
+	}, nil
+}
+
+func configure(e *executor.Executor, opts Options) error {
+	if opts.Fsync != "" {
+		if err := e.SetFsyncPolicy(opts.Fsync); err != nil {
+			return err
+		}
+	}
+	if opts.MaxMemoryPolicy != "" {
+		if err := e.SetMaxMemoryPolicy(opts.MaxMemoryPolicy); err != nil {
+			return err
+		}
+	}
+	e.SetMaxMemory(opts.MaxMemory)
+	return nil
+}
+
+// Dir returns the data directory
+func (db *DB) Dir() string {
+	return db.dir
+}
+
+// Close syncs and closes the WAL and releases the data directory
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	db.closed = true
+	db.e.CloseSession(db.sess)
+	err := db.e.Close()
+	if unlockErr := db.unlock(); err == nil {
+		err = unlockErr
+	}
+	return err
+}
+
+// Do runs any command that doesn't need a connection of its own. It
+// returns strings, int64s or []any of those; nil elements of an array
+// are nil and error elements are *Error values.
+func (db *DB) Do(args ...string) (any, error) {
+	if len(args) > 0 && connectionCommands[strings.ToUpper(args[0])] {
+		return nil, fmt.Errorf("store: %s is not supported in embedded mode", strings.ToUpper(args[0]))
+	}
+	line, err := protocol.Inline(args)
+	if err != nil {
+		return nil, fmt.Errorf("store: %w", err)
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+	return result(db.e.ProcessCommand(db.sess, line))
+}
+
+// Tx runs cmds as a transaction: no other command runs between them.
+// If a command can't be queued, for instance because it is unknown,
+// nothing runs. Error replies of individual commands are *Error values
+// in the results.
+func (db *DB) Tx(cmds ...[]string) ([]any, error) {
+	lines := make([]string, len(cmds))
+	for i, args := range cmds {
+		if len(args) > 0 && connectionCommands[strings.ToUpper(args[0])] {
+			return nil, fmt.Errorf("store: %s is not supported in a transaction", strings.ToUpper(args[0]))
+		}
+		line, err := protocol.Inline(args)
+		if err != nil {
+			return nil, fmt.Errorf("store: %w", err)
+		}
+		lines[i] = line
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.closed {
+		return nil, ErrClosed
+	}
+
+	if _, err := result(db.e.ProcessCommand(db.sess, "MULTI")); err != nil {
+		return nil, err
+	}
+	for _, line := range lines {
+		if _, err := result(db.e.ProcessCommand(db.sess, line)); err != nil {
+			db.e.ProcessCommand(db.sess, "DISCARD")
+			return nil, err
+		}
+	}
+	v, err := result(db.e.ProcessCommand(db.sess, "EXEC"))
+	if err != nil {
+		return nil, err
+	}
+	return v.([]any), nil
+}
+
+// result converts a reply to the values Do returns
+func result(r protocol.Reply) (any, error) {
+	switch r.Type {
+	case protocol.ErrorType:
+		return nil, parseError(r.Str)
+	case protocol.NilType:
+		return nil, ErrNil
+	}
+	return value(r), nil
+}
+
+func value(r protocol.Reply) any {
+	switch r.Type {
+	case protocol.ErrorType:
+		return parseError(r.Str)
+	case protocol.NilType:
+		return nil
+	case protocol.IntegerType:
+		return r.Int
+	case protocol.ArrayType:
+		vals := make([]any, len(r.Elems))
+		for i, elem := range r.Elems {
+			vals[i] = value(elem)
+		}
+		return vals
+	default:
+		return r.Str
+	}
+}
+
+func parseError(s string) *Error {
+	code, msg, _ := strings.Cut(s, " ")
+	return &Error{Code: code, Message: msg}
+}
+
+// Get returns the value of key, or ErrNil if it does not exist
+func (db *DB) Get(key string) (string, error) {
+	v, err := db.Do("GET", key)
+	if err != nil {
+		return "", err
+	}
+	return v.(string), nil
+}
+
+// Set stores value under key, clearing any TTL. The value may contain
+// single spaces between words but no line breaks.
+func (db *DB) Set(key, value string) error {
+	_, err := db.Do("SET", key, value)
+	return err
+}
+
+// SetTTL stores value under key with a time to live, atomically
+func (db *DB) SetTTL(key, value string, ttl time.Duration) error {
+	results, err := db.Tx(
+		[]string{"SET", key, value},
+		[]string{"PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10)},
+	)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		if err, ok := r.(*Error); ok {
+			return err
+		}
+	}
+	return nil
+}
+
+// Del deletes keys, atomically, and returns how many of them existed
+func (db *DB) Del(keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+	return db.integer(append([]string{"DEL"}, keys...)...)
+}
+
+// Exists reports whether key exists
+func (db *DB) Exists(key string) (bool, error) {
+	n, err := db.integer("EXISTS", key)
+	return n == 1, err
+}
+
+// Incr increments the integer stored at key and returns the new value.
+// A missing key counts as 0.
+func (db *DB) Incr(key string) (int64, error) {
+	return db.integer("INCR", key)
+}
+
+// IncrBy adds delta to the integer stored at key and returns the new value
+func (db *DB) IncrBy(key string, delta int64) (int64, error) {
+	return db.integer("INCRBY", key, strconv.FormatInt(delta, 10))
+}
+
+// Expire sets the time to live of key with millisecond precision. It
+// reports whether the key exists.
+func (db *DB) Expire(key string, ttl time.Duration) (bool, error) {
+	n, err := db.integer("PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10))
+	return n == 1, err
+}
+
+// Persist removes the time to live of key. It reports whether there was
+// one.
+func (db *DB) Persist(key string) (bool, error) {
+	n, err := db.integer("PERSIST", key)
+	return n == 1, err
+}
+
+// TTL returns the remaining time to live of key, NoTTL if it has none, or ErrNil if the key does not exist
+func (db *DB) TTL(key string) (time.Duration, error) {
+	ms, err := db.integer("PTTL", key)
+	switch {
+	case err != nil:
+		return 0, err
+	case ms == -2:
+		return 0, ErrNil
+	case ms == -1:
+		return NoTTL, nil
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Keys returns every key
+func (db *DB) Keys() ([]string, error) {
+	v, err := db.Do("KEYS")
+	if err != nil {
+		return nil, err
+	}
+	vals := v.([]any)
+	keys := make([]string, len(vals))
+	for i, k := range vals {
+		keys[i] = k.(string)
+	}
+	return keys, nil
+}
+
+func (db *DB) integer(args ...string) (int64, error) {
+	v, err := db.Do(args...)
+	if err != nil {
+		return 0, err
+	}
+	return v.(int64), nil
+}
@@ -0,0 +1,119 @@
+package store
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func open(t *testing.T, dir string) *DB {
+	t.Helper()
+
+	db, err := Open(dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestOpenLocksDir(t *testing.T) {
+	dir := t.TempDir()
+	db := open(t, dir)
+
+	if _, err := Open(dir, Options{}); !errors.Is(err, ErrLocked) {
+		t.Fatalf("second Open of the directory returned %v, want ErrLocked", err)
+	}
+
+	// Closing releases the directory
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	open(t, dir).Close()
+}
+
+func TestReopenRecoversData(t *testing.T) {
+	dir := t.TempDir()
+	db := open(t, dir)
+	if err := db.Set("a", "hello world"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.SetTTL("b", "2", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db = open(t, dir)
+	defer db.Close()
+	if v, err := db.Get("a"); err != nil || v != "hello world" {
+		t.Fatalf("Get(a) = %q, %v after reopening", v, err)
+	}
+	if ttl, err := db.TTL("b"); err != nil || ttl <= 0 || ttl > time.Hour {
+		t.Fatalf("TTL(b) = %v, %v after reopening", ttl, err)
+	}
+}
+
+func TestErrNil(t *testing.T) {
+	db := open(t, t.TempDir())
+	defer db.Close()
+
+	if _, err := db.Get("missing"); !errors.Is(err, ErrNil) {
+		t.Fatalf("Get of a missing key returned %v, want ErrNil", err)
+	}
+	if _, err := db.TTL("missing"); !errors.Is(err, ErrNil) {
+		t.Fatalf("TTL of a missing key returned %v, want ErrNil", err)
+	}
+}
+
+func TestDel(t *testing.T) {
+	db := open(t, t.TempDir())
+	defer db.Close()
+
+	db.Set("a", "1")
+	db.Set("b", "2")
+	if n, err := db.Del("a", "b", "missing"); err != nil || n != 2 {
+		t.Fatalf("Del = %d, %v, want 2", n, err)
+	}
+	if keys, _ := db.Keys(); len(keys) != 0 {
+		t.Fatalf("keys left after Del: %v", keys)
+	}
+}
+
+func TestTx(t *testing.T) {
+	db := open(t, t.TempDir())
+	defer db.Close()
+
+	results, err := db.Tx([]string{"SET", "a", "1"}, []string{"INCR", "a"}, []string{"GET", "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0] != "OK" || results[1] != int64(2) || results[2] != "2" {
+		t.Fatalf("Tx results %v", results)
+	}
+
+	// A command that can't be queued discards the whole transaction
+	_, err = db.Tx([]string{"SET", "a", "changed"}, []string{"NOSUCHCOMMAND"})
+	var replyErr *Error
+	if !errors.As(err, &replyErr) {
+		t.Fatalf("Tx with an unknown command returned %v, want an error reply", err)
+	}
+	if v, _ := db.Get("a"); v != "2" {
+		t.Fatalf("a = %q after a discarded transaction, want 2", v)
+	}
+
+	// The DB is usable, and outside a transaction, afterwards
+	if err := db.Set("b", "1"); err != nil {
+		t.Fatalf("Set after a discarded transaction: %v", err)
+	}
+}
+
+func TestClosed(t *testing.T) {
+	db := open(t, t.TempDir())
+	db.Close()
+
+	if _, err := db.Get("a"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Get on a closed DB returned %v, want ErrClosed", err)
+	}
+	if err := db.Close(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("second Close returned %v, want ErrClosed", err)
+	}
+}